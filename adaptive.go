@@ -0,0 +1,99 @@
+package memcachedb
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultAdaptiveFactor is how fast adaptive TTLs move when
+// AdaptiveTTL.Factor is unset.
+const defaultAdaptiveFactor = 2
+
+type (
+	// AdaptiveTTL configures the adaptive TTLs set by WithAdaptiveTTL.
+	AdaptiveTTL struct {
+		// Min and Max bound the TTL of every key. Max is required; Min
+		// may be zero.
+		Min, Max time.Duration
+		// Factor is what the TTL of a key is multiplied by when a
+		// reload finds its value unchanged, and divided by when it
+		// changed. It defaults to 2.
+		Factor float64
+	}
+
+	// adaptive tracks how often the values of keys change across loads.
+	adaptive struct {
+		cfg AdaptiveTTL
+
+		mu   sync.Mutex
+		keys map[string]*volatility
+	}
+
+	// volatility is what adaptive knows of a key: the scale applied to
+	// its TTL, the checksum of its last value and when it was loaded.
+	volatility struct {
+		scale  float64
+		sum    uint64
+		loaded int64
+	}
+)
+
+func newAdaptive(cfg AdaptiveTTL) *adaptive {
+	if cfg.Factor <= 1 {
+		cfg.Factor = defaultAdaptiveFactor
+	}
+
+	return &adaptive{cfg: cfg, keys: make(map[string]*volatility)}
+}
+
+// ttl returns the TTL of v, loaded for key at now, scaling ttl by how much
+// the values of key have changed across its past loads.
+func (a *adaptive) ttl(key string, ttl time.Duration, v interface{}, now int64) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	sum := checksum(v)
+
+	a.mu.Lock()
+	k, ok := a.keys[key]
+	switch {
+	case !ok:
+		k = &volatility{scale: 1}
+		a.keys[key] = k
+	case sum == 0 || k.sum == 0:
+		// Not comparable: the scale stays.
+	case sum == k.sum:
+		k.scale *= a.cfg.Factor
+	default:
+		k.scale /= a.cfg.Factor
+	}
+	k.sum = sum
+	k.loaded = now
+	scaled := time.Duration(float64(ttl) * k.scale)
+	// The scale is held within the bounds too, so that it takes a single
+	// load to move back from one of them.
+	switch {
+	case scaled > a.cfg.Max:
+		scaled = a.cfg.Max
+		k.scale = float64(a.cfg.Max) / float64(ttl)
+	case scaled < a.cfg.Min:
+		scaled = a.cfg.Min
+		k.scale = float64(a.cfg.Min) / float64(ttl)
+	}
+	a.mu.Unlock()
+
+	return scaled
+}
+
+// prune forgets the keys not loaded for twice the longest TTL, whose past
+// says little of their values anymore.
+func (a *adaptive) prune(now int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key, k := range a.keys {
+		if k.loaded+2*int64(a.cfg.Max) < now {
+			delete(a.keys, key)
+		}
+	}
+}
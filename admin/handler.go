@@ -0,0 +1,296 @@
+// Package admin exposes a memcachedb cache to operators over HTTP:
+//
+//	GET  /stats                          counters of the cache
+//	GET  /keys?pattern=&limit=&cursor=   keys, sorted and paginated
+//	GET  /patterns?n=&by=                top query patterns, by miss_rate,
+//	                                     load_latency or load_time
+//	GET  /entry/{key...}                 value cached under a key, which
+//	                                     may hold slashes, what Inspect
+//	                                     tells of it and its TTL
+//	GET  /trace?key=                     events recorded by WithKeyTrace
+//	POST /flush?prefix=                  removes every entry, or those
+//	                                     whose key starts with prefix
+//	POST /invalidate?tag=&table=&key=    removes the entries named
+//	GET  /config                         configuration of the cache
+//	GET  /snapshot                       snapshot, as by SaveSnapshot
+//	POST /snapshot                       saves a snapshot to the file
+//	                                     set by WithSnapshotFile
+//
+// Mount the handler under a prefix of its own and behind authentication:
+//
+//	mux.Handle("/debug/cache/", http.StripPrefix("/debug/cache", admin.NewHandler(c)))
+//
+// or serve it on a Unix socket that only operators can reach, which the
+// cachectl command talks to as well:
+//
+//	l, err := net.Listen("unix", "/run/app/cache.sock")
+//	...
+//	go http.Serve(l, admin.NewHandler(c))
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	memcachedb "memcache-database-module"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 10000
+)
+
+type (
+	// Handler serves the admin endpoints of a cache.
+	Handler struct {
+		cache    memcachedb.Cache
+		mux      *http.ServeMux
+		snapshot string
+	}
+
+	// Option configures a Handler.
+	Option func(h *Handler)
+
+	// KeyPage is the body of /keys replies. Next is the cursor of the
+	// next page, empty on the last one.
+	KeyPage struct {
+		Keys []string `json:"keys"`
+		Next string   `json:"next,omitempty"`
+	}
+
+	// EntryReply is the body of /entry replies. Value is the cached value
+	// encoded as JSON, or formatted with fmt when it has no JSON form;
+	// Info describes the entry, as Inspect does, and TTL is how long it
+	// has left, as TTL tells.
+	EntryReply struct {
+		Key   string                `json:"key"`
+		Type  string                `json:"type"`
+		Value interface{}           `json:"value"`
+		Info  *memcachedb.EntryInfo `json:"info,omitempty"`
+		TTL   time.Duration         `json:"ttl,omitempty"`
+	}
+
+	// StatsReply is the body of /stats replies.
+	StatsReply struct {
+		memcachedb.Stats
+		HitRatio float64 `json:"HitRatio"`
+	}
+
+	// InvalidateReply is the body of /flush and /invalidate replies.
+	InvalidateReply struct {
+		Removed int `json:"removed"`
+	}
+
+	// PatternReply is an element of the body of /patterns replies.
+	PatternReply struct {
+		memcachedb.PatternStats
+		MissRate    float64       `json:"MissRate"`
+		LoadLatency time.Duration `json:"LoadLatency"`
+	}
+
+	// SnapshotReply is the body of POST /snapshot replies.
+	SnapshotReply struct {
+		Path string `json:"path"`
+	}
+)
+
+// WithSnapshotFile lets POST /snapshot save snapshots to path, typically
+// the path given to memcachedb.WithSnapshot, replacing the file at once.
+func WithSnapshotFile(path string) Option {
+	return func(h *Handler) {
+		h.snapshot = path
+	}
+}
+
+// NewHandler returns a Handler for c.
+func NewHandler(c memcachedb.Cache, opts ...Option) *Handler {
+	h := &Handler{cache: c, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.mux.HandleFunc("GET /stats", h.stats)
+	h.mux.HandleFunc("GET /keys", h.keys)
+	h.mux.HandleFunc("GET /patterns", h.patterns)
+	h.mux.HandleFunc("GET /entry/{key...}", h.entry)
+	h.mux.HandleFunc("GET /trace", h.trace)
+	h.mux.HandleFunc("POST /flush", h.flush)
+	h.mux.HandleFunc("POST /invalidate", h.invalidate)
+	h.mux.HandleFunc("GET /config", h.config)
+	h.mux.HandleFunc("GET /snapshot", h.download)
+	h.mux.HandleFunc("POST /snapshot", h.save)
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, _ *http.Request) {
+	s := h.cache.Stats()
+	reply(w, StatsReply{Stats: s, HitRatio: s.HitRatio()})
+}
+
+// keys lists the keys matching the glob pattern, in order, starting after
+// the cursor, which is the last key of the previous page.
+func (h *Handler) keys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pattern := q.Get("pattern")
+	if _, err := path.Match(pattern, ""); err != nil {
+		http.Error(w, "bad pattern: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "bad limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLimit)
+	}
+	keys, next, err := h.cache.Keys(pattern, limit, q.Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	page := KeyPage{Keys: keys, Next: next}
+	if page.Keys == nil {
+		page.Keys = []string{}
+	}
+
+	reply(w, page)
+}
+
+// orders are the rankings of /patterns by name.
+var orders = map[string]memcachedb.PatternOrder{
+	"miss_rate":    memcachedb.ByMissRate,
+	"load_latency": memcachedb.ByLoadLatency,
+	"load_time":    memcachedb.ByLoadTime,
+}
+
+// patterns lists the n query patterns ranking first by the order named by,
+// miss_rate unless given; every pattern without n.
+func (h *Handler) patterns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	by := memcachedb.ByMissRate
+	if s := q.Get("by"); s != "" {
+		o, ok := orders[s]
+		if !ok {
+			http.Error(w, "bad order: "+s, http.StatusBadRequest)
+			return
+		}
+		by = o
+	}
+	n := 0
+	if s := q.Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n <= 0 {
+			http.Error(w, "bad n", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows := []PatternReply{}
+	for _, p := range h.cache.TopPatterns(n, by) {
+		rows = append(rows, PatternReply{PatternStats: p, MissRate: p.MissRate(), LoadLatency: p.LoadLatency()})
+	}
+	reply(w, rows)
+}
+
+func (h *Handler) entry(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	v, ok := h.cache.PeekKey(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	e := EntryReply{Key: key, Type: fmt.Sprintf("%T", v), Value: v}
+	if info, ok := h.cache.Inspect(key); ok {
+		e.Info = &info
+	}
+	if ttl, ok := h.cache.TTL(key); ok {
+		e.TTL = ttl
+	}
+	if _, err := json.Marshal(v); err != nil {
+		e.Value = fmt.Sprintf("%+v", v)
+	}
+	reply(w, e)
+}
+
+// trace lists the events recorded for the key given, or for every key,
+// oldest first.
+func (h *Handler) trace(w http.ResponseWriter, r *http.Request) {
+	events := h.cache.Trace(r.URL.Query().Get("key"))
+	if events == nil {
+		events = []memcachedb.TraceEvent{}
+	}
+	reply(w, events)
+}
+
+func (h *Handler) flush(w http.ResponseWriter, r *http.Request) {
+	n := h.cache.FlushPrefix(r.URL.Query().Get("prefix"))
+	reply(w, InvalidateReply{Removed: n})
+}
+
+// invalidate removes the entries of every tag, table and key given.
+func (h *Handler) invalidate(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if len(q["tag"])+len(q["table"])+len(q["key"]) == 0 {
+		http.Error(w, "no tag, table or key given", http.StatusBadRequest)
+		return
+	}
+
+	n := 0
+	for _, tag := range q["tag"] {
+		n += h.cache.InvalidateTag(tag)
+	}
+	if tables := q["table"]; len(tables) > 0 {
+		n += h.cache.InvalidateTables(tables...)
+	}
+	for _, key := range q["key"] {
+		if h.cache.InvalidateKey(key) {
+			n++
+		}
+	}
+
+	reply(w, InvalidateReply{Removed: n})
+}
+
+func (h *Handler) config(w http.ResponseWriter, _ *http.Request) {
+	reply(w, h.cache.Settings())
+}
+
+func (h *Handler) download(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := h.cache.SaveSnapshot(w); err != nil {
+		// The reply is cut short; clients see a truncated snapshot,
+		// which LoadSnapshot rejects.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (h *Handler) save(w http.ResponseWriter, r *http.Request) {
+	if h.snapshot == "" {
+		http.Error(w, "no snapshot file configured", http.StatusNotFound)
+		return
+	}
+	if err := memcachedb.SaveSnapshotFile(h.cache, h.snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reply(w, SnapshotReply{Path: h.snapshot})
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,155 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/admin"
+)
+
+func TestSaveSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := memcachedb.New(nil, memcachedb.WithoutJanitor())
+	defer c.Stop(context.Background())
+	c.Set("user:1", "ann", time.Minute)
+
+	h := admin.NewHandler(c, admin.WithSnapshotFile(path))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/snapshot", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /snapshot = %d %s", rec.Code, rec.Body)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	restored := memcachedb.New(nil, memcachedb.WithoutJanitor())
+	defer restored.Stop(context.Background())
+	if err := restored.LoadSnapshot(f); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := restored.PeekKey("user:1"); !ok || v != "ann" {
+		t.Errorf("PeekKey = %v, %t after restoring the snapshot, want ann", v, ok)
+	}
+}
+
+// do serves a request for target with method on h and decodes the JSON
+// reply into v.
+func do(t *testing.T, h http.Handler, method, target string, v interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	if rec.Code == http.StatusOK && v != nil {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+	}
+
+	return rec.Code
+}
+
+func TestEntry(t *testing.T) {
+	c := memcachedb.New(nil, memcachedb.WithoutJanitor())
+	defer c.Stop(context.Background())
+	c.Set("users/1", "ann", time.Minute)
+	h := admin.NewHandler(c)
+
+	for _, target := range []string{"/entry/users/1", "/entry/" + url.PathEscape("users/1")} {
+		var e admin.EntryReply
+		if code := do(t, h, http.MethodGet, target, &e); code != http.StatusOK {
+			t.Fatalf("GET %s = %d", target, code)
+		}
+		if e.Key != "users/1" || e.Value != "ann" || e.Type != "string" || e.TTL <= 0 {
+			t.Errorf("GET %s = %+v", target, e)
+		}
+	}
+	if code := do(t, h, http.MethodGet, "/entry/users/2", nil); code != http.StatusNotFound {
+		t.Errorf("GET of a missing entry = %d, want 404", code)
+	}
+}
+
+func TestKeysPages(t *testing.T) {
+	c := memcachedb.New(nil, memcachedb.WithoutJanitor())
+	defer c.Stop(context.Background())
+	for i := 0; i < 5; i++ {
+		c.Set(fmt.Sprint("user:", i), i, time.Minute)
+	}
+	c.Set("order:1", 1, time.Minute)
+	h := admin.NewHandler(c)
+
+	var keys []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("more than 3 pages of 2 for 5 keys")
+		}
+		var page admin.KeyPage
+		target := "/keys?pattern=user:*&limit=2&cursor=" + url.QueryEscape(cursor)
+		if code := do(t, h, http.MethodGet, target, &page); code != http.StatusOK {
+			t.Fatalf("GET %s = %d", target, code)
+		}
+		if len(page.Keys) > 2 {
+			t.Errorf("page of %d keys, want at most 2", len(page.Keys))
+		}
+		keys = append(keys, page.Keys...)
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if want := []string{"user:0", "user:1", "user:2", "user:3", "user:4"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %q, want %q", keys, want)
+	}
+
+	for _, target := range []string{"/keys?limit=0", "/keys?limit=x", "/keys?pattern=["} {
+		if code := do(t, h, http.MethodGet, target, nil); code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, code)
+		}
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c := memcachedb.New(nil, memcachedb.WithoutJanitor())
+	defer c.Stop(context.Background())
+	c.Set("a", 1, time.Minute, memcachedb.WithTags("red"))
+	c.Set("b", 2, time.Minute, memcachedb.WithTags("red"))
+	c.Set("c", 3, time.Minute, memcachedb.WithTables("users"))
+	c.Set("d", 4, time.Minute)
+	c.Set("e", 5, time.Minute)
+	h := admin.NewHandler(c)
+
+	var r admin.InvalidateReply
+	if code := do(t, h, http.MethodPost, "/invalidate?tag=red&table=Users&key=d&key=missing", &r); code != http.StatusOK {
+		t.Fatalf("POST /invalidate = %d", code)
+	}
+	if r.Removed != 4 {
+		t.Errorf("removed = %d, want 4", r.Removed)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if _, ok := c.PeekKey(key); ok {
+			t.Errorf("%s cached after POST /invalidate", key)
+		}
+	}
+	if _, ok := c.PeekKey("e"); !ok {
+		t.Error("e removed by POST /invalidate naming others")
+	}
+
+	if code := do(t, h, http.MethodPost, "/invalidate", nil); code != http.StatusBadRequest {
+		t.Errorf("POST /invalidate without names = %d, want 400", code)
+	}
+	if code := do(t, h, http.MethodGet, "/invalidate?key=e", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /invalidate = %d, want 405", code)
+	}
+}
@@ -0,0 +1,295 @@
+package memcachedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// minCompaction is the number of records appended since the last
+// compaction below which the log is never compacted.
+const minCompaction = 1024
+
+type (
+	// appendLog durably records the sets and invalidations of a cache so
+	// that it can be rebuilt after a crash. Each record is a uvarint length
+	// followed by the record encoded on its own with gob, so an entry gob
+	// cannot encode or a torn write at the tail affects that record only.
+	appendLog struct {
+		mu        sync.Mutex
+		path      string
+		f         *os.File
+		w         *bufio.Writer
+		syncEvery time.Duration
+
+		// records counts records appended since the last compaction,
+		// which left live entries in the log.
+		records int
+		live    int
+		// compactions asks the goroutine of openLog to compact the log.
+		compactions chan struct{}
+	}
+
+	logRecord struct {
+		Delete bool
+		Entry  snapshotEntry
+	}
+)
+
+// openLog replays the log at path into c, compacts it and opens it for
+// appending. A goroutine then syncs the log every syncEvery, compacts it when
+// asked to, and closes it once the calls in flight after Stop are done
+// appending.
+func (c *cache) openLog(path string, syncEvery time.Duration) error {
+	if err := c.replayLog(path); err != nil {
+		return err
+	}
+
+	l := &appendLog{path: path, syncEvery: syncEvery, compactions: make(chan struct{}, 1)}
+	if err := l.compact(c); err != nil {
+		return err
+	}
+	c.journal = l
+
+	c.finishing.Add(1)
+	go func() {
+		defer c.finishing.Done()
+
+		var tick <-chan time.Time
+		if syncEvery > 0 {
+			tt := time.NewTicker(syncEvery)
+			defer tt.Stop()
+			tick = tt.C
+		}
+		for {
+			select {
+			case <-tick:
+				if err := l.sync(); err != nil {
+					c.logger.Error("memcachedb: sync append log", "path", path, "error", err)
+				}
+			case <-l.compactions:
+				if err := l.compact(c); err != nil {
+					c.logger.Error("memcachedb: compact append log", "path", path, "error", err)
+				}
+			case <-c.settled:
+				if err := l.close(); err != nil {
+					c.logger.Error("memcachedb: close append log", "path", path, "error", err)
+				}
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// replayLog applies the records of the log at path to c. A truncated or
+// corrupt tail, as a crash mid-write leaves, ends the replay.
+func (c *cache) replayLog(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	now := c.now()
+	for {
+		rec, err := readRecord(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.logger.Warn("memcachedb: append log ends with a damaged record", "path", path, "error", err)
+			}
+			return nil
+		}
+
+		s := c.shard(rec.Entry.Key)
+		switch {
+		case rec.Delete:
+			if old, ok := s.delete(rec.Entry.Key); ok {
+				c.untag(rec.Entry.Key, old.tags)
+			}
+		case rec.Entry.Lifetime > now:
+			c.store(s, rec.Entry.Key, c.restoredEntity(rec.Entry))
+		}
+	}
+}
+
+func readRecord(r *bufio.Reader) (logRecord, error) {
+	var rec logRecord
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return rec, err
+	}
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return rec, err
+	}
+	err = gob.NewDecoder(bytes.NewReader(buf)).Decode(&rec)
+
+	return rec, err
+}
+
+func (l *appendLog) append(rec logRecord) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return ErrStopped
+	}
+	var n [binary.MaxVarintLen64]byte
+	if _, err := l.w.Write(n[:binary.PutUvarint(n[:], uint64(buf.Len()))]); err != nil {
+		return err
+	}
+	if _, err := l.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	l.records++
+	if l.syncEvery <= 0 {
+		return l.syncLocked()
+	}
+
+	return nil
+}
+
+// due reports whether enough records piled up since the last compaction
+// for the log to be mostly dead ones.
+func (l *appendLog) due() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.records >= max(minCompaction, 2*l.live)
+}
+
+// compact rewrites the log to hold one record per live entry of c. Appends
+// wait for it, so none is lost in between.
+func (l *appendLog) compact(c *cache) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	nl := &appendLog{path: l.path, f: f, w: bufio.NewWriter(f)}
+
+	live := 0
+	for _, s := range c.shards {
+		var entries []snapshotEntry
+		s.scan(func(k string, v *Entry) bool {
+			if v.persistable() {
+				entries = append(entries, newSnapshotEntry(k, v))
+			}
+			return true
+		})
+
+		for _, e := range entries {
+			var buf bytes.Buffer
+			if gob.NewEncoder(&buf).Encode(logRecord{Entry: e}) != nil {
+				continue
+			}
+			var n [binary.MaxVarintLen64]byte
+			nl.w.Write(n[:binary.PutUvarint(n[:], uint64(buf.Len()))])
+			nl.w.Write(buf.Bytes())
+			live++
+		}
+	}
+	if err = nl.syncLocked(); err == nil {
+		err = os.Rename(f.Name(), l.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("memcachedb: compact append log: %w", err)
+	}
+
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f, l.w = f, nl.w
+	l.records, l.live = 0, live
+
+	return nil
+}
+
+func (l *appendLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+
+	return l.syncLocked()
+}
+
+func (l *appendLog) syncLocked() error {
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+
+	return l.f.Sync()
+}
+
+func (l *appendLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.syncLocked()
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+
+	return err
+}
+
+// logSet records that v was cached under key.
+func (c *cache) logSet(key string, v *Entry) {
+	if !v.persistable() {
+		// Whatever the log holds for key is no longer cached.
+		c.logDelete(key)
+		return
+	}
+	c.logRecord(logRecord{Entry: newSnapshotEntry(key, v)})
+}
+
+// logDelete records that the entry under key was invalidated.
+func (c *cache) logDelete(key string) {
+	c.logRecord(logRecord{Delete: true, Entry: snapshotEntry{Key: key}})
+}
+
+func (c *cache) logRecord(rec logRecord) {
+	if err := c.journal.append(rec); err != nil {
+		if !errors.Is(err, ErrStopped) {
+			c.logger.Warn("memcachedb: append log record dropped", "key", rec.Entry.Key, "error", err)
+		}
+		return
+	}
+	if c.journal.due() {
+		select {
+		case c.journal.compactions <- struct{}{}:
+		default:
+		}
+	}
+}
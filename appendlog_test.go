@@ -0,0 +1,68 @@
+package memcachedb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendLogKeepsStoresDuringDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	c := New(nil, WithoutJanitor(), WithAppendLog(path, 0))
+	if err := c.Set("early", "early", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	stopDuringLoad(t, c, "late")
+
+	c = New(nil, WithoutJanitor(), WithAppendLog(path, 0))
+	defer c.Stop(context.Background())
+	for _, key := range []string{"early", "late"} {
+		if v, ok := c.PeekKey(key); !ok || v != key {
+			t.Errorf("PeekKey(%q) = %v, %t after replay, want %q", key, v, ok, key)
+		}
+	}
+}
+
+func TestAppendLogCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	c := New(nil, WithoutJanitor(), WithAppendLog(path, time.Hour))
+	for i := 0; i < 4*minCompaction; i++ {
+		if err := c.Set("key", i, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c = New(nil, WithoutJanitor(), WithAppendLog(path, 0))
+	defer c.Stop(context.Background())
+	if v, ok := c.PeekKey("key"); !ok || v != 4*minCompaction-1 {
+		t.Errorf("PeekKey = %v, %t after replay, want %d", v, ok, 4*minCompaction-1)
+	}
+}
+
+func TestAppendLogReplaysDeletes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+
+	c := New(nil, WithoutJanitor(), WithAppendLog(path, 0))
+	if err := c.Set("key", 1, time.Minute, WithTags("t")); err != nil {
+		t.Fatal(err)
+	}
+	c.InvalidateKey("key")
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(nil, WithoutJanitor(), WithAppendLog(path, 0)).(*cache)
+	defer r.Stop(context.Background())
+	if _, ok := r.PeekKey("key"); ok {
+		t.Error("deleted key cached after replay")
+	}
+	if keys := r.tags.keysOf("t"); len(keys) != 0 {
+		t.Errorf("tag index holds %q after replay, want no keys", keys)
+	}
+}
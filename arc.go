@@ -0,0 +1,132 @@
+package memcachedb
+
+import "container/list"
+
+type (
+	// arc is the Adaptive Replacement Cache policy. Resident keys live in t1
+	// (seen once recently) or t2 (seen at least twice); b1 and b2 remember
+	// keys recently evicted from each. A hit on a ghost list grows the
+	// share of the list it came from, so the split between recency and
+	// frequency follows the workload.
+	arc struct {
+		capacity int
+		// p is the target size of t1.
+		p int
+
+		t1, t2, b1, b2 *list.List
+		items          map[string]*arcItem
+	}
+
+	arcItem struct {
+		elem *list.Element
+		list *list.List
+	}
+)
+
+func newARC(capacity int) *arc {
+	return &arc{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		items:    make(map[string]*arcItem),
+	}
+}
+
+func (p *arc) add(key string) {
+	it, ok := p.items[key]
+	switch {
+	case !ok:
+		p.items[key] = &arcItem{elem: p.t1.PushFront(key), list: p.t1}
+	case it.list == p.b1:
+		p.p = min(p.size(), p.p+max(p.b2.Len()/p.b1.Len(), 1))
+		p.move(it, p.t2)
+	case it.list == p.b2:
+		p.p = max(0, p.p-max(p.b1.Len()/p.b2.Len(), 1))
+		p.move(it, p.t2)
+	default:
+		p.touch(key)
+	}
+	p.trimGhosts()
+}
+
+func (p *arc) touch(key string) {
+	it, ok := p.items[key]
+	if !ok {
+		return
+	}
+	switch it.list {
+	case p.t1:
+		p.move(it, p.t2)
+	case p.t2:
+		p.t2.MoveToFront(it.elem)
+	}
+}
+
+func (p *arc) remove(key string) {
+	it, ok := p.items[key]
+	if !ok || (it.list != p.t1 && it.list != p.t2) {
+		return
+	}
+	it.list.Remove(it.elem)
+	delete(p.items, key)
+}
+
+func (p *arc) victim() (string, bool) {
+	key, ok := p.peek()
+	if !ok {
+		return "", false
+	}
+	it := p.items[key]
+	if it.list == p.t1 {
+		p.move(it, p.b1)
+	} else {
+		p.move(it, p.b2)
+	}
+	p.trimGhosts()
+
+	return key, true
+}
+
+func (p *arc) peek() (string, bool) {
+	from := p.t2
+	if p.t1.Len() > 0 && (p.t1.Len() > p.p || p.t2.Len() == 0) {
+		from = p.t1
+	}
+	if e := from.Back(); e != nil {
+		return e.Value.(string), true
+	}
+	return "", false
+}
+
+func (p *arc) move(it *arcItem, to *list.List) {
+	key := it.list.Remove(it.elem).(string)
+	it.elem = to.PushFront(key)
+	it.list = to
+}
+
+// trimGhosts keeps |t1|+|b1| and the size of all four lists within the
+// bounds ARC requires, dropping the oldest ghosts first.
+func (p *arc) trimGhosts() {
+	c := p.size()
+	for p.b1.Len() > 0 && p.t1.Len()+p.b1.Len() > c {
+		p.dropGhost(p.b1)
+	}
+	for p.b2.Len() > 0 && p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*c {
+		p.dropGhost(p.b2)
+	}
+}
+
+// size is the capacity ARC adapts within. Shards bounded by bytes only have
+// no fixed entry count, so the number of resident keys stands in for it.
+func (p *arc) size() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	return p.t1.Len() + p.t2.Len()
+}
+
+func (p *arc) dropGhost(l *list.List) {
+	delete(p.items, l.Remove(l.Back()).(string))
+}
@@ -0,0 +1,164 @@
+package memcachedb
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerWindow is the number of loads a failure rate is
+	// measured over when Breaker.Window is unset.
+	defaultBreakerWindow = 100
+	// defaultBreakerCooldown is how long a circuit stays open when
+	// Breaker.Cooldown is unset.
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+type (
+	// Breaker configures the circuit breaker set by WithCircuitBreaker.
+	// The circuit opens after Failures consecutive failed loads, or once
+	// FailureRate of the last Window loads have failed. While open, loads
+	// fail with ErrCircuitOpen without reaching the database. After
+	// Cooldown one load is let through: the circuit closes if it succeeds
+	// and opens again if it fails.
+	Breaker struct {
+		Failures    int
+		FailureRate float64
+		// Window defaults to 100 loads.
+		Window int
+		// Cooldown defaults to 30s.
+		Cooldown time.Duration
+	}
+
+	// breaker is the state of the circuit of a cache.
+	breaker struct {
+		cfg    Breaker
+		logger *slog.Logger
+
+		mu sync.Mutex
+		// open is set while loads are refused until reopen, or while
+		// probing for the load let through after it.
+		open    bool
+		reopen  time.Time
+		probing bool
+		// streak counts the consecutive failures; outcomes holds the
+		// last Window of them, failed counting the failures among them.
+		streak   int
+		outcomes []bool
+		next     int
+		failed   int
+	}
+)
+
+func newBreaker(cfg Breaker, logger *slog.Logger) *breaker {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultBreakerWindow
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultBreakerCooldown
+	}
+
+	return &breaker{cfg: cfg, logger: logger}
+}
+
+// allow reports whether a load may run. Once the cooldown is over it lets
+// a single probe through until its outcome is recorded.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case !b.open:
+		return true
+	case b.probing || time.Now().Before(b.reopen):
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of a load allow let through.
+func (b *breaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		if !b.probing {
+			// Let through before the circuit opened.
+			return
+		}
+		b.probing = false
+		if failed {
+			b.trip()
+			return
+		}
+		b.reset()
+		b.logger.Info("memcachedb: circuit closed")
+		return
+	}
+
+	if failed {
+		b.streak++
+	} else {
+		b.streak = 0
+	}
+	if b.outcomes == nil {
+		b.outcomes = make([]bool, 0, b.cfg.Window)
+	}
+	if len(b.outcomes) < b.cfg.Window {
+		b.outcomes = append(b.outcomes, failed)
+	} else {
+		if b.outcomes[b.next] {
+			b.failed--
+		}
+		b.outcomes[b.next] = failed
+		b.next = (b.next + 1) % b.cfg.Window
+	}
+	if failed {
+		b.failed++
+	}
+
+	if (b.cfg.Failures > 0 && b.streak >= b.cfg.Failures) ||
+		(b.cfg.FailureRate > 0 && len(b.outcomes) == b.cfg.Window &&
+			float64(b.failed) >= b.cfg.FailureRate*float64(b.cfg.Window)) {
+		b.trip()
+		b.logger.Warn("memcachedb: circuit opened", "cooldown", b.cfg.Cooldown)
+	}
+}
+
+// release gives up the probe of a load whose outcome says nothing of the
+// database, as when its caller went away.
+func (b *breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		b.probing = false
+	}
+}
+
+// trip opens the circuit for the cooldown. The caller holds b.mu.
+func (b *breaker) trip() {
+	b.open = true
+	b.reopen = time.Now().Add(b.cfg.Cooldown)
+}
+
+// reset closes the circuit and forgets past outcomes. The caller holds
+// b.mu.
+func (b *breaker) reset() {
+	b.open = false
+	b.streak = 0
+	b.outcomes = b.outcomes[:0]
+	b.next = 0
+	b.failed = 0
+}
@@ -1,153 +1,1105 @@
-package main
+// Package memcachedb provides an in-process, read-through cache for
+// database query results.
+//
+// A Cache keys every result by a hash of the arguments passed to the query
+// function and keeps it for a fixed TTL. An expired entry is never served:
+// the call finding it treats it as missing, and a background janitor
+// removes the ones nobody asks for.
+package memcachedb
 
 import (
+	"bytes"
 	"context"
-	"crypto"
-	"fmt"
+	"database/sql"
+	"errors"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"io"
+	"log/slog"
+	"math/rand/v2"
 	"reflect"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// keyBuffers holds the buffers arguments are encoded into for hashing.
+var keyBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
 type (
+	// Cache caches the results of database queries.
 	Cache interface {
+		// Start launches the janitor that removes outdated entries every
+		// WithCleanupInterval, or every TTL by default. It runs until ctx
+		// is done. New calls Start itself, unless WithoutJanitor is set.
 		Start(ctx context.Context)
+		// SweepExpired removes the entries past their lifetime, and those
+		// left unread past WithMaxIdle, as a sweep of the janitor does,
+		// and returns how many it removed. Under WithoutJanitor it is how
+		// such entries leave the cache.
+		SweepExpired() int
+		// DoContext returns the cached result for args, calling query with
+		// ctx and args only when no entry exists yet. CallOption values
+		// among args apply to this call only. Arguments are keyed by
+		// value: pointers by what they point to and maps regardless of
+		// order. Functions, channels and values holding them cannot be
+		// keyed and fail the call with ErrKeyEncoding. Concurrent calls
+		// for the same entry share one query, run with the values of
+		// their ctx but none of its deadline; a call whose ctx is done
+		// first returns ctx.Err(), and the query is cancelled once no
+		// call is left waiting for it. Results of cancelled queries are
+		// never cached. A failed query returns a *LoadError wrapping its
+		// error, so errors.Is and errors.As still find sql.ErrNoRows or
+		// the driver's error; a query that panics fails with a
+		// *PanicError. The query may pick the TTL of its result with
+		// SetTTL.
 		DoContext(
 			ctx context.Context,
 			query func(ctx context.Context, args ...interface{}) (interface{}, error),
 			args ...interface{}) (interface{}, error)
+		// Do is DoContext for queries that take no context.
 		Do(query func(args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error)
-		hash(objs ...interface{}) (string, error)
-		getOutdatedCache() []string
-		flush(keys []string)
+		// DoKeyed is DoContext for a result cached under key as given
+		// rather than under a hash of arguments, so that it can be
+		// invalidated and inspected by a stable, readable key such as
+		// "user:42:orders". Pick keys that cannot be mistaken for the
+		// hexadecimal keys of hashed calls.
+		DoKeyed(ctx context.Context, key string, loader func(ctx context.Context) (interface{}, error), opts ...CallOption) (interface{}, error)
+		// Key returns the key under which the result for args, as they
+		// would be passed to DoContext or Do, is cached.
+		Key(args ...interface{}) (string, error)
+		// Set caches value under key for ttl, or for the cache TTL when ttl
+		// is not positive, replacing any entry already there. Use it to seed
+		// the cache with data known to be fresh, with Key giving the key of
+		// a query. WithTags and WithTables among opts apply as in
+		// DoContext.
+		Set(key string, value interface{}, ttl time.Duration, opts ...CallOption) error
+		// Peek returns the value cached for args, as they would be passed to
+		// DoContext or Do, without ever running a query. Cached errors are
+		// reported as missing entries. Peeking does not count as an access
+		// for eviction.
+		Peek(args ...interface{}) (interface{}, bool)
+		// PeekKey is Peek for the entry cached under key.
+		PeekKey(key string) (interface{}, bool)
+		// TTL returns how long the entry cached under key has left before
+		// it expires, or under WithStaleWhileRevalidate before it turns
+		// stale, and reports whether there is such an entry. A call may
+		// refresh an entry close to its end with ForceRefresh.
+		TTL(key string) (time.Duration, bool)
+		// Inspect describes the entry cached under key, without counting
+		// a hit, and reports whether there is one that has not expired.
+		Inspect(key string) (EntryInfo, bool)
+		// Range calls fn for every entry that has not expired, in no
+		// particular order, until fn returns false. Entries cached or
+		// removed meanwhile may or may not be seen, but none is seen
+		// twice. The hits of the entries do not count.
+		Range(fn func(key string, info EntryInfo) bool)
+		// Keys returns, in order, up to limit keys of the cached entries
+		// that match the glob pattern, as path.Match reads it, starting
+		// after cursor: empty for the first page, and the next returned
+		// with the previous page otherwise, empty after the last. An
+		// empty pattern matches every key and a limit that is not
+		// positive returns every match at once. A malformed pattern
+		// fails with path.ErrBadPattern. Entries cached or removed
+		// between pages may or may not be seen.
+		//
+		//	for cursor := ""; ; {
+		//		keys, next, err := c.Keys("user:*", 1000, cursor)
+		//		...
+		//		if next == "" {
+		//			break
+		//		}
+		//		cursor = next
+		//	}
+		Keys(pattern string, limit int, cursor string) (keys []string, next string, err error)
+		// Invalidate removes the entry cached for args, as they would be
+		// passed to DoContext or Do.
+		Invalidate(args ...interface{}) error
+		// InvalidateKey removes the entry cached under key and reports
+		// whether there was one.
+		InvalidateKey(key string) bool
+		// InvalidateWhere removes every entry for which match returns true
+		// and returns how many were removed.
+		InvalidateWhere(match func(key string, value interface{}) bool) int
+		// FlushAll removes every entry and returns how many were removed.
+		// The entries are removed from the L2 tier set by WithL2 too:
+		// all of them if it is a FlushingTier, only those this process
+		// holds otherwise. Other processes of the peer group keep theirs.
+		FlushAll() int
+		// FlushPrefix is FlushAll for the entries whose key starts with
+		// prefix: those of a namespace, with "name:", of the rows of a
+		// table, with "row:table:", or cached by DoKeyed under keys the
+		// caller chose. Hashed keys share no prefix worth flushing by.
+		FlushPrefix(prefix string) int
+		// InvalidateTag removes every entry cached with tag by WithTags and
+		// returns how many were removed.
+		InvalidateTag(tag string) int
+		// InvalidateTables removes every entry whose query reads one of
+		// tables, as declared with WithTables, and returns how many were
+		// removed. Call it after writing to those tables.
+		InvalidateTables(tables ...string) int
+		// GetContext is sqlx.DB.GetContext through the cache: it scans the
+		// row query returns into dest and caches it under the query text
+		// and args, setting dest from the cache on later calls. CallOption
+		// values among args apply as in DoContext. Call sites scanning into
+		// different types get entries of their own. dest shares the cached
+		// value unless WithCopyOnReturn is set. The tables named by the
+		// FROM and JOIN clauses of query are declared as by WithTables,
+		// so that ExecContext and InvalidateTables on them remove the
+		// entry.
+		GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+		// SelectContext is GetContext for sqlx.DB.SelectContext, scanning
+		// every row query returns into the slice dest points to.
+		SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+		// QueryContext is SelectContext for rows of any shape, each
+		// returned as a map of column names to the values the driver
+		// scanned, as sqlx.Rows.MapScan does. The rows are shared with
+		// the cache unless WithCopyOnReturn is set.
+		QueryContext(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error)
+		// NamedGetContext is GetContext for a query with named
+		// parameters, such as "WHERE id = :id", bound from the fields or
+		// keys of arg as sqlx.Named does. The entry is keyed by the bound
+		// values rather than by arg, so args of different types binding
+		// the same values share it.
+		NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}, opts ...CallOption) error
+		// NamedSelectContext is NamedGetContext for SelectContext.
+		NamedSelectContext(ctx context.Context, dest interface{}, query string, arg interface{}, opts ...CallOption) error
+		// ExecContext runs a statement against the database and, once it
+		// succeeds, invalidates the entries of the tables it writes to.
+		// Those are found by parsing the INSERT, UPDATE, DELETE, MERGE,
+		// REPLACE or TRUNCATE statements in query; WithTables, WithTags
+		// and WithRows among args name further tables, tags and rows to
+		// invalidate. The rows GetRowContext cached for a table named by
+		// WithRows are left out of its table-wide invalidation, so that
+		// only the named ones are removed.
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+		// GetRowContext scans the row of table whose primary key column
+		// equals pk into dest, as "SELECT * FROM table WHERE column = pk",
+		// and caches it by table and primary key rather than by query.
+		// Row entries are tagged with their table, so that the writes to
+		// it seen by ExecContext, InvalidateTables and the change feeds
+		// of pgnotify, mysqlbinlog and cdc reach them; a write naming its
+		// rows with WithRows, and InvalidateRows, remove single rows. table and column are put
+		// into the query as they are and must not come from users.
+		GetRowContext(ctx context.Context, dest interface{}, table, column string, pk interface{}, opts ...CallOption) error
+		// SelectRowsContext fills the slice of structs dest points to with
+		// the rows of table whose primary key column is among pks, in the
+		// order of pks, leaving out those with no row. Rows cached by
+		// GetRowContext or an earlier SelectRowsContext are served from
+		// the cache; the others are loaded with a single IN query and
+		// cached one by one. WithResultLimit applies to the rows loaded
+		// together and to each of them.
+		SelectRowsContext(ctx context.Context, dest interface{}, table, column string, pks []interface{}, opts ...CallOption) error
+		// InvalidateRows removes the rows of table cached under pks by
+		// GetRowContext and SelectRowsContext and returns how many were
+		// removed.
+		InvalidateRows(table string, pks ...interface{}) int
+		// DoMulti serves a batch of calls, answering hits from the cache and
+		// running the queries of the misses, up to the limit set by
+		// WithBatchConcurrency at once. Failed loads fall back to stale
+		// entries as those of DoContext do. Results line up with requests
+		// and carry per-request errors; the error returned is ErrStopped
+		// or that of ctx.
+		DoMulti(ctx context.Context, requests []Request) ([]Result, error)
+		// Warm runs specs to fill the cache before it takes traffic, up to
+		// the limit set by WithWarmConcurrency at once, and reports each
+		// finished spec to the WithWarmProgress callback. It returns the
+		// errors of the failed specs joined together.
+		Warm(ctx context.Context, specs []WarmSpec) error
+		// SaveSnapshot writes the cached entries to w with encoding/gob, so
+		// that LoadSnapshot can restore them after a restart. The concrete
+		// types of cached values must be registered with gob.Register;
+		// entries gob cannot encode, cached errors and empty results are
+		// left out.
+		SaveSnapshot(w io.Writer) error
+		// LoadSnapshot restores the entries saved by SaveSnapshot that have
+		// not expired since, keeping entries already cached under the same
+		// keys.
+		LoadSnapshot(r io.Reader) error
+		// Namespace returns a view of the cache whose keys live apart from
+		// those of other namespaces, under the prefix name+":". opts are
+		// applied to every call made through the view before the options
+		// of the call itself, so that WithTTL sets the TTL default of the
+		// namespace. Views of the same name share their statistics.
+		Namespace(name string, opts ...CallOption) *Namespace
+		// WithTx returns a view of the cache for the work of tx. Reads
+		// through it run in tx and bypass the cache, to keep the isolation
+		// of the transaction; invalidations through it, including those of
+		// its ExecContext, wait for Commit and are dropped by Rollback.
+		WithTx(tx *sqlx.Tx) *Tx
+		// Local returns the side of the cache that serves the other
+		// processes of its peer group, for a transport to expose. It acts
+		// on the entries of this process alone, never consulting the
+		// PeerPicker set by WithPeers.
+		Local() Peer
+		// Stats returns a snapshot of the cache counters.
+		Stats() Stats
+		// TopPatterns returns the counters of the n query patterns ranking
+		// first by, or of every pattern if n is not positive, as tracked
+		// by WithPatternStats; nil without it. A call counts under its
+		// SQL, the table of its rows or the name of its query function,
+		// unless named otherwise with Pattern.
+		TopPatterns(n int, by PatternOrder) []PatternStats
+		// Trace returns the events recorded for key by WithKeyTrace, or
+		// for every key if key is empty, oldest first; nil without it.
+		Trace(key string) []TraceEvent
+		// Settings describes the configuration of the cache, as
+		// published by WithExpvar.
+		Settings() map[string]any
+		// UpdateConfig applies cfg to the running cache, keeping the
+		// cached entries: its TTL, jitter, negative caching TTL and slow
+		// load threshold apply to entries cached from then on, and its
+		// bounds, eviction policy and TinyLFU setting take effect at once,
+		// evicting what no longer fits. A janitor sweeping every TTL
+		// moves to the new one. Zero fields reset to the defaults
+		// of New. The other fields, which shape how entries are stored,
+		// as well as namespace configurations, only apply to a new cache.
+		// A cfg failing Validate, or bounding the cache to fewer entries
+		// or bytes than it has shards, changes nothing. To reload on
+		// SIGHUP:
+		//
+		//	sig := make(chan os.Signal, 1)
+		//	signal.Notify(sig, syscall.SIGHUP)
+		//	for range sig {
+		//		cfg, err := loadConfig()
+		//		if err == nil {
+		//			err = c.UpdateConfig(cfg)
+		//		}
+		//		...
+		//	}
+		UpdateConfig(cfg Config) error
+		// Stop halts the janitor and puts the cache in a terminal state in
+		// which every call fails with ErrStopped. It then waits for
+		// in-flight calls to finish, and then for the last snapshot of
+		// WithSnapshot and the close of WithAppendLog, or for ctx to be
+		// done, whichever comes first; pass an already cancelled ctx to
+		// skip draining. The result is ctx.Err() when the drain was cut
+		// short.
+		Stop(ctx context.Context) error
 	}
 
+	// Option configures a Cache created by New.
+	Option func(c *cache)
+
 	cache struct {
-		db  *sqlx.DB
-		ttl time.Duration
+		db *sqlx.DB
+		// settings are those set by the options; live holds them once
+		// the cache is created, as UpdateConfig replaces them.
+		settings
+		live     atomic.Pointer[settings]
+		reloadMu sync.Mutex
+		// ctx bounds the janitor, as set by WithContext. rearm, guarded
+		// by reloadMu, is closed when UpdateConfig changes the interval
+		// between its sweeps.
+		ctx   context.Context
+		rearm chan struct{}
+
+		cleanupInterval time.Duration
+		noJanitor       bool
+
+		shardCount int
+		cost       func(key string, value interface{}) int64
+		pressure   *MemoryPressure
+		stmtCount  int
+		stmts      *stmtCache
+
+		backend Store
+		// shards are all the segments of the cache. routing holds those
+		// of keys outside the namespaces routes gives storage of their
+		// own.
+		shards   []segment
+		routing  []segment
+		routes   map[string][]segment
+		profiles map[string]NamespaceConfig
+		flight   flightGroup
+		tags     tagIndex
+		expiries expiryQueue
+		l2       Tier
+		peers    PeerPicker
+
+		namespaces sync.Map
+		patterns   *patterns
+		// keyTrace records the events of keys, as set by WithKeyTrace
+		// with traceSize and traceMatch.
+		keyTrace   *keyTrace
+		traceSize  int
+		traceMatch func(key string) bool
+
+		hasher Hasher
+		clock  Clock
+
+		codec       Codec
+		clone       func(v interface{}) interface{}
+		compression Compression
+		compressMin int64
+
+		mutationCheck  bool
+		mutationPanics bool
+
+		stats      counters
+		tracer     trace.Tracer
+		expvarName string
+		logger     *slog.Logger
+		onEvict    func(key string, value interface{}, reason Reason)
+
+		loaderTimeout  time.Duration
+		staleOnTimeout bool
+		staleOnError   bool
+		onStale        func(key string, err error)
+		breakerCfg     *Breaker
+		breaker        *breaker
+		loadInterval   time.Duration
+		throttle       *throttle
+		hedging        *Hedging
+		adaptiveCfg    *AdaptiveTTL
+		adaptive       *adaptive
+
+		errorPolicy  ErrorPolicy
+		retry        RetryPolicy
+		staleFor     time.Duration
+		sliding      bool
+		maxLifetime  time.Duration
+		maxIdle      time.Duration
+		refreshAhead float64
+		maxRefreshes int
+		refreshes    chan struct{}
 
-		mu sync.RWMutex
+		batchConcurrency int
+		warmConcurrency  int
+		warmProgress     func(p WarmProgress)
 
-		data map[string]*cacheEntity
+		snapshotPath     string
+		snapshotInterval time.Duration
+		logPath          string
+		logSyncEvery     time.Duration
+		journal          *appendLog
+
+		// active counts the calls in flight, or'ed with stopping once
+		// the cache is stopped. settled is closed when the last of them
+		// ends after Stop, and drained once the background work counted
+		// by finishing, such as the last snapshot, is done as well.
+		active    atomic.Int64
+		draining  atomic.Bool
+		stop      chan struct{}
+		settled   chan struct{}
+		drained   chan struct{}
+		finishing sync.WaitGroup
+	}
+
+	// Entry is a cached result as held by a Store.
+	Entry struct {
+		// lifetime is when the entry expires. fresh, if set, is the
+		// earlier moment from which it is served stale while refreshed.
+		// refreshAt, if set, is when a hit starts refreshing it ahead of
+		// time.
+		lifetime  int64
+		fresh     int64
+		refreshAt int64
+		value     interface{}
+		// err is returned with value on hits; negative marks an empty
+		// result cached as such.
+		err      error
+		negative bool
+		size     int64
+		tags     []string
+		// packed, if set, holds value encoded with codec and compressed
+		// with packing, if at all, in place of value, a value of typ.
+		packed  []byte
+		codec   Codec
+		packing Compression
+		typ     reflect.Type
+		// checksum, if set, is that of value when it was cached.
+		checksum uint64
+		// fingerprint identifies the arguments the entry was loaded
+		// for, telling them apart from others hashing to the same key.
+		fingerprint uint64
+		// loadTime, if set, is how long the query of the entry took, the
+		// database time each hit on it saves.
+		loadTime time.Duration
+		// slide, if set, is how long the entry lives from its last hit,
+		// as set by WithSlidingTTL. deadline, if set, is when it
+		// expires all the same.
+		slide    int64
+		deadline int64
+		// created is when the entry was cached. usage, if set, counts
+		// its hits; copies of the entry share it.
+		created int64
+		usage   *usage
 	}
 
-	cacheEntity struct {
-		lifetime int64
-		value    interface{}
+	// usage counts the hits of an entry and tells when the last one was,
+	// or when the entry was cached if it was never hit.
+	usage struct {
+		hits     atomic.Uint64
+		accessed atomic.Int64
 	}
 )
 
-func NewCache(ctx context.Context, db *sqlx.DB, ttl time.Duration) Cache {
+// defaultTTL is the TTL of a Cache created without WithDefaultTTL.
+const defaultTTL = 5 * time.Minute
+
+// NewCache returns a Cache whose entries live for ttl. The janitor is started
+// right away and stops when ctx is done.
+//
+// Deprecated: Use New with WithDefaultTTL and WithContext.
+func NewCache(ctx context.Context, db *sqlx.DB, ttl time.Duration, opts ...Option) Cache {
+	return New(db, append([]Option{WithDefaultTTL(ttl), WithContext(ctx)}, opts...)...)
+}
+
+// New returns a Cache of the results of queries against db, configured by
+// opts. db may be nil for a cache only serving DoContext and its variants.
+// Entries live for WithDefaultTTL, five minutes unless set. The janitor is
+// started right away and runs until Stop, or until the context set by
+// WithContext is done.
+func New(db *sqlx.DB, opts ...Option) Cache {
 	c := &cache{
-		db:   db,
-		ttl:  ttl,
-		data: make(map[string]*cacheEntity),
+		db:       db,
+		settings: settings{ttl: defaultTTL},
+		ctx:      context.Background(),
+		hasher:   XXHash,
+		clock:    SystemClock,
+		tracer:   noop.NewTracerProvider().Tracer(tracerName),
+		logger:   slog.New(discardHandler{}),
+		stop:     make(chan struct{}),
+		settled:  make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	live := c.settings
+	c.live.Store(&live)
+	// Shared loads outlive the calls that started them; they count as
+	// calls of their own, so that Stop waits for them.
+	c.flight.onStart = func() { c.active.Add(1) }
+	c.flight.onDone = c.end
+	if c.backend != nil {
+		c.shards = []segment{c.storeSegment()}
+	} else {
+		c.shards = c.newShards(c.maxEntries, c.maxBytes, c.eviction)
+	}
+	c.routing = c.shards[:len(c.shards):len(c.shards)]
+	if c.backend == nil {
+		c.routeNamespaces()
+	}
+	if c.staleFor > 0 || c.refreshAhead > 0 {
+		if c.maxRefreshes <= 0 {
+			c.maxRefreshes = defaultMaxRefreshes
+		}
+		c.refreshes = make(chan struct{}, c.maxRefreshes)
+	}
+	if c.adaptiveCfg != nil {
+		c.adaptive = newAdaptive(*c.adaptiveCfg)
+	}
+	if c.traceSize > 0 {
+		c.keyTrace = newKeyTrace(c.traceSize, c.traceMatch, c.clock)
+	}
+	if c.loadInterval > 0 {
+		c.throttle = newThrottle(c.loadInterval)
+	}
+	if c.breakerCfg != nil {
+		c.breaker = newBreaker(*c.breakerCfg, c.logger)
+	}
+	if c.expvarName != "" {
+		c.publish(c.expvarName)
+	}
+	if c.pressure != nil {
+		c.watchPressure(*c.pressure)
+	}
+	if c.stmtCount > 0 && db != nil {
+		c.stmts = newStmtCache(c.stmtCount, &c.stats)
+	}
+	if c.logPath != "" {
+		if err := c.openLog(c.logPath, c.logSyncEvery); err != nil {
+			c.logger.Error("memcachedb: open append log", "path", c.logPath, "error", err)
+		}
+	}
+	if c.snapshotPath != "" {
+		c.restoreSnapshot(c.snapshotPath)
+		if c.snapshotInterval > 0 {
+			c.snapshotLoop(c.snapshotPath, c.snapshotInterval)
+		}
+	}
+	if !c.noJanitor {
+		c.Start(c.ctx)
 	}
-	c.Start(ctx)
 
 	return c
 }
 
 func (c *cache) Start(ctx context.Context) {
-	tt := time.NewTicker(c.ttl)
+	rearm := c.rearmed()
+	tt := c.clock.NewTicker(c.cleanupEvery())
 	go func() {
+		defer func() { tt.Stop() }()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-tt.C:
-				keys := c.getOutdatedCache()
-				c.flush(keys)
+			case <-c.stop:
+				return
+			case <-tt.C():
+				c.sweep()
+			case <-rearm:
+				tt.Stop()
+				rearm = c.rearmed()
+				tt = c.clock.NewTicker(c.cleanupEvery())
 			}
 		}
 	}()
 }
 
+// rearmed returns the channel closed the next time the interval between
+// janitor sweeps changes.
+func (c *cache) rearmed() <-chan struct{} {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	if c.rearm == nil {
+		c.rearm = make(chan struct{})
+	}
+	return c.rearm
+}
+
+func (c *cache) SweepExpired() int {
+	if !c.begin() {
+		return 0
+	}
+	defer c.end()
+
+	return c.sweep()
+}
+
+// cleanupEvery returns the interval between janitor sweeps.
+func (c *cache) cleanupEvery() time.Duration {
+	if c.cleanupInterval > 0 {
+		return c.cleanupInterval
+	}
+	if ttl := c.cur().ttl; c.maxIdle <= 0 || ttl < c.maxIdle {
+		return ttl
+	}
+
+	return c.maxIdle
+}
+
 func (c *cache) DoContext(ctx context.Context, query func(ctx context.Context, args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
-	h, err := c.hash(args)
+	args, o := c.splitArgs(args)
+	h, fp, err := c.hash(args...)
+	if err != nil {
+		return nil, err
+	}
+	o.fingerprint = fp
+	c.trackPattern(&o, c.funcPattern(query))
+
+	return c.load(ctx, h, o, func(ctx context.Context) (interface{}, error) {
+		return query(ctx, args...)
+	})
+}
+
+func (c *cache) Do(query func(args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
+	args, o := c.splitArgs(args)
+	h, fp, err := c.hash(args...)
 	if err != nil {
 		return nil, err
 	}
+	o.fingerprint = fp
+	c.trackPattern(&o, c.funcPattern(query))
+
+	return c.load(context.Background(), h, o, func(context.Context) (interface{}, error) {
+		return query(args...)
+	})
+}
+
+func (c *cache) DoKeyed(ctx context.Context, key string, loader func(ctx context.Context) (interface{}, error), opts ...CallOption) (interface{}, error) {
+	o := callOptions{ttl: c.cur().ttl}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c.trackPattern(&o, c.funcPattern(loader))
 
-	v, ok := c.data[h]
-	if !ok {
-		var nv interface{}
-		if nv, err = query(ctx, args); err != nil {
-			return nil, err
+	return c.load(ctx, key, o, loader)
+}
+
+func (c *cache) load(ctx context.Context, key string, o callOptions, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if !c.begin() {
+		return nil, ErrStopped
+	}
+	defer c.end()
+
+	ctx, span := c.tracer.Start(ctx, "memcachedb.Do", trace.WithAttributes(attrKey.String(key)))
+	defer span.End()
+
+	s := c.shard(key)
+	// Looked up before hit, which drops the entry once expired.
+	prev := c.previous(s, key)
+	if !o.force {
+		if v, err, ok := c.hit(ctx, s, key, o, query); ok {
+			return v, err
 		}
+	}
+	v, err := c.missOrStale(ctx, s, key, prev, o, query)
+	if err != nil {
+		recordError(span, err)
+	}
+
+	return v, err
+}
+
+// previous returns the entry under key in s, for missOrStale to fall back
+// to, if the cache may serve stale values.
+func (c *cache) previous(s segment, key string) *Entry {
+	if !c.staleOnTimeout && !c.staleOnError && c.breaker == nil {
+		return nil
+	}
+	prev, _ := s.lookup(key)
 
-		c.data[h] = &cacheEntity{
-			lifetime: time.Now().Add(c.ttl).Unix(),
-			value:    nv,
+	return prev
+}
+
+// missOrStale is miss, falling back to prev, the entry key held before the
+// call, when the load fails in a way that serves stale values.
+func (c *cache) missOrStale(ctx context.Context, s segment, key string, prev *Entry, o callOptions, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	v, err := c.miss(ctx, s, key, o, query)
+	if err != nil && prev != nil && ctx.Err() == nil && c.servesStale(err) {
+		if v, ok := c.fallback(ctx, key, prev, o, err); ok {
+			return v, nil
 		}
+	}
+
+	return v, err
+}
 
-		return nv, nil
+// hit serves key from s if it is cached.
+func (c *cache) hit(ctx context.Context, s segment, key string, o callOptions, query func(ctx context.Context) (interface{}, error)) (v interface{}, err error, ok bool) {
+	e, ok := s.get(key)
+	if !ok || c.expired(s, key, e) || c.idle(s, key, e) {
+		return nil, nil, false
+	}
+	if !e.matches(o.fingerprint) {
+		c.stats.collisions.Add(1)
+		return nil, nil, false
+	}
+	c.checkMutation(key, e)
+	c.touch(s, key, e)
+	if e.usage != nil {
+		e.usage.hits.Add(1)
+		e.usage.accessed.Store(c.now())
+	}
+	value, err := e.load()
+	if err != nil {
+		c.logger.ErrorContext(ctx, "memcachedb: cached value undecodable", "key", key, "error", err)
+		return nil, nil, false
+	}
+	if e.packed == nil {
+		value = c.isolate(value)
 	}
 
-	return v.value, nil
+	c.stats.hits.Add(1)
+	c.stats.saved(e)
+	if o.ns != nil {
+		o.ns.hits.Add(1)
+	}
+	if o.pat != nil {
+		o.pat.hits.Add(1)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrHit.Bool(true))
+	if c.keyTrace != nil {
+		kind := TraceHit
+		if c.stale(e) {
+			kind = TraceStaleHit
+		}
+		c.keyTrace.record(key, kind, "")
+	}
+	switch {
+	case c.stale(e):
+		c.stats.staleHits.Add(1)
+		c.refresh(ctx, s, key, o, query)
+	case e.refreshAt != 0 && c.now() >= e.refreshAt:
+		c.refresh(ctx, s, key, o, query)
+	}
+	if e.negative {
+		c.stats.negativeHits.Add(1)
+	}
+
+	return value, e.err, true
 }
 
-func (c *cache) Do(query func(args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
-	h, err := c.hash(args)
+// miss loads key into s with query, sharing the load with concurrent
+// callers unless o forces a refresh.
+func (c *cache) miss(ctx context.Context, s segment, key string, o callOptions, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	span := trace.SpanFromContext(ctx)
+	if o.force {
+		// Not coalesced: a load already in flight may predate the write
+		// the caller wants to see.
+		span.SetAttributes(attrForced.Bool(true))
+		c.keyTrace.record(key, TraceMiss, "forced refresh")
+		v, err := c.fetch(ctx, s, key, o, query)
+		return c.isolate(v), err
+	}
+
+	c.stats.misses.Add(1)
+	if o.ns != nil {
+		o.ns.misses.Add(1)
+	}
+	if o.pat != nil {
+		o.pat.misses.Add(1)
+	}
+	c.keyTrace.record(key, TraceMiss, "")
+	span.SetAttributes(attrHit.Bool(false))
+	v, err, shared := c.flight.do(ctx, flightKey(key, o), func(ctx context.Context) (interface{}, error) {
+		// A load that finished just before this one started may have
+		// already filled the entry.
+		if e, ok := s.lookup(key); ok && !c.expired(s, key, e) && !c.stale(e) && e.matches(o.fingerprint) {
+			return e.Value(), e.err
+		}
+
+		return c.fetch(ctx, s, key, o, query)
+	})
+	if shared {
+		c.stats.coalesced.Add(1)
+	}
+
+	return c.isolate(v), err
+}
+
+// fetch runs query and caches its result under key in s.
+func (c *cache) fetch(ctx context.Context, s segment, key string, o callOptions, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ctx, span := c.tracer.Start(ctx, "memcachedb.load")
+	defer span.End()
+
+	owner, remote := c.owner(key)
+	if remote && !o.force {
+		if e, ok := c.tierGet(ctx, owner, key, o); ok {
+			c.stats.peerHits.Add(1)
+			return e.Value(), nil
+		}
+	}
+	if c.l2 != nil && !o.force {
+		if e, ok := c.tierGet(ctx, c.l2, key, o); ok {
+			c.stats.l2Hits.Add(1)
+			c.store(s, key, e)
+			return e.Value(), nil
+		}
+	}
+
+	if v, err, ok := c.throttled(ctx, key, o); ok {
+		return v, err
+	}
+	if !c.breaker.allow() {
+		c.stats.refused.Add(1)
+		return nil, &LoadError{Key: key, Err: ErrCircuitOpen}
+	}
+	c.stats.loads.Add(1)
+	if o.ns != nil {
+		o.ns.loads.Add(1)
+	}
+	start := time.Now()
+	lt := new(loadTTL)
+	v, err := c.attempt(context.WithValue(ctx, loadTTLKey{}, lt), key, query)
+	elapsed := time.Since(start)
+	c.stats.loadLatency.observe(elapsed)
+	if o.pat != nil {
+		o.pat.loads.Add(1)
+		o.pat.loadTime.Add(int64(elapsed))
+	}
+	if slow := c.cur().slowLoad; slow > 0 && elapsed >= slow {
+		c.logger.WarnContext(ctx, "memcachedb: slow load", "key", key, "duration", elapsed)
+	}
+	noRows := errors.Is(err, sql.ErrNoRows)
+	if ctx.Err() != nil {
+		c.breaker.release()
+	} else {
+		c.breaker.record(err != nil && !noRows)
+	}
+	negativeTTL := c.cur().negativeTTL
 	if err != nil {
+		c.stats.loadErrors.Add(1)
+		if o.ns != nil {
+			o.ns.loadErrors.Add(1)
+		}
+		if o.pat != nil {
+			o.pat.loadErrors.Add(1)
+		}
+		recordError(span, err)
+		if c.keyTrace != nil {
+			c.keyTrace.record(key, TraceLoadFailed, err.Error())
+		}
+		if !noRows && ctx.Err() == nil {
+			c.logger.ErrorContext(ctx, "memcachedb: load failed", "key", key, "error", err)
+		}
+	}
+	cacheErr := err != nil && c.errorPolicy.caches(err)
+	if err != nil {
+		err = &LoadError{Key: key, Err: err}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// Cancelled mid-load: the result may be partial.
+		return v, err
+	case negativeTTL > 0 && (noRows || (err == nil && isNil(v))):
+		o.ttl, o.expireAt = negativeTTL, 0
+		e := c.newEntity(key, v, o)
+		e.err = err
+		e.negative = true
+		e.loadTime = elapsed
+		c.store(s, key, e)
+		return v, err
+	case cacheErr:
+		o.ttl, o.expireAt = c.errorPolicy.TTL, 0
+		e := c.newEntity(key, nil, o)
+		e.err = err
+		e.loadTime = elapsed
+		c.store(s, key, e)
+		return nil, err
+	case err != nil:
 		return nil, err
+	case c.oversized(key, v):
+		c.stats.oversized.Add(1)
+		c.discard(s, key)
+		return v, nil
+	}
+	if ttl, ok := lt.get(); ok {
+		if ttl <= 0 {
+			c.discard(s, key)
+			return v, nil
+		}
+		o.ttl, o.expireAt = ttl, 0
+	} else if c.adaptive != nil && o.expireAt == 0 {
+		o.ttl = c.adaptive.ttl(key, o.ttl, v, c.now())
+	}
+	e := c.newEntity(key, v, o)
+	e.loadTime = elapsed
+	if c.tooLarge(key, e) {
+		c.stats.rejected.Add(1)
+		c.discard(s, key)
+		c.logger.WarnContext(ctx, "memcachedb: value too large to cache", "key", key)
+		return v, ErrValueTooLarge
+	}
+	if remote {
+		c.tierSet(ctx, owner, key, e)
+	} else {
+		c.store(s, key, e)
+	}
+	if c.l2 != nil {
+		c.tierSet(ctx, c.l2, key, e)
+	}
+	if c.throttle != nil {
+		c.throttle.loaded(key, e)
+	}
+
+	return v, nil
+}
+
+// call runs query, turning a panic into a PanicError. Under
+// WithLoaderTimeout it returns a TimeoutError once the timeout elapses,
+// leaving behind a query that ignores the cancellation of its context.
+func (c *cache) call(ctx context.Context, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	timeout := c.loaderTimeout
+	if timeout <= 0 {
+		return c.hedged(ctx, query)
+	}
+
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		v   interface{}
+		err error
 	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := c.hedged(qctx, query)
+		done <- result{v, err}
+	}()
 
-	v, ok := c.data[h]
-	if !ok {
-		var nv interface{}
-		if nv, err = query(args); err != nil {
-			return nil, err
+	select {
+	case r := <-done:
+		if r.err == nil || ctx.Err() != nil || qctx.Err() != context.DeadlineExceeded {
+			return r.v, r.err
+		}
+	case <-qctx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+	}
+	c.stats.timeouts.Add(1)
 
-		c.data[h] = &cacheEntity{
-			lifetime: time.Now().Add(c.ttl).Unix(),
-			value:    nv,
+	return nil, &TimeoutError{After: timeout}
+}
+
+// run runs query, turning a panic into a PanicError.
+func (c *cache) run(ctx context.Context, query func(ctx context.Context) (interface{}, error)) (v interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &PanicError{Value: p, Stack: debug.Stack()}
 		}
+	}()
+
+	return query(ctx)
+}
 
-		return nv, nil
+// newEntity wraps value for caching under key.
+func (c *cache) newEntity(key string, value interface{}, o callOptions) *Entry {
+	now := c.now()
+	fresh := o.expireAt
+	if fresh == 0 {
+		fresh = c.expiry(o.ttl)
+	}
+	e := &Entry{
+		lifetime:    fresh,
+		value:       value,
+		size:        c.sizeOf(key, value),
+		tags:        o.tags,
+		fingerprint: o.fingerprint,
+	}
+	c.pack(key, e)
+	c.seal(e)
+	if c.staleFor > 0 {
+		e.fresh = fresh
+		e.lifetime = fresh + int64(c.staleFor)
+	}
+	if c.refreshAhead > 0 {
+		e.refreshAt = now + int64(c.refreshAhead*float64(fresh-now))
+	}
+	e.created = now
+	e.usage = newUsage(now)
+	if c.sliding && o.expireAt == 0 {
+		e.slide = e.lifetime - now
+		if c.maxLifetime > 0 {
+			e.deadline = now + int64(c.maxLifetime)
+			e.lifetime = min(e.lifetime, e.deadline)
+		}
 	}
 
-	return v.value, nil
+	return e
 }
 
-func (c *cache) hash(objs ...interface{}) (string, error) {
-	var (
-		digester = crypto.MD5.New()
-		err      error
-	)
-	for _, ob := range objs {
-		if _, err = fmt.Fprint(digester, reflect.TypeOf(ob)); err != nil {
-			return "", err
-		}
-		if _, err = fmt.Fprint(digester, ob); err != nil {
-			return "", err
+// store caches v under key in s, keeping the tag index in step.
+func (c *cache) store(s segment, key string, v *Entry) {
+	// Index first so that a concurrent removal of the new entry finds
+	// its tags.
+	c.tags.add(key, v.tags)
+	stored, old, evicted := s.set(key, v)
+	switch {
+	case !stored:
+		c.untag(key, tagsMissing(v, old))
+		c.keyTrace.record(key, TraceRejected, "")
+	case old != nil:
+		c.untag(key, tagsMissing(old, v))
+		c.keyTrace.record(key, TraceReplaced, "")
+	default:
+		c.keyTrace.record(key, TraceCreated, "")
+	}
+	if stored {
+		c.expiries.push(key, v.lifetime)
+		if c.journal != nil {
+			c.logSet(key, v)
 		}
 	}
+	c.evicted(evicted)
+}
+
+// expiry returns the expiration time of an entry cached now for ttl, with
+// the configured jitter applied.
+func (c *cache) expiry(ttl time.Duration) int64 {
+	if jitter := c.cur().jitter; jitter > 0 {
+		ttl += time.Duration((rand.Float64()*2 - 1) * jitter * float64(ttl))
+	}
 
-	return fmt.Sprintf("%x\n", digester.Sum(nil)), nil
+	return c.now() + int64(ttl)
 }
 
-func (c *cache) getOutdatedCache() []string {
-	defer c.mu.Unlock()
-	c.mu.Lock()
+// sizeOf returns the cost of caching value under key. It is only computed
+// when the cache has a byte budget.
+func (c *cache) sizeOf(key string, value interface{}) int64 {
+	if c.cur().maxBytes <= 0 {
+		return 0
+	}
+	if c.cost != nil {
+		return c.cost(key, value)
+	}
+
+	return int64(len(key)) + estimateSize(value)
+}
+
+// hash returns the key of objs along with their fingerprint, which comes
+// from a hash independent of the key hasher.
+func (c *cache) hash(objs ...interface{}) (string, uint64, error) {
+	buf := keyBuffers.Get().(*bytes.Buffer)
+	defer keyBuffers.Put(buf)
+	buf.Reset()
 
-	keys := make([]string, 0)
-	for k, v := range c.data {
-		if v.lifetime < time.Now().Unix() {
-			keys = append(keys, k)
+	if err := encodeKey(buf, objs); err != nil {
+		return "", 0, err
+	}
+
+	return c.hasher.Key(buf.Bytes()), fingerprint(buf.Bytes()), nil
+}
+
+// sweep removes the entries whose TTL has passed, returning how many it
+// removed along with the idle ones.
+func (c *cache) sweep() int {
+	start := time.Now()
+	now := c.now()
+	n := 0
+	for _, key := range c.expiries.due(now) {
+		// The entry may have been refreshed since it was queued.
+		if v, ok := c.shard(key).deleteIf(key, func(v *Entry) bool { return v.lifetime < now }); ok {
+			n++
+			c.removed(key, v, ReasonExpired)
 		}
 	}
+	c.stats.expirations.Add(uint64(n))
+	idle := 0
+	if c.maxIdle > 0 {
+		idle = c.sweepIdle(now)
+	}
+	if c.throttle != nil {
+		c.throttle.prune(time.Now().UnixNano())
+	}
+	if c.adaptive != nil {
+		c.adaptive.prune(now)
+	}
+	c.logger.Debug("memcachedb: janitor sweep", "expired", n, "idle", idle, "duration", time.Since(start))
 
-	return keys
+	return n + idle
 }
 
-func (c *cache) flush(keys []string) {
-	defer c.mu.Unlock()
-	c.mu.Lock()
+// expired reports whether e, found under key in s, has outlived its
+// lifetime, removing it if so rather than leaving it to the janitor.
+func (c *cache) expired(s segment, key string, e *Entry) bool {
+	if e.lifetime >= c.now() {
+		return false
+	}
+
+	if v, ok := s.deleteIf(key, e.same); ok {
+		c.stats.expirations.Add(1)
+		c.removed(key, v, ReasonExpired)
+	}
+
+	return true
+}
 
+// evicted reports entries a shard dropped to stay within its bounds.
+func (c *cache) evicted(evicted []eviction) {
+	for _, ev := range evicted {
+		c.logger.Debug("memcachedb: evicted under pressure", "key", ev.key)
+		c.removed(ev.key, ev.value, ReasonEvicted)
+	}
+}
+
+// flush deletes keys for reason and returns how many of them were present.
+func (c *cache) flush(keys []string, reason Reason) int {
+	n := 0
 	for _, key := range keys {
-		delete(c.data, key)
+		if v, ok := c.shard(key).delete(key); ok {
+			n++
+			c.removed(key, v, reason)
+		}
 	}
+
+	return n
 }
@@ -0,0 +1,191 @@
+package memcachedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hammer runs workers calling c concurrently, with a mix of loads, sets,
+// reads and invalidations over keys, until stop is closed.
+func hammer(c Cache, workers, keys int, stop <-chan struct{}) *sync.WaitGroup {
+	query := func(_ context.Context, args ...interface{}) (interface{}, error) {
+		if args[0].(int)%17 == 0 {
+			return nil, errors.New("failed")
+		}
+		return args[0], nil
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(w), 1))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				k := rng.IntN(keys)
+				switch op := rng.IntN(100); {
+				case op < 60:
+					c.DoContext(context.Background(), query, k, WithTags(fmt.Sprint("t", k%4)))
+				case op < 75:
+					c.Set(fmt.Sprint("s", k), k, time.Minute)
+				case op < 85:
+					c.PeekKey(fmt.Sprint("s", k))
+				case op < 90:
+					c.Invalidate(k)
+				case op < 93:
+					c.InvalidateKey(fmt.Sprint("s", k))
+				case op < 95:
+					c.InvalidateTag(fmt.Sprint("t", k%4))
+				case op < 96:
+					c.InvalidateWhere(func(_ string, v interface{}) bool {
+						n, ok := v.(int)
+						return ok && n%5 == 0
+					})
+				case op < 97:
+					c.SweepExpired()
+				case op < 98:
+					c.Keys("s*", 10, "")
+				default:
+					c.Stats()
+				}
+			}
+		}()
+	}
+
+	return &wg
+}
+
+func TestConcurrent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"unbounded", nil},
+		{"lru", []Option{WithMaxEntries(64), WithEvictionPolicy(EvictLRU)}},
+		{"lfu", []Option{WithMaxEntries(64), WithEvictionPolicy(EvictLFU)}},
+		{"arc", []Option{WithMaxEntries(64), WithEvictionPolicy(EvictARC)}},
+		{"tinylfu", []Option{WithMaxEntries(64), WithTinyLFU()}},
+		{"bytes", []Option{WithMaxBytes(4 << 10)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(nil, append([]Option{WithShards(4), WithCleanupInterval(time.Millisecond)}, tt.opts...)...)
+			defer c.Stop(context.Background())
+
+			stop := make(chan struct{})
+			wg := hammer(c, 8, 256, stop)
+			time.Sleep(200 * time.Millisecond)
+			close(stop)
+			wg.Wait()
+
+			s := c.Stats()
+			if s.Hits+s.Misses == 0 {
+				t.Fatal("no calls counted")
+			}
+			if len(tt.opts) == 0 {
+				return
+			}
+			if s.Evictions == 0 {
+				t.Error("no entry evicted")
+			}
+			if tt.name != "bytes" && s.Entries > 64 {
+				t.Errorf("Entries = %d, want at most 64", s.Entries)
+			}
+		})
+	}
+}
+
+func TestConcurrentStop(t *testing.T) {
+	c := New(nil, WithShards(4), WithMaxEntries(64))
+
+	stop := make(chan struct{})
+	wg := hammer(c, 8, 256, stop)
+	time.Sleep(50 * time.Millisecond)
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	_, err := c.DoContext(context.Background(), func(context.Context, ...interface{}) (interface{}, error) {
+		t.Error("query ran after Stop")
+		return nil, nil
+	}, 1)
+	if !errors.Is(err, ErrStopped) {
+		t.Errorf("DoContext after Stop = %v, want ErrStopped", err)
+	}
+}
+
+func TestStopDrains(t *testing.T) {
+	c := New(nil, WithoutJanitor())
+
+	var (
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		finished atomic.Bool
+	)
+	go c.DoContext(context.Background(), func(context.Context, ...interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		finished.Store(true)
+		return 1, nil
+	}, "slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop with a call in flight = %v, want context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !finished.Load() {
+		t.Error("Stop returned before the call in flight finished")
+	}
+}
+
+func TestSingleFlight(t *testing.T) {
+	c := New(nil, WithoutJanitor())
+	defer c.Stop(context.Background())
+
+	var (
+		loads   atomic.Int32
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.DoContext(context.Background(), func(context.Context, ...interface{}) (interface{}, error) {
+				loads.Add(1)
+				<-release
+				return "v", nil
+			}, "shared")
+			if err != nil || v != "v" {
+				t.Errorf("DoContext = %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("query ran %d times, want 1", n)
+	}
+}
@@ -0,0 +1,133 @@
+package cacheserver
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	memcachedb "memcache-database-module"
+)
+
+type (
+	// Client calls the Cache service.
+	Client struct {
+		conn grpc.ClientConnInterface
+	}
+
+	// Query is a call of the Do method.
+	Query struct {
+		// Name is the name of a query registered with the server, or SQL
+		// when the server accepts it.
+		Name string
+		Args []interface{}
+		// TTL overrides the cache TTL when positive.
+		TTL    time.Duration
+		Tags   []string
+		Tables []string
+	}
+
+	// Invalidation names the entries the Invalidate method removes: that
+	// of Query or Key, and those of Tags and Tables.
+	Invalidation struct {
+		Query  *Query
+		Key    string
+		Tags   []string
+		Tables []string
+	}
+)
+
+// NewClient returns a Client calling the service over conn, typically a
+// *grpc.ClientConn.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// Do returns the rows of q, each keyed by column.
+func (c *Client) Do(ctx context.Context, q Query, opts ...grpc.CallOption) ([]map[string]interface{}, error) {
+	m := map[string]interface{}{
+		"query": q.Name,
+		"args":  q.Args,
+	}
+	if q.TTL > 0 {
+		m["ttl"] = q.TTL.String()
+	}
+	if len(q.Tags) > 0 {
+		m["tags"] = list(q.Tags)
+	}
+	if len(q.Tables) > 0 {
+		m["tables"] = list(q.Tables)
+	}
+	req, err := structpb.NewStruct(m)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(structpb.ListValue)
+	if err := c.conn.Invoke(ctx, "/"+serviceName+"/Do", req, resp, opts...); err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0, len(resp.Values))
+	for _, v := range resp.Values {
+		rows = append(rows, v.GetStructValue().AsMap())
+	}
+
+	return rows, nil
+}
+
+// Invalidate removes the entries named by inv and returns how many there
+// were.
+func (c *Client) Invalidate(ctx context.Context, inv Invalidation, opts ...grpc.CallOption) (int, error) {
+	m := map[string]interface{}{
+		"tags":   list(inv.Tags),
+		"tables": list(inv.Tables),
+	}
+	switch {
+	case inv.Query != nil:
+		m["query"] = inv.Query.Name
+		m["args"] = inv.Query.Args
+	case inv.Key != "":
+		m["key"] = inv.Key
+	}
+	req, err := structpb.NewStruct(m)
+	if err != nil {
+		return 0, err
+	}
+
+	resp := new(structpb.Struct)
+	if err := c.conn.Invoke(ctx, "/"+serviceName+"/Invalidate", req, resp, opts...); err != nil {
+		return 0, err
+	}
+
+	return int(resp.Fields["removed"].GetNumberValue()), nil
+}
+
+// Stats returns the counters of the cache of the server.
+func (c *Client) Stats(ctx context.Context, opts ...grpc.CallOption) (memcachedb.Stats, error) {
+	var s memcachedb.Stats
+
+	resp := new(structpb.Struct)
+	if err := c.conn.Invoke(ctx, "/"+serviceName+"/Stats", new(emptypb.Empty), resp, opts...); err != nil {
+		return s, err
+	}
+	b, err := resp.MarshalJSON()
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+
+	return s, err
+}
+
+// list converts ss to the form structpb takes.
+func list(ss []string) []interface{} {
+	out := make([]interface{}, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+
+	return out
+}
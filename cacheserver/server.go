@@ -0,0 +1,274 @@
+// Package cacheserver serves a memcachedb cache over gRPC, so that services
+// written in other languages, or sidecars, share its read-through caching
+// of a database. The service is defined in cache.proto with well-known
+// message types only; Client is its Go client.
+package cacheserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	memcachedb "memcache-database-module"
+)
+
+const serviceName = "memcachedb.v1.Cache"
+
+type (
+	// Server implements the Cache service.
+	Server struct {
+		cache   memcachedb.Cache
+		db      *sqlx.DB
+		queries map[string]string
+		anySQL  bool
+	}
+
+	// Option configures a Server.
+	Option func(s *Server)
+)
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		unary("Do", func() interface{} { return new(structpb.Struct) }, func(s *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.do(ctx, req.(*structpb.Struct))
+		}),
+		unary("Invalidate", func() interface{} { return new(structpb.Struct) }, func(s *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.invalidate(ctx, req.(*structpb.Struct))
+		}),
+		unary("Stats", func() interface{} { return new(emptypb.Empty) }, func(s *Server, ctx context.Context, req interface{}) (interface{}, error) {
+			return s.stats(ctx, req.(*emptypb.Empty))
+		}),
+	},
+	Metadata: "cache.proto",
+}
+
+// WithQueries registers queries, keyed by the name clients call them by.
+func WithQueries(queries map[string]string) Option {
+	return func(s *Server) {
+		s.queries = queries
+	}
+}
+
+// WithAnySQL lets clients send SQL of their own in place of the name of a
+// registered query. Only use it when every client may run any statement
+// against the database.
+func WithAnySQL() Option {
+	return func(s *Server) {
+		s.anySQL = true
+	}
+}
+
+// NewServer returns a Server answering with c the queries it runs against
+// db.
+func NewServer(c memcachedb.Cache, db *sqlx.DB, opts ...Option) *Server {
+	s := &Server{cache: c, db: db}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Register registers the service with r, typically a *grpc.Server.
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	r.RegisterService(&serviceDesc, s)
+}
+
+// unary returns the grpc.MethodDesc serving method with call, which is
+// handed requests decoded into the messages newReq returns.
+func unary(method string, newReq func() interface{}, call func(s *Server, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(*Server), ctx, req)
+			}
+			if interceptor == nil {
+				return handle(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + method}
+
+			return interceptor(ctx, req, info, handle)
+		},
+	}
+}
+
+func (s *Server) do(ctx context.Context, req *structpb.Struct) (*structpb.ListValue, error) {
+	args, err := s.call(req)
+	if err != nil {
+		return nil, err
+	}
+	if ttl := req.Fields["ttl"].GetStringValue(); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "ttl: %v", err)
+		}
+		args = append(args, memcachedb.WithTTL(d))
+	}
+	if tags := stringList(req.Fields["tags"]); len(tags) > 0 {
+		args = append(args, memcachedb.WithTags(tags...))
+	}
+	if tables := stringList(req.Fields["tables"]); len(tables) > 0 {
+		args = append(args, memcachedb.WithTables(tables...))
+	}
+
+	v, err := s.cache.DoContext(ctx, s.query, args...)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	rows, err := structpb.NewList(v.([]interface{}))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return rows, nil
+}
+
+// call returns the arguments of the cache call req asks for: the statement
+// to run followed by its arguments.
+func (s *Server) call(req *structpb.Struct) ([]interface{}, error) {
+	sql := req.Fields["query"].GetStringValue()
+	if q, ok := s.queries[sql]; ok {
+		sql = q
+	} else if sql == "" || !s.anySQL {
+		return nil, status.Errorf(codes.NotFound, "unknown query %q", sql)
+	}
+
+	args := []interface{}{sql}
+	for _, arg := range req.Fields["args"].GetListValue().AsSlice() {
+		args = append(args, argument(arg))
+	}
+
+	return args, nil
+}
+
+// query runs the statement args[0] with the arguments that follow and
+// returns its rows in the form structpb takes.
+func (s *Server) query(ctx context.Context, args ...interface{}) (interface{}, error) {
+	rows, err := s.db.QueryxContext(ctx, args[0].(string), args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]interface{}, 0)
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+		for k, v := range row {
+			row[k] = column(v)
+		}
+		list = append(list, row)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *Server) invalidate(_ context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	removed := 0
+	switch {
+	case req.Fields["key"].GetStringValue() != "":
+		if s.cache.InvalidateKey(req.Fields["key"].GetStringValue()) {
+			removed++
+		}
+	case req.Fields["query"].GetStringValue() != "":
+		args, err := s.call(req)
+		if err != nil {
+			return nil, err
+		}
+		key, err := s.cache.Key(args...)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if s.cache.InvalidateKey(key) {
+			removed++
+		}
+	}
+	for _, tag := range stringList(req.Fields["tags"]) {
+		removed += s.cache.InvalidateTag(tag)
+	}
+	if tables := stringList(req.Fields["tables"]); len(tables) > 0 {
+		removed += s.cache.InvalidateTables(tables...)
+	}
+
+	return structpb.NewStruct(map[string]interface{}{"removed": removed})
+}
+
+func (s *Server) stats(context.Context, *emptypb.Empty) (*structpb.Struct, error) {
+	b, err := json.Marshal(s.cache.Stats())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return structpb.NewStruct(m)
+}
+
+// argument turns the whole numbers structpb decodes as float64 back into
+// integers, as columns they are compared with usually are.
+func argument(v interface{}) interface{} {
+	f, ok := v.(float64)
+	if ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+
+	return v
+}
+
+// column converts a scanned column to a type structpb takes.
+func column(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return float64(v)
+	case nil, bool, float64, string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func stringList(v *structpb.Value) []string {
+	var out []string
+	for _, s := range v.GetListValue().GetValues() {
+		out = append(out, s.GetStringValue())
+	}
+
+	return out
+}
+
+// statusOf maps the error of a cache call to a gRPC status.
+func statusOf(err error) error {
+	switch {
+	case errors.Is(err, memcachedb.ErrStopped):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Unknown, err.Error())
+	}
+}
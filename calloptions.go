@@ -0,0 +1,94 @@
+package memcachedb
+
+import "time"
+
+type (
+	// CallOption tunes a single call. Call options are passed among the
+	// query arguments of DoContext and Do; they are neither hashed into the
+	// key nor handed to the query.
+	CallOption func(o *callOptions)
+
+	callOptions struct {
+		ttl   time.Duration
+		tags  []string
+		force bool
+		ns    *namespaceCounters
+		// pattern names the query pattern of the call, whose counters
+		// pat points to under WithPatternStats.
+		pattern string
+		pat     *patternCounters
+		// expireAt, if set, is when the entry expires, in place of ttl.
+		expireAt int64
+		// rows are the keys of the rows ExecContext invalidates, and
+		// rowTables the tables they belong to.
+		rows      []string
+		rowTables []string
+		// fingerprint identifies the arguments of a hashed call; zero
+		// for calls made by key.
+		fingerprint uint64
+	}
+)
+
+// WithTTL caches the result of this call for d instead of the cache TTL.
+func WithTTL(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.ttl = d
+	}
+}
+
+// ExpireAt makes the entry cached by this call expire at t instead of after
+// a TTL, for data that turns invalid at a known moment, such as the end of
+// an auction. The TTL jitter and WithSlidingTTL leave the entry alone, and
+// SetTTL overrides t. Empty results and errors keep their own TTLs.
+func ExpireAt(t time.Time) CallOption {
+	return func(o *callOptions) {
+		o.expireAt = t.UnixNano()
+	}
+}
+
+// WithTags attaches tags to the entry cached by this call, so that
+// InvalidateTag can remove it together with every other entry sharing one
+// of the tags.
+func WithTags(tags ...string) CallOption {
+	return func(o *callOptions) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// ForceRefresh makes this call skip the cached entry, run the query and
+// cache its result in place of the old one.
+func ForceRefresh() CallOption {
+	return func(o *callOptions) {
+		o.force = true
+	}
+}
+
+// splitArgs separates call options from query arguments, applying them
+// after defaults.
+func (c *cache) splitArgs(args []interface{}, defaults ...CallOption) ([]interface{}, callOptions) {
+	o := callOptions{ttl: c.cur().ttl}
+	for _, opt := range defaults {
+		opt(&o)
+	}
+
+	n := 0
+	for _, arg := range args {
+		if _, ok := arg.(CallOption); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return args, o
+	}
+
+	rest := make([]interface{}, 0, len(args)-n)
+	for _, arg := range args {
+		if opt, ok := arg.(CallOption); ok {
+			opt(&o)
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	return rest, o
+}
@@ -0,0 +1,160 @@
+// Package cdc invalidates memcachedb cache entries from change-data-capture
+// events in the Debezium JSON format, typically read from Kafka.
+//
+// Both the bare change event and the one wrapped in a {"schema", "payload"}
+// envelope by the JSON converter are understood. Snapshot reads ("r") and
+// tombstones are ignored.
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+
+	memcachedb "memcache-database-module"
+)
+
+type (
+	// Event is a decoded Debezium change event.
+	Event struct {
+		// Op is "c" for inserts, "u" for updates, "d" for deletes, "t" for
+		// truncates and "r" for snapshot reads.
+		Op     string                 `json:"op"`
+		Before map[string]interface{} `json:"before"`
+		After  map[string]interface{} `json:"after"`
+		Source Source                 `json:"source"`
+	}
+
+	// Source identifies the table an event comes from.
+	Source struct {
+		DB     string `json:"db"`
+		Schema string `json:"schema"`
+		Table  string `json:"table"`
+	}
+
+	// Config configures a Consumer.
+	Config struct {
+		// Tables holds the rules of the tables to follow, keyed by
+		// "schema.table" or bare "table". When it is empty every table is
+		// followed with the zero Rule.
+		Tables map[string]Rule
+		// Logger receives skipped malformed messages. It defaults to
+		// slog.Default.
+		Logger *slog.Logger
+	}
+
+	// Rule says how changes to one table invalidate the cache.
+	Rule struct {
+		// Tags returns the tags to invalidate for a change event.
+		Tags func(ev Event) []string
+		// RowsOnly skips invalidating every entry of the table, leaving
+		// invalidation to Tags.
+		RowsOnly bool
+	}
+
+	// Reader is the part of *kafka.Reader a Consumer uses. The reader must
+	// belong to a consumer group so that offsets can be committed.
+	Reader interface {
+		FetchMessage(ctx context.Context) (kafka.Message, error)
+		CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	}
+
+	// Consumer applies change events to a cache.
+	Consumer struct {
+		cache memcachedb.Cache
+		cfg   Config
+	}
+)
+
+// New returns a Consumer applying change events to c.
+func New(c memcachedb.Cache, cfg Config) *Consumer {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	return &Consumer{cache: c, cfg: cfg}
+}
+
+// Run applies the messages of r until ctx is done or r fails. Each message
+// is committed once applied; malformed messages are logged and skipped.
+func (c *Consumer) Run(ctx context.Context, r Reader) error {
+	for {
+		msg, err := r.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+		if err = c.Apply(msg.Value); err != nil {
+			c.cfg.Logger.Warn("cdc: skipping malformed message",
+				"topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		}
+		if err = r.CommitMessages(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Apply decodes a single message value and invalidates what it changed.
+func (c *Consumer) Apply(value []byte) error {
+	ev, ok, err := Decode(value)
+	if err != nil || !ok || ev.Op == "r" {
+		return err
+	}
+
+	rule, ok := c.rule(ev.Source)
+	if !ok {
+		return nil
+	}
+	if !rule.RowsOnly {
+		c.cache.InvalidateTables(ev.Source.Table)
+	}
+	if rule.Tags != nil {
+		for _, tag := range rule.Tags(ev) {
+			c.cache.InvalidateTag(tag)
+		}
+	}
+
+	return nil
+}
+
+// Decode parses a Debezium message value. ok is false for tombstones.
+func Decode(value []byte) (ev Event, ok bool, err error) {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || bytes.Equal(value, []byte("null")) {
+		return ev, false, nil
+	}
+
+	var envelope struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err = json.Unmarshal(value, &envelope); err != nil {
+		return ev, false, err
+	}
+	if len(envelope.Payload) > 0 {
+		value = envelope.Payload
+	}
+	if err = json.Unmarshal(value, &ev); err != nil {
+		return ev, false, err
+	}
+
+	return ev, ev.Op != "", nil
+}
+
+func (c *Consumer) rule(src Source) (Rule, bool) {
+	if len(c.cfg.Tables) == 0 {
+		return Rule{}, true
+	}
+	for _, ns := range []string{src.Schema, src.DB} {
+		if ns == "" {
+			continue
+		}
+		if r, ok := c.cfg.Tables[ns+"."+src.Table]; ok {
+			return r, true
+		}
+	}
+	r, ok := c.cfg.Tables[src.Table]
+
+	return r, ok
+}
@@ -0,0 +1,48 @@
+package memcachedb
+
+import "time"
+
+type (
+	// Clock tells the cache the time. The lifetimes of entries are
+	// measured against it and the janitor sweeps on its ticks, so that
+	// tests can expire entries without waiting by setting a fake one
+	// with WithClock, such as memcachedbtest.FakeClock. Query latencies,
+	// timeouts, retries, the circuit breaker and WithLoadInterval keep to
+	// the system clock.
+	Clock interface {
+		Now() time.Time
+		// NewTicker returns a Ticker sending the time every d.
+		NewTicker(d time.Duration) Ticker
+	}
+
+	// Ticker is the ticker of a Clock, as time.Ticker is that of the
+	// system clock.
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	systemClock  struct{}
+	systemTicker struct{ *time.Ticker }
+)
+
+// SystemClock is the Clock of the system, used unless WithClock sets
+// another.
+var SystemClock Clock = systemClock{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// now returns the time of the clock of the cache, as lifetimes hold it.
+func (c *cache) now() int64 {
+	return c.clock.Now().UnixNano()
+}
@@ -0,0 +1,30 @@
+package memcachedb
+
+import "reflect"
+
+// CloneWith returns a clone function for WithCopyOnReturn that copies
+// values by round-tripping them through codec. Values codec cannot handle
+// are returned as they are.
+func CloneWith(codec Codec) func(v interface{}) interface{} {
+	return func(v interface{}) interface{} {
+		b, err := codec.Marshal(v)
+		if err != nil {
+			return v
+		}
+		p := reflect.New(reflect.TypeOf(v))
+		if err := codec.Unmarshal(b, p.Interface()); err != nil {
+			return v
+		}
+
+		return p.Elem().Interface()
+	}
+}
+
+// isolate returns the copy of v a caller gets under WithCopyOnReturn.
+func (c *cache) isolate(v interface{}) interface{} {
+	if c.clone == nil || v == nil {
+		return v
+	}
+
+	return c.clone(v)
+}
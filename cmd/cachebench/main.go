@@ -0,0 +1,288 @@
+// Command cachebench drives a memcachedb cache with a synthetic workload and
+// reports its hit ratio, the latency of its calls and what they allocate, to
+// compare eviction policies, bounds and shard counts.
+//
+//	cachebench -keys 100000 -dist zipf -max-entries 10000 -eviction lfu
+//
+// Without -dsn, misses are served by a stub database that sleeps for
+// -db-latency and returns -value-size bytes. With -dsn, they run -query
+// against the database, its single argument the key, an integer in
+// [0, -keys):
+//
+//	cachebench -dsn "$DATABASE_URL" -query "SELECT * FROM users WHERE id = $1"
+//
+// Keys are drawn uniformly, or from a Zipf distribution of exponent -zipf-s
+// ranking key 0 most popular. Each of the -concurrency workers draws its own
+// keys from a seeded source, so that runs with the same flags issue the
+// same calls.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	memcachedb "memcache-database-module"
+)
+
+// samplesPerWorker bounds the latencies each worker keeps for percentiles.
+// They are allocated up front so that sampling allocates nothing during
+// the run.
+const samplesPerWorker = 100_000
+
+type (
+	// worker issues calls and samples their latencies.
+	worker struct {
+		rng     *rand.Rand
+		next    func() uint64
+		ops     uint64
+		errs    uint64
+		samples []time.Duration
+	}
+
+	// run is what a run measured.
+	run struct {
+		elapsed  time.Duration
+		ops      uint64
+		errs     uint64
+		samples  []time.Duration
+		stats    memcachedb.Stats
+		mallocs  uint64
+		bytes    uint64
+		gcCycles uint32
+	}
+)
+
+func main() {
+	var (
+		keys        = flag.Uint64("keys", 100_000, "number of distinct keys")
+		dist        = flag.String("dist", "zipf", "key distribution: zipf or uniform")
+		zipfS       = flag.Float64("zipf-s", 1.1, "exponent of the Zipf distribution, above 1")
+		concurrency = flag.Int("concurrency", runtime.GOMAXPROCS(0), "number of concurrent callers")
+		duration    = flag.Duration("duration", 10*time.Second, "how long to run")
+		ops         = flag.Uint64("ops", 0, "total number of calls to make instead of running for -duration")
+		seed        = flag.Uint64("seed", 1, "seed of the key sources")
+		valueSize   = flag.Int("value-size", 1024, "size in bytes of the values of the stub database")
+		dbLatency   = flag.Duration("db-latency", time.Millisecond, "latency of the stub database")
+		driver      = flag.String("driver", "postgres", "database/sql driver name")
+		dsn         = flag.String("dsn", "", "database connection string; the stub database is used if empty")
+		query       = flag.String("query", "", "query run against -dsn on a miss, taking the key as its argument")
+		ttl         = flag.Duration("ttl", 0, "cache TTL, the default of New if zero")
+		shards      = flag.Int("shards", 0, "number of shards, the default of New if zero")
+		maxEntries  = flag.Int("max-entries", 0, "bound on the number of cached entries, 0 for none")
+		maxBytes    = flag.Int64("max-bytes", 0, "bound on the cost of the cached entries, 0 for none")
+		eviction    = flag.String("eviction", "", "eviction policy: lru, lfu or arc")
+		tinyLFU     = flag.Bool("tinylfu", false, "admit entries with TinyLFU")
+	)
+	flag.Parse()
+
+	cfg := memcachedb.Config{
+		TTL:        *ttl,
+		Shards:     *shards,
+		MaxEntries: *maxEntries,
+		MaxBytes:   *maxBytes,
+		Eviction:   *eviction,
+		TinyLFU:    *tinyLFU,
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *dist != "zipf" && *dist != "uniform" {
+		log.Fatalf("unknown distribution %q", *dist)
+	}
+	if *dist == "zipf" && *zipfS <= 1 {
+		log.Fatal("-zipf-s must be above 1")
+	}
+	if *keys == 0 || *concurrency <= 0 {
+		log.Fatal("-keys and -concurrency must be positive")
+	}
+
+	var (
+		db   *sqlx.DB
+		call func(ctx context.Context, c memcachedb.Cache, key uint64) error
+	)
+	if *dsn != "" {
+		if *query == "" {
+			log.Fatal("-dsn needs -query")
+		}
+		var err error
+		if db, err = sqlx.Connect(*driver, *dsn); err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		call = func(ctx context.Context, c memcachedb.Cache, key uint64) error {
+			_, err := c.QueryContext(ctx, *query, key)
+			return err
+		}
+	} else {
+		stub := func(ctx context.Context, _ ...interface{}) (interface{}, error) {
+			t := time.NewTimer(*dbLatency)
+			defer t.Stop()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-t.C:
+			}
+			return make([]byte, *valueSize), nil
+		}
+		call = func(ctx context.Context, c memcachedb.Cache, key uint64) error {
+			_, err := c.DoContext(ctx, stub, key)
+			return err
+		}
+	}
+
+	c := memcachedb.New(db, cfg.Options()...)
+	workers := make([]*worker, *concurrency)
+	for i := range workers {
+		w := &worker{
+			rng:     rand.New(rand.NewPCG(*seed, uint64(i))),
+			samples: make([]time.Duration, 0, samplesPerWorker),
+		}
+		if *dist == "zipf" {
+			w.next = rand.NewZipf(w.rng, *zipfS, 1, *keys-1).Uint64
+		} else {
+			n := *keys
+			w.next = func() uint64 { return w.rng.Uint64N(n) }
+		}
+		workers[i] = w
+	}
+
+	r := bench(c, call, workers, *duration, *ops)
+	if err := c.Stop(context.Background()); err != nil {
+		log.Print(err)
+	}
+	r.print(os.Stdout)
+}
+
+// bench runs the workers for d, or until they made ops calls between them
+// if ops is set.
+func bench(c memcachedb.Cache, call func(context.Context, memcachedb.Cache, uint64) error, workers []*worker, d time.Duration, ops uint64) run {
+	var (
+		wg      sync.WaitGroup
+		done    atomic.Bool
+		started = make(chan struct{})
+		ctx     = context.Background()
+	)
+	for i, w := range workers {
+		quota := ops / uint64(len(workers))
+		if uint64(i) < ops%uint64(len(workers)) {
+			quota++
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-started
+			for ops == 0 || w.ops < quota {
+				if ops == 0 && done.Load() {
+					return
+				}
+				key := w.next()
+				t := time.Now()
+				if err := call(ctx, c, key); err != nil {
+					w.errs++
+				}
+				w.sample(time.Since(t))
+			}
+		}()
+	}
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	close(started)
+	if ops == 0 {
+		time.Sleep(d)
+		done.Store(true)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	r := run{
+		elapsed:  elapsed,
+		stats:    c.Stats(),
+		mallocs:  after.Mallocs - before.Mallocs,
+		bytes:    after.TotalAlloc - before.TotalAlloc,
+		gcCycles: after.NumGC - before.NumGC,
+	}
+	for _, w := range workers {
+		r.ops += w.ops
+		r.errs += w.errs
+		r.samples = append(r.samples, w.samples...)
+	}
+	sort.Slice(r.samples, func(i, j int) bool { return r.samples[i] < r.samples[j] })
+
+	return r
+}
+
+// sample counts a call of latency d, keeping it with reservoir sampling
+// once samples is full.
+func (w *worker) sample(d time.Duration) {
+	w.ops++
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, d)
+		return
+	}
+	if i := w.rng.Uint64N(w.ops); i < uint64(len(w.samples)) {
+		w.samples[i] = d
+	}
+}
+
+// percentile returns the q-th quantile of the sorted samples.
+func (r run) percentile(q float64) time.Duration {
+	if len(r.samples) == 0 {
+		return 0
+	}
+
+	return r.samples[min(int(q*float64(len(r.samples))), len(r.samples)-1)]
+}
+
+func (r run) print(out io.Writer) {
+	perOp := func(n uint64) float64 {
+		if r.ops == 0 {
+			return 0
+		}
+		return float64(n) / float64(r.ops)
+	}
+	s := r.stats
+
+	w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "calls\t%d\n", r.ops)
+	fmt.Fprintf(w, "errors\t%d\n", r.errs)
+	fmt.Fprintf(w, "elapsed\t%s\n", r.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput\t%.0f calls/s\n", float64(r.ops)/r.elapsed.Seconds())
+	fmt.Fprintf(w, "hit ratio\t%.4f\n", s.HitRatio())
+	fmt.Fprintf(w, "hits\t%d\n", s.Hits)
+	fmt.Fprintf(w, "misses\t%d\n", s.Misses)
+	fmt.Fprintf(w, "coalesced\t%d\n", s.Coalesced)
+	fmt.Fprintf(w, "loads\t%d\n", s.Loads)
+	fmt.Fprintf(w, "evictions\t%d\n", s.Evictions)
+	fmt.Fprintf(w, "entries\t%d\n", s.Entries)
+	for _, p := range []struct {
+		name string
+		q    float64
+	}{{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}, {"p99.9", 0.999}, {"max", 1}} {
+		fmt.Fprintf(w, "latency %s\t%s\n", p.name, r.percentile(p.q))
+	}
+	if s.LoadLatency.Count > 0 {
+		fmt.Fprintf(w, "load latency mean\t%s\n", s.LoadLatency.Sum/time.Duration(s.LoadLatency.Count))
+	}
+	fmt.Fprintf(w, "allocs/call\t%.1f\n", perOp(r.mallocs))
+	fmt.Fprintf(w, "bytes/call\t%.0f\n", perOp(r.bytes))
+	fmt.Fprintf(w, "gc cycles\t%d\n", r.gcCycles)
+	w.Flush()
+}
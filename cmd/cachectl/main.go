@@ -0,0 +1,333 @@
+// Command cachectl talks to the admin endpoints of a running memcachedb
+// cache, as served by the admin package.
+//
+//	cachectl [-addr url | -socket path] <command> [flags]
+//
+// The commands are
+//
+//	stats                         prints the counters
+//	keys [-pattern p] [-limit n]  lists keys; -all follows every page
+//	patterns [-n n] [-by order]   lists the query patterns ranking first
+//	                              by miss_rate, load_latency or load_time
+//	get <key>                     prints the value cached under key
+//	trace [-key k]                prints the events traced for k, or for
+//	                              every key
+//	invalidate [-tag t] [-table t] [-key k]
+//	                              removes entries; flags repeat
+//	flush [-prefix p]             removes every entry, or those whose
+//	                              key starts with p
+//	snapshot [-o file]            saves a snapshot on the server, or
+//	                              downloads one to file
+//	config                        prints the configuration
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"memcache-database-module/admin"
+)
+
+type (
+	client struct {
+		base string
+		http *http.Client
+	}
+
+	// multi is a flag that may repeat.
+	multi []string
+)
+
+func (m *multi) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multi) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func main() {
+	addr := flag.String("addr", "http://localhost:8080/debug/cache", "base URL of the admin endpoints")
+	socket := flag.String("socket", "", "Unix socket serving the admin endpoints, instead of -addr")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: cachectl [flags] stats|keys|patterns|get|trace|invalidate|flush|snapshot|config [args]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{base: strings.TrimSuffix(*addr, "/"), http: &http.Client{Timeout: *timeout}}
+	if *socket != "" {
+		c.base = "http://unix"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", *socket)
+			},
+		}
+	}
+
+	if err := run(c, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "cachectl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(c *client, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	switch cmd {
+	case "stats":
+		fs.Parse(args)
+		var s admin.StatsReply
+		if err := c.do(http.MethodGet, "/stats", nil, &s); err != nil {
+			return err
+		}
+		return printStats(s)
+
+	case "keys":
+		pattern := fs.String("pattern", "", "glob the keys must match")
+		limit := fs.Int("limit", 100, "keys per page")
+		cursor := fs.String("cursor", "", "cursor of the page to start at")
+		all := fs.Bool("all", false, "follow every page")
+		fs.Parse(args)
+		for {
+			q := url.Values{"pattern": {*pattern}, "limit": {fmt.Sprint(*limit)}, "cursor": {*cursor}}
+			var page admin.KeyPage
+			if err := c.do(http.MethodGet, "/keys", q, &page); err != nil {
+				return err
+			}
+			for _, key := range page.Keys {
+				fmt.Printf("%q\n", key)
+			}
+			if page.Next == "" {
+				return nil
+			}
+			if !*all {
+				fmt.Fprintf(os.Stderr, "more: -cursor %q\n", page.Next)
+				return nil
+			}
+			*cursor = page.Next
+		}
+
+	case "patterns":
+		n := fs.Int("n", 20, "patterns to list, 0 for all")
+		by := fs.String("by", "miss_rate", "ranking: miss_rate, load_latency or load_time")
+		fs.Parse(args)
+		q := url.Values{"by": {*by}}
+		if *n > 0 {
+			q.Set("n", fmt.Sprint(*n))
+		}
+		var rows []admin.PatternReply
+		if err := c.do(http.MethodGet, "/patterns", q, &rows); err != nil {
+			return err
+		}
+		return printPatterns(rows)
+
+	case "get":
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errors.New("get takes a key")
+		}
+		var e admin.EntryReply
+		if err := c.do(http.MethodGet, "/entry/"+url.PathEscape(fs.Arg(0)), nil, &e); err != nil {
+			return err
+		}
+		return printJSON(e)
+
+	case "trace":
+		key := fs.String("key", "", "key whose events to print")
+		fs.Parse(args)
+		var events []struct {
+			Time   time.Time
+			Key    string
+			Kind   string
+			Detail string
+		}
+		if err := c.do(http.MethodGet, "/trace", url.Values{"key": {*key}}, &events); err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, ev := range events {
+			fmt.Fprintf(w, "%s\t%q\t%s\t%s\n", ev.Time.Format(time.RFC3339Nano), ev.Key, ev.Kind, ev.Detail)
+		}
+		return w.Flush()
+
+	case "invalidate":
+		var tags, tables, keys multi
+		fs.Var(&tags, "tag", "tag whose entries to remove")
+		fs.Var(&tables, "table", "table whose entries to remove")
+		fs.Var(&keys, "key", "key whose entry to remove")
+		fs.Parse(args)
+		q := url.Values{"tag": tags, "table": tables, "key": keys}
+		var r admin.InvalidateReply
+		if err := c.do(http.MethodPost, "/invalidate", q, &r); err != nil {
+			return err
+		}
+		fmt.Println("removed", r.Removed)
+		return nil
+
+	case "flush":
+		prefix := fs.String("prefix", "", "prefix of the keys whose entries to remove")
+		fs.Parse(args)
+		var r admin.InvalidateReply
+		if err := c.do(http.MethodPost, "/flush", url.Values{"prefix": {*prefix}}, &r); err != nil {
+			return err
+		}
+		fmt.Println("removed", r.Removed)
+		return nil
+
+	case "snapshot":
+		out := fs.String("o", "", "file to download the snapshot to, instead of saving it on the server")
+		fs.Parse(args)
+		if *out != "" {
+			return c.download("/snapshot", *out)
+		}
+		var r admin.SnapshotReply
+		if err := c.do(http.MethodPost, "/snapshot", nil, &r); err != nil {
+			return err
+		}
+		fmt.Println("saved", r.Path)
+		return nil
+
+	case "config":
+		fs.Parse(args)
+		var cfg map[string]interface{}
+		if err := c.do(http.MethodGet, "/config", nil, &cfg); err != nil {
+			return err
+		}
+		return printJSON(cfg)
+	}
+
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+// do sends a request to the endpoint at path and decodes its JSON reply
+// into out.
+func (c *client) do(method, path string, q url.Values, out interface{}) error {
+	resp, err := c.send(method, path, q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *client) download(path, file string) error {
+	resp, err := c.send(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+
+	return f.Close()
+}
+
+// send sends a request and returns its response once it succeeded.
+func (c *client) send(method, path string, q url.Values) (*http.Response, error) {
+	u := c.base + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+func printStats(s admin.StatsReply) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	rows := [][2]interface{}{
+		{"entries", s.Entries},
+		{"bytes", s.Bytes},
+		{"hits", s.Hits},
+		{"misses", s.Misses},
+		{"hit ratio", fmt.Sprintf("%.3f", s.HitRatio)},
+		{"stale hits", s.StaleHits},
+		{"negative hits", s.NegativeHits},
+		{"l2 hits", s.L2Hits},
+		{"peer hits", s.PeerHits},
+		{"collisions", s.Collisions},
+		{"mutations", s.Mutations},
+		{"coalesced", s.Coalesced},
+		{"loads", s.Loads},
+		{"load errors", s.LoadErrors},
+		{"throttled", s.Throttled},
+		{"hedges", s.Hedges},
+		{"retries", s.Retries},
+		{"refreshes", s.Refreshes},
+		{"prepares", s.Prepares},
+		{"prepare hits", s.PrepareHits},
+		{"oversized", s.Oversized},
+		{"rejected", s.Rejected},
+		{"timeouts", s.Timeouts},
+		{"refused", s.Refused},
+		{"fallbacks", s.Fallbacks},
+		{"evictions", s.Evictions},
+		{"expirations", s.Expirations},
+		{"idle", s.Idle},
+		{"compressed", s.Compressed},
+		{"bytes saved", s.BytesSaved},
+		{"db time saved", s.TimeSaved},
+	}
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%v\n", r[0], r[1])
+	}
+
+	return w.Flush()
+}
+
+func printPatterns(rows []admin.PatternReply) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "miss rate\thits\tmisses\tloads\terrors\tlatency\tload time\tpattern")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%.3f\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			r.MissRate, r.Hits, r.Misses, r.Loads, r.LoadErrors, r.LoadLatency, r.LoadTime, r.Pattern)
+	}
+
+	return w.Flush()
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
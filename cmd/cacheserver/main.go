@@ -0,0 +1,176 @@
+// Command cacheserver serves a memcachedb cache of a database over gRPC.
+//
+//	cacheserver -dsn "$DATABASE_URL" -queries queries.json
+//
+// The queries file maps the names clients call queries by to their SQL:
+//
+//	{"user": "SELECT id, name FROM users WHERE id = $1"}
+//
+// With -memcached, the server also speaks the memcached text protocol. A get
+// of a key that is not cached runs the named query of the key, split at
+// colons into the name and the arguments, and returns its rows as JSON:
+// "user:42" runs the "user" query with the argument "42". With -resp, it
+// serves the same keys over the Redis protocol.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"google.golang.org/grpc"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/cacheserver"
+	"memcache-database-module/memcachedserver"
+	"memcache-database-module/respserver"
+)
+
+func main() {
+	var (
+		listen     = flag.String("listen", ":7070", "address to serve gRPC on")
+		driver     = flag.String("driver", "postgres", "database/sql driver name")
+		dsn        = flag.String("dsn", os.Getenv("DATABASE_URL"), "database connection string")
+		ttl        = flag.Duration("ttl", time.Minute, "cache TTL")
+		maxEntries = flag.Int("max-entries", 0, "bound on the number of cached entries, 0 for none")
+		queries    = flag.String("queries", "", "JSON file mapping query names to SQL")
+		anySQL     = flag.Bool("any-sql", false, "let clients send SQL of their own")
+		memcached  = flag.String("memcached", "", "address to serve the memcached protocol on, if any")
+		resp       = flag.String("resp", "", "address to serve the Redis protocol on, if any")
+	)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sqlx.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	opts := []cacheserver.Option{}
+	var named map[string]string
+	if *queries != "" {
+		b, err := os.ReadFile(*queries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &named); err != nil {
+			log.Fatalf("%s: %v", *queries, err)
+		}
+		opts = append(opts, cacheserver.WithQueries(named))
+	}
+	if *anySQL {
+		opts = append(opts, cacheserver.WithAnySQL())
+	}
+
+	c := memcachedb.New(db,
+		memcachedb.WithDefaultTTL(*ttl),
+		memcachedb.WithContext(ctx),
+		memcachedb.WithMaxEntries(*maxEntries),
+		memcachedb.WithLogger(slog.Default()))
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	cacheserver.NewServer(c, db, opts...).Register(srv)
+
+	if *memcached != "" {
+		mc := memcachedserver.New(c,
+			memcachedserver.WithLoader(namedLoader(db, named)),
+			memcachedserver.WithLogger(slog.Default()))
+		go func() {
+			if err := mc.ListenAndServe(*memcached); !errors.Is(err, net.ErrClosed) {
+				log.Fatal(err)
+			}
+		}()
+		defer mc.Close()
+	}
+	if *resp != "" {
+		rs := respserver.New(c,
+			respserver.WithLoader(namedLoader(db, named)),
+			respserver.WithLogger(slog.Default()))
+		go func() {
+			if err := rs.ListenAndServe(*resp); !errors.Is(err, net.ErrClosed) {
+				log.Fatal(err)
+			}
+		}()
+		defer rs.Close()
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	slog.Info("cacheserver: serving", "addr", lis.Addr().String())
+	if err := srv.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
+
+	drain, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.Stop(drain); err != nil {
+		slog.Warn("cacheserver: stop", "error", err)
+	}
+}
+
+// namedLoader loads the keys of the memcached and Redis protocols by running
+// the named queries they name.
+func namedLoader(db *sqlx.DB, named map[string]string) func(ctx context.Context, key string) ([]byte, error) {
+	return func(ctx context.Context, key string) ([]byte, error) {
+		name, rest, _ := strings.Cut(key, ":")
+		q, ok := named[name]
+		if !ok {
+			return nil, sql.ErrNoRows
+		}
+		var args []interface{}
+		if rest != "" {
+			for _, arg := range strings.Split(rest, ":") {
+				args = append(args, arg)
+			}
+		}
+
+		rows, err := db.QueryxContext(ctx, q, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []map[string]interface{}
+		for rows.Next() {
+			row := make(map[string]interface{})
+			if err := rows.MapScan(row); err != nil {
+				return nil, err
+			}
+			for k, v := range row {
+				if b, ok := v.([]byte); ok {
+					row[k] = string(b)
+				}
+			}
+			list = append(list, row)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, sql.ErrNoRows
+		}
+
+		return json.Marshal(list)
+	}
+}
@@ -0,0 +1,120 @@
+package memcachedb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+)
+
+type (
+	// Codec serializes the values a Cache stores encoded, as chosen by
+	// WithCodec. Unmarshal is handed a pointer to a zero value of the type
+	// that was marshalled.
+	Codec interface {
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+
+	gobCodec  struct{}
+	jsonCodec struct{}
+)
+
+var (
+	// GobCodec encodes values with encoding/gob. It is the codec values
+	// compressed by WithCompression are encoded with when no other is
+	// set.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec encodes values with encoding/json, which keeps exported
+	// fields only.
+	JSONCodec Codec = jsonCodec{}
+)
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gobCodec) String() string { return "gob" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (jsonCodec) String() string { return "json" }
+
+// pack replaces the value of v, cached under key, by its encoding when the
+// cache stores values encoded, compressing that when it is large enough
+// for compression to pay off.
+func (c *cache) pack(key string, v *Entry) {
+	if v.value == nil || (c.codec == nil && c.compression == 0) {
+		return
+	}
+	// Without a codec, only values worth compressing are encoded.
+	var estimate int64
+	if c.codec == nil {
+		if estimate = estimateSize(v.value); estimate < c.compressMin {
+			return
+		}
+	}
+
+	codec := c.codec
+	if codec == nil {
+		codec = GobCodec
+	}
+	b, err := codec.Marshal(v.value)
+	if err != nil {
+		c.logger.Debug("memcachedb: value stored unencoded", "key", key, "error", err)
+		return
+	}
+
+	var packing Compression
+	if c.compression != 0 && int64(len(b)) >= c.compressMin {
+		if z, err := c.compression.compress(b); err == nil && len(z) < len(b) {
+			if c.codec != nil {
+				estimate = int64(len(b))
+			}
+			c.stats.compressed.Add(1)
+			c.stats.bytesSaved.Add(uint64(max(estimate-int64(len(z)), 0)))
+			b, packing = z, c.compression
+		}
+	}
+	if c.codec == nil && packing == 0 {
+		return
+	}
+
+	v.typ = reflect.TypeOf(v.value)
+	v.value, v.packed, v.codec, v.packing = nil, b, codec, packing
+	if c.cur().maxBytes > 0 && c.cost == nil {
+		v.size = int64(len(key) + len(b))
+	}
+}
+
+// load returns the value of v, decoding it if it was stored encoded.
+func (v *Entry) load() (interface{}, error) {
+	if v.packed == nil {
+		return v.value, nil
+	}
+
+	b := v.packed
+	if v.packing != 0 {
+		var err error
+		if b, err = v.packing.decompress(b); err != nil {
+			return nil, err
+		}
+	}
+	p := reflect.New(v.typ)
+	if err := v.codec.Unmarshal(b, p.Interface()); err != nil {
+		return nil, err
+	}
+
+	return p.Elem().Interface(), nil
+}
@@ -0,0 +1,64 @@
+package memcachedb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// Compression is the algorithm WithCompression packs large values with.
+type Compression int
+
+const (
+	// CompressSnappy compresses fast at a modest ratio, which suits values
+	// read often.
+	CompressSnappy Compression = iota + 1
+	// CompressGzip compresses better but decompresses several times
+	// slower than CompressSnappy.
+	CompressGzip
+)
+
+func (p Compression) String() string {
+	switch p {
+	case 0:
+		return "none"
+	case CompressSnappy:
+		return "snappy"
+	case CompressGzip:
+		return "gzip"
+	default:
+		return "unknown"
+	}
+}
+
+func (p Compression) compress(b []byte) ([]byte, error) {
+	if p == CompressSnappy {
+		return snappy.Encode(nil, b), nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (p Compression) decompress(b []byte) ([]byte, error) {
+	if p == CompressSnappy {
+		return snappy.Decode(nil, b)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,391 @@
+package memcachedb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix starts the names of the environment variables read by
+// Config.FromEnv.
+const envPrefix = "MEMCACHEDB_"
+
+// Config holds the tunables of a Cache as data, so that they can be set per
+// environment without code changes:
+//
+//	var cfg memcachedb.Config
+//	if err := yaml.Unmarshal(data, &cfg); err != nil {
+//		return err
+//	}
+//	if err := cfg.FromEnv(); err != nil {
+//		return err
+//	}
+//	if err := cfg.Validate(); err != nil {
+//		return err
+//	}
+//	c := memcachedb.New(db, cfg.Options()...)
+//
+// The yaml tags suit gopkg.in/yaml.v3, which reads durations written as
+// "90s". Zero fields keep the defaults of New. Hooks such as the logger or
+// a Store are still set with options, passed after those of the Config.
+type Config struct {
+	TTL             time.Duration `yaml:"ttl"`
+	Jitter          float64       `yaml:"jitter"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+	NoJanitor       bool          `yaml:"no_janitor"`
+
+	Shards     int   `yaml:"shards"`
+	MaxEntries int   `yaml:"max_entries"`
+	MaxBytes   int64 `yaml:"max_bytes"`
+	// Eviction is "lru", "lfu" or "arc".
+	Eviction string `yaml:"eviction"`
+	TinyLFU  bool   `yaml:"tiny_lfu"`
+	// Hasher is "xxhash", "fnv" or "md5".
+	Hasher string `yaml:"hasher"`
+
+	// Codec is "gob" or "json".
+	Codec string `yaml:"codec"`
+	// Compression is "none", "snappy" or "gzip".
+	Compression   string `yaml:"compression"`
+	CompressMin   int64  `yaml:"compress_min"`
+	CopyOnReturn  bool   `yaml:"copy_on_return"`
+	MutationCheck bool   `yaml:"mutation_check"`
+
+	ResultRows   int   `yaml:"result_rows"`
+	ResultBytes  int64 `yaml:"result_bytes"`
+	MaxValueSize int64 `yaml:"max_value_size"`
+
+	// TTLs adapt when AdaptiveTTLMax is set.
+	AdaptiveTTLMin    time.Duration `yaml:"adaptive_ttl_min"`
+	AdaptiveTTLMax    time.Duration `yaml:"adaptive_ttl_max"`
+	AdaptiveTTLFactor float64       `yaml:"adaptive_ttl_factor"`
+
+	SlidingTTL  bool          `yaml:"sliding_ttl"`
+	MaxLifetime time.Duration `yaml:"max_lifetime"`
+	MaxIdle     time.Duration `yaml:"max_idle"`
+
+	NegativeTTL  time.Duration `yaml:"negative_ttl"`
+	StaleFor     time.Duration `yaml:"stale_for"`
+	RefreshAhead float64       `yaml:"refresh_ahead"`
+	MaxRefreshes int           `yaml:"max_refreshes"`
+
+	LoaderTimeout  time.Duration `yaml:"loader_timeout"`
+	StaleOnTimeout bool          `yaml:"stale_on_timeout"`
+	StaleOnError   bool          `yaml:"stale_on_error"`
+
+	// Loads are hedged when HedgePercentile is set. A replica is set
+	// with WithHedging.
+	HedgePercentile float64       `yaml:"hedge_percentile"`
+	HedgeMinDelay   time.Duration `yaml:"hedge_min_delay"`
+
+	LoadInterval    time.Duration `yaml:"load_interval"`
+	RetryAttempts   int           `yaml:"retry_attempts"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff"`
+
+	// The circuit breaker is set when CircuitFailures or
+	// CircuitFailureRate is.
+	CircuitFailures    int           `yaml:"circuit_failures"`
+	CircuitFailureRate float64       `yaml:"circuit_failure_rate"`
+	CircuitWindow      int           `yaml:"circuit_window"`
+	CircuitCooldown    time.Duration `yaml:"circuit_cooldown"`
+
+	PreparedStatements int           `yaml:"prepared_statements"`
+	BatchConcurrency   int           `yaml:"batch_concurrency"`
+	WarmConcurrency    int           `yaml:"warm_concurrency"`
+	SlowLoadThreshold  time.Duration `yaml:"slow_load_threshold"`
+	Expvar             string        `yaml:"expvar"`
+	PatternStats       bool          `yaml:"pattern_stats"`
+	// KeyTrace is the size of the ring of WithKeyTrace, tracing the keys
+	// starting with KeyTracePrefix.
+	KeyTrace       int    `yaml:"key_trace"`
+	KeyTracePrefix string `yaml:"key_trace_prefix"`
+
+	SnapshotPath     string        `yaml:"snapshot_path"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	AppendLogPath    string        `yaml:"append_log_path"`
+	AppendLogSync    time.Duration `yaml:"append_log_sync"`
+
+	// Namespaces tunes namespaces by name, as WithNamespaceConfig does.
+	// FromEnv leaves it alone.
+	Namespaces map[string]NamespaceConfig `yaml:"namespaces"`
+}
+
+// FromEnv overrides the fields of c with the environment variables named
+// after their yaml tags, upper-cased and prefixed with MEMCACHEDB_, such as
+// MEMCACHEDB_TTL=90s or MEMCACHEDB_MAX_ENTRIES=100000. Unset variables
+// leave their fields alone.
+func (c *Config) FromEnv() error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var errs []error
+	for i := 0; i < t.NumField(); i++ {
+		name := envPrefix + strings.ToUpper(t.Field(i).Tag.Get("yaml"))
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), s); err != nil {
+			errs = append(errs, fmt.Errorf("memcachedb: %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setField parses s into f.
+func setField(f reflect.Value, s string) error {
+	switch f.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(x)
+	}
+
+	return nil
+}
+
+// Validate reports the fields of c that are out of range or name nothing
+// the cache knows, all of them joined together.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("memcachedb: config %s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	for _, d := range []struct {
+		field string
+		value time.Duration
+	}{
+		{"ttl", c.TTL},
+		{"cleanup_interval", c.CleanupInterval},
+		{"negative_ttl", c.NegativeTTL},
+		{"adaptive_ttl_min", c.AdaptiveTTLMin},
+		{"adaptive_ttl_max", c.AdaptiveTTLMax},
+		{"max_lifetime", c.MaxLifetime},
+		{"max_idle", c.MaxIdle},
+		{"stale_for", c.StaleFor},
+		{"loader_timeout", c.LoaderTimeout},
+		{"load_interval", c.LoadInterval},
+		{"hedge_min_delay", c.HedgeMinDelay},
+		{"retry_backoff", c.RetryBackoff},
+		{"retry_max_backoff", c.RetryMaxBackoff},
+		{"circuit_cooldown", c.CircuitCooldown},
+		{"slow_load_threshold", c.SlowLoadThreshold},
+		{"snapshot_interval", c.SnapshotInterval},
+		{"append_log_sync", c.AppendLogSync},
+	} {
+		if d.value < 0 {
+			invalid(d.field, "negative duration %s", d.value)
+		}
+	}
+	for _, n := range []struct {
+		field string
+		value int64
+	}{
+		{"shards", int64(c.Shards)},
+		{"max_entries", int64(c.MaxEntries)},
+		{"max_bytes", c.MaxBytes},
+		{"compress_min", c.CompressMin},
+		{"result_rows", int64(c.ResultRows)},
+		{"result_bytes", c.ResultBytes},
+		{"max_value_size", c.MaxValueSize},
+		{"max_refreshes", int64(c.MaxRefreshes)},
+		{"retry_attempts", int64(c.RetryAttempts)},
+		{"circuit_failures", int64(c.CircuitFailures)},
+		{"circuit_window", int64(c.CircuitWindow)},
+		{"prepared_statements", int64(c.PreparedStatements)},
+		{"batch_concurrency", int64(c.BatchConcurrency)},
+		{"warm_concurrency", int64(c.WarmConcurrency)},
+		{"key_trace", int64(c.KeyTrace)},
+	} {
+		if n.value < 0 {
+			invalid(n.field, "negative value %d", n.value)
+		}
+	}
+	if c.Jitter < 0 || c.Jitter >= 1 {
+		invalid("jitter", "%v is not in [0, 1)", c.Jitter)
+	}
+	if c.RefreshAhead < 0 || c.RefreshAhead >= 1 {
+		invalid("refresh_ahead", "%v is not in [0, 1)", c.RefreshAhead)
+	}
+	if c.AdaptiveTTLFactor != 0 && c.AdaptiveTTLFactor <= 1 {
+		invalid("adaptive_ttl_factor", "%v is not above 1", c.AdaptiveTTLFactor)
+	}
+	if c.AdaptiveTTLMax > 0 && c.AdaptiveTTLMin > c.AdaptiveTTLMax {
+		invalid("adaptive_ttl_min", "%s is above adaptive_ttl_max", c.AdaptiveTTLMin)
+	}
+	if c.HedgePercentile < 0 || c.HedgePercentile >= 1 {
+		invalid("hedge_percentile", "%v is not in [0, 1)", c.HedgePercentile)
+	}
+	if c.CircuitFailureRate < 0 || c.CircuitFailureRate > 1 {
+		invalid("circuit_failure_rate", "%v is not in [0, 1]", c.CircuitFailureRate)
+	}
+	if _, ok := evictionPolicies[c.Eviction]; !ok && c.Eviction != "" {
+		invalid("eviction", "unknown policy %q", c.Eviction)
+	}
+	if _, ok := hashers[c.Hasher]; !ok && c.Hasher != "" {
+		invalid("hasher", "unknown hasher %q", c.Hasher)
+	}
+	if _, ok := codecs[c.Codec]; !ok && c.Codec != "" {
+		invalid("codec", "unknown codec %q", c.Codec)
+	}
+	if _, ok := compressions[c.Compression]; !ok && c.Compression != "" {
+		invalid("compression", "unknown algorithm %q", c.Compression)
+	}
+	names := make([]string, 0, len(c.Namespaces))
+	for name := range c.Namespaces {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		ns := c.Namespaces[name]
+		field := "namespaces." + name
+		switch {
+		case strings.Contains(name, ":"):
+			invalid(field, "name contains ':'")
+		case ns.TTL < 0:
+			invalid(field+".ttl", "negative duration %s", ns.TTL)
+		case ns.MaxEntries < 0:
+			invalid(field+".max_entries", "negative value %d", ns.MaxEntries)
+		case ns.MaxBytes < 0:
+			invalid(field+".max_bytes", "negative value %d", ns.MaxBytes)
+		}
+		if _, ok := evictionPolicies[ns.Eviction]; !ok && ns.Eviction != "" {
+			invalid(field+".eviction", "unknown policy %q", ns.Eviction)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+var (
+	evictionPolicies = map[string]EvictionPolicy{"lru": EvictLRU, "lfu": EvictLFU, "arc": EvictARC}
+	hashers          = map[string]Hasher{"xxhash": XXHash, "fnv": FNV, "md5": MD5}
+	codecs           = map[string]Codec{"gob": GobCodec, "json": JSONCodec}
+	compressions     = map[string]Compression{"none": 0, "snappy": CompressSnappy, "gzip": CompressGzip}
+)
+
+// Options returns the options setting the non-zero fields of c. Names that
+// Validate would reject are ignored.
+func (c Config) Options() []Option {
+	var opts []Option
+	add := func(set bool, opt Option) {
+		if set {
+			opts = append(opts, opt)
+		}
+	}
+
+	add(c.TTL > 0, WithDefaultTTL(c.TTL))
+	add(c.Jitter > 0, WithJitter(c.Jitter))
+	add(c.CleanupInterval > 0, WithCleanupInterval(c.CleanupInterval))
+	add(c.NoJanitor, WithoutJanitor())
+	add(c.Shards > 0, WithShards(c.Shards))
+	add(c.MaxEntries > 0, WithMaxEntries(c.MaxEntries))
+	add(c.MaxBytes > 0, WithMaxBytes(c.MaxBytes))
+	if p, ok := evictionPolicies[c.Eviction]; ok {
+		opts = append(opts, WithEvictionPolicy(p))
+	}
+	add(c.TinyLFU, WithTinyLFU())
+	if h, ok := hashers[c.Hasher]; ok {
+		opts = append(opts, WithHasher(h))
+	}
+
+	codec, ok := codecs[c.Codec]
+	if ok {
+		opts = append(opts, WithCodec(codec))
+	}
+	if algo := compressions[c.Compression]; algo != 0 {
+		opts = append(opts, WithCompression(algo, c.CompressMin))
+	}
+	if c.CopyOnReturn {
+		if codec == nil {
+			codec = GobCodec
+		}
+		opts = append(opts, WithCopyOnReturn(CloneWith(codec)))
+	}
+	add(c.MutationCheck, WithMutationCheck(false))
+
+	add(c.ResultRows > 0 || c.ResultBytes > 0, WithResultLimit(c.ResultRows, c.ResultBytes))
+	add(c.MaxValueSize > 0, WithMaxValueSize(c.MaxValueSize))
+
+	add(c.AdaptiveTTLMax > 0, WithAdaptiveTTL(AdaptiveTTL{
+		Min:    c.AdaptiveTTLMin,
+		Max:    c.AdaptiveTTLMax,
+		Factor: c.AdaptiveTTLFactor,
+	}))
+	add(c.SlidingTTL, WithSlidingTTL(c.MaxLifetime))
+	add(c.MaxIdle > 0, WithMaxIdle(c.MaxIdle))
+	add(c.NegativeTTL > 0, WithNegativeCaching(c.NegativeTTL))
+	add(c.StaleFor > 0 || c.MaxRefreshes > 0, WithStaleWhileRevalidate(c.StaleFor, c.MaxRefreshes))
+	add(c.RefreshAhead > 0, WithRefreshAhead(c.RefreshAhead))
+	add(c.LoaderTimeout > 0, WithLoaderTimeout(c.LoaderTimeout, c.StaleOnTimeout))
+	add(c.StaleOnError, WithStaleOnError(nil))
+	add(c.LoadInterval > 0, WithLoadInterval(c.LoadInterval))
+	add(c.HedgePercentile > 0, WithHedging(Hedging{Percentile: c.HedgePercentile, MinDelay: c.HedgeMinDelay}))
+	add(c.RetryAttempts > 1, WithRetryPolicy(RetryPolicy{
+		Attempts:   c.RetryAttempts,
+		Backoff:    c.RetryBackoff,
+		MaxBackoff: c.RetryMaxBackoff,
+	}))
+	add(c.CircuitFailures > 0 || c.CircuitFailureRate > 0, WithCircuitBreaker(Breaker{
+		Failures:    c.CircuitFailures,
+		FailureRate: c.CircuitFailureRate,
+		Window:      c.CircuitWindow,
+		Cooldown:    c.CircuitCooldown,
+	}))
+
+	add(c.PreparedStatements > 0, WithPreparedStatements(c.PreparedStatements))
+	add(c.BatchConcurrency > 0, WithBatchConcurrency(c.BatchConcurrency))
+	add(c.WarmConcurrency > 0, WithWarmConcurrency(c.WarmConcurrency))
+	add(c.SlowLoadThreshold > 0, WithSlowLoadThreshold(c.SlowLoadThreshold))
+	add(c.Expvar != "", WithExpvar(c.Expvar))
+	add(c.PatternStats, WithPatternStats())
+	if c.KeyTrace > 0 {
+		var match func(string) bool
+		if prefix := c.KeyTracePrefix; prefix != "" {
+			match = func(key string) bool { return strings.HasPrefix(key, prefix) }
+		}
+		opts = append(opts, WithKeyTrace(c.KeyTrace, match))
+	}
+
+	add(c.SnapshotPath != "", WithSnapshot(c.SnapshotPath, c.SnapshotInterval))
+	add(c.AppendLogPath != "", WithAppendLog(c.AppendLogPath, c.AppendLogSync))
+	for name, ns := range c.Namespaces {
+		opts = append(opts, WithNamespaceConfig(name, ns))
+	}
+
+	return opts
+}
@@ -0,0 +1,35 @@
+package memcachedb
+
+import "time"
+
+// ErrorPolicy decides which query errors are cached, so that callers share
+// a failure for a while instead of each retrying the query. The zero value
+// caches no errors.
+type ErrorPolicy struct {
+	// TTL is how long cached errors live. Errors are not cached when it is
+	// not positive.
+	TTL time.Duration
+	// Cacheable selects the errors to cache. Every error is cached when it
+	// is nil.
+	Cacheable func(err error) bool
+}
+
+// CacheNoErrors is the policy of never caching errors.
+func CacheNoErrors() ErrorPolicy {
+	return ErrorPolicy{}
+}
+
+// CacheAllErrors is the policy of caching every error for ttl.
+func CacheAllErrors(ttl time.Duration) ErrorPolicy {
+	return ErrorPolicy{TTL: ttl}
+}
+
+// CacheErrorsIf is the policy of caching the errors accepted by cacheable
+// for ttl.
+func CacheErrorsIf(ttl time.Duration, cacheable func(err error) bool) ErrorPolicy {
+	return ErrorPolicy{TTL: ttl, Cacheable: cacheable}
+}
+
+func (p ErrorPolicy) caches(err error) bool {
+	return p.TTL > 0 && (p.Cacheable == nil || p.Cacheable(err))
+}
@@ -0,0 +1,94 @@
+package memcachedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrStopped is returned for calls made after Stop.
+	ErrStopped = errors.New("memcachedb: cache is stopped")
+	// ErrNoDB is returned by calls that need the database when the cache
+	// was created without one.
+	ErrNoDB = errors.New("memcachedb: no database configured")
+	// ErrKeyEncoding is returned for arguments that cannot be encoded
+	// into a key, such as functions and channels.
+	ErrKeyEncoding = errors.New("memcachedb: argument cannot be encoded into a key")
+	// ErrValueTooLarge is returned by Set, and by loads along with their
+	// result, for values over the limit set by WithMaxValueSize. The value
+	// is not cached.
+	ErrValueTooLarge = errors.New("memcachedb: value too large to cache")
+	// ErrNotPersistable is returned when encoding a cached error or empty
+	// result, which do not outlive the process.
+	ErrNotPersistable = errors.New("memcachedb: entry is not persistable")
+	// ErrLoaderPanic is wrapped by the PanicError of a loader or query
+	// that panicked.
+	ErrLoaderPanic = errors.New("memcachedb: loader panicked")
+	// ErrTypeMismatch is returned when a cached value is not of the type
+	// the caller asks for, as when call sites sharing a key disagree.
+	ErrTypeMismatch = errors.New("memcachedb: cached value has another type")
+	// ErrLoaderTimeout is wrapped by the TimeoutError of a load cut off
+	// by WithLoaderTimeout.
+	ErrLoaderTimeout = errors.New("memcachedb: loader timed out")
+	// ErrCircuitOpen is returned by loads refused while the circuit
+	// breaker set by WithCircuitBreaker is open.
+	ErrCircuitOpen = errors.New("memcachedb: circuit open")
+)
+
+type (
+	// LoadError is the error of a failed load. It wraps the error of the
+	// query, so that errors.Is and errors.As see through it to
+	// sql.ErrNoRows, driver errors or a PanicError.
+	LoadError struct {
+		// Key is the key of the entry being loaded.
+		Key string
+		Err error
+	}
+
+	// PanicError is the error of a loader or query that panicked. It
+	// wraps ErrLoaderPanic.
+	PanicError struct {
+		// Value is what the loader panicked with.
+		Value interface{}
+		// Stack is the stack trace of the panicking goroutine.
+		Stack []byte
+	}
+
+	// TimeoutError is the error of a load cut off by WithLoaderTimeout.
+	// It wraps ErrLoaderTimeout and context.DeadlineExceeded.
+	TimeoutError struct {
+		// After is the bound the load ran into.
+		After time.Duration
+	}
+)
+
+func (e *LoadError) Error() string {
+	return "memcachedb: load " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrLoaderPanic, e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return ErrLoaderPanic
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v after %s", ErrLoaderTimeout, e.After)
+}
+
+func (e *TimeoutError) Unwrap() []error {
+	return []error{ErrLoaderTimeout, context.DeadlineExceeded}
+}
+
+// Timeout reports true, as net.Error does for timeouts.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
@@ -0,0 +1,60 @@
+package memcachedb
+
+// Reason tells why an entry left the cache.
+type Reason int
+
+const (
+	// ReasonExpired means the entry outlived its TTL.
+	ReasonExpired Reason = iota
+	// ReasonEvicted means the entry was evicted to keep the cache within
+	// its bounds.
+	ReasonEvicted
+	// ReasonInvalidated means the entry was removed explicitly.
+	ReasonInvalidated
+	// ReasonIdle means the entry went unread for longer than WithMaxIdle
+	// allows.
+	ReasonIdle
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonEvicted:
+		return "evicted"
+	case ReasonInvalidated:
+		return "invalidated"
+	case ReasonIdle:
+		return "idle"
+	default:
+		return "unknown"
+	}
+}
+
+// removed drops an entry that left the cache from the tag index and reports
+// it to the eviction callback.
+func (c *cache) removed(key string, v *Entry, reason Reason) {
+	c.untag(key, v.tags)
+	c.checkMutation(key, v)
+	if c.keyTrace != nil {
+		c.keyTrace.record(key, TraceRemoved, reason.String())
+	}
+	switch reason {
+	case ReasonInvalidated:
+		if c.journal != nil {
+			c.logDelete(key)
+		}
+		if c.l2 != nil {
+			c.tierDelete(c.l2, key)
+		}
+	case ReasonIdle:
+		// Only cold here: other processes sharing the L2 tier may
+		// still read it.
+		if c.journal != nil {
+			c.logDelete(key)
+		}
+	}
+	if c.onEvict != nil {
+		c.onEvict(key, v.Value(), reason)
+	}
+}
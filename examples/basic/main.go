@@ -0,0 +1,49 @@
+// Command basic shows read-through caching of a single query.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	memcachedb "memcache-database-module"
+)
+
+type user struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := sqlx.Open("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	c := memcachedb.New(db, memcachedb.WithDefaultTTL(time.Minute), memcachedb.WithContext(ctx))
+
+	getUser := func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		var u user
+		if err := db.GetContext(ctx, &u, "SELECT id, name FROM users WHERE id = $1", args...); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := c.DoContext(ctx, getUser, 42)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%+v\n", v.(user))
+	}
+}
@@ -0,0 +1,22 @@
+package memcachedb
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (c *cache) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if c.db == nil {
+		return nil, ErrNoDB
+	}
+
+	args, o := c.splitArgs(args)
+	res, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.invalidateWrites(writeTables(query), o)
+
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package memcachedb
+
+import (
+	"container/heap"
+	"sync"
+)
+
+type (
+	// expiryQueue orders cached entries by lifetime so that the janitor
+	// finds the expired ones without scanning the cache. Entries replaced
+	// or removed before they expire leave their item behind, to be
+	// discarded once it comes due.
+	expiryQueue struct {
+		mu    sync.Mutex
+		items expiryHeap
+	}
+
+	expiryItem struct {
+		key      string
+		lifetime int64
+	}
+
+	// expiryHeap is a min-heap of items by lifetime.
+	expiryHeap []expiryItem
+)
+
+func (q *expiryQueue) push(key string, lifetime int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	heap.Push(&q.items, expiryItem{key: key, lifetime: lifetime})
+}
+
+// due removes and returns the keys whose items expired before now.
+func (q *expiryQueue) due(now int64) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var keys []string
+	for len(q.items) > 0 && q.items[0].lifetime < now {
+		keys = append(keys, heap.Pop(&q.items).(expiryItem).key)
+	}
+
+	return keys
+}
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].lifetime < h[j].lifetime }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *expiryHeap) Push(x any) { *h = append(*h, x.(expiryItem)) }
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return it
+}
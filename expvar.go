@@ -0,0 +1,86 @@
+package memcachedb
+
+import (
+	"expvar"
+	"fmt"
+)
+
+// publish exposes the cache statistics and configuration as the expvar
+// variable name. Like expvar.Publish, it panics if name is already taken.
+func (c *cache) publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return map[string]any{
+			"stats":  c.Stats(),
+			"config": c.Settings(),
+		}
+	}))
+}
+
+func (c *cache) Settings() map[string]any {
+	cur := c.cur()
+	return map[string]any{
+		"ttl":             cur.ttl.String(),
+		"jitter":          cur.jitter,
+		"cleanup":         c.cleanupEvery().String(),
+		"janitor":         !c.noJanitor,
+		"shards":          len(c.shards),
+		"store":           c.storeName(),
+		"hasher":          name(c.hasher),
+		"max_entries":     cur.maxEntries,
+		"max_bytes":       cur.maxBytes,
+		"eviction":        cur.eviction.String(),
+		"tiny_lfu":        cur.tinyLFU,
+		"codec":           c.codecName(),
+		"compression":     c.compression.String(),
+		"result_rows":     cur.resultRows,
+		"result_bytes":    cur.resultBytes,
+		"max_value_size":  cur.maxValueSize,
+		"loader_timeout":  c.loaderTimeout.String(),
+		"retry_attempts":  c.retry.Attempts,
+		"load_interval":   c.loadInterval.String(),
+		"hedging":         c.hedging != nil,
+		"adaptive_ttl":    c.adaptive != nil,
+		"sliding_ttl":     c.sliding,
+		"max_idle":        c.maxIdle.String(),
+		"circuit_breaker": c.breaker != nil,
+		"stale_on_error":  c.staleOnError,
+		"clone":           c.clone != nil,
+		"mutation_check":  c.mutationCheck,
+		"memory_pressure": c.pressure != nil,
+		"statements":      c.stmtCount,
+		"pattern_stats":   c.patterns != nil,
+		"key_trace":       c.traceSize,
+		"namespaces":      len(c.profiles),
+		"l2":              c.l2 != nil,
+		"peers":           c.peers != nil,
+	}
+}
+
+// storeName names the type of the Store of the cache, or "sharded" for the
+// built-in one.
+func (c *cache) storeName() string {
+	if c.backend == nil {
+		return "sharded"
+	}
+
+	return name(c.backend)
+}
+
+// codecName names the Codec of the cache, or "none" when values are kept
+// as they are.
+func (c *cache) codecName() string {
+	if c.codec == nil {
+		return "none"
+	}
+
+	return name(c.codec)
+}
+
+// name names v by its String method, or else by its type.
+func name(v any) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", v)
+}
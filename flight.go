@@ -0,0 +1,108 @@
+package memcachedb
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	// flightGroup coalesces concurrent loads of the same key so that only
+	// one of them runs while the others wait for its result.
+	flightGroup struct {
+		mu    sync.Mutex
+		calls map[string]*flightCall
+
+		// onStart and onDone, if set, bracket every load. onStart runs
+		// before do returns to the caller that started the load.
+		onStart, onDone func()
+	}
+
+	flightCall struct {
+		done chan struct{}
+		val  interface{}
+		err  error
+		// panicked holds what fn panicked with, if it did.
+		panicked interface{}
+
+		// waiters counts the callers still waiting; the load is
+		// cancelled when the last of them gives up.
+		waiters int
+		cancel  context.CancelFunc
+	}
+)
+
+// do runs fn once for all concurrent callers of key and waits for its
+// result or for ctx to be done, whichever comes first. fn runs in the
+// background with a context carrying the values of ctx but none of its
+// deadline, so that no single caller cuts the load short for the others;
+// it is cancelled once every caller waiting for it has given up. shared
+// reports whether the load was started by another caller. A panic in fn
+// is raised again in every caller.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	fc, shared := g.calls[key]
+	if !shared {
+		lctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		fc = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = fc
+		if g.onStart != nil {
+			g.onStart()
+		}
+		go g.run(lctx, key, fc, fn)
+	}
+	fc.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-fc.done:
+		if fc.panicked != nil {
+			panic(fc.panicked)
+		}
+		return fc.val, fc.err, shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		fc.waiters--
+		if fc.waiters == 0 {
+			fc.cancel()
+			g.forget(key, fc)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err(), shared
+	}
+}
+
+func (g *flightGroup) run(ctx context.Context, key string, fc *flightCall, fn func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		fc.panicked = recover()
+		fc.cancel()
+		g.mu.Lock()
+		g.forget(key, fc)
+		g.mu.Unlock()
+		close(fc.done)
+		if g.onDone != nil {
+			g.onDone()
+		}
+	}()
+
+	fc.val, fc.err = fn(ctx)
+}
+
+// forget removes fc from the calls in flight, unless a later call for key
+// has already replaced it. The caller holds g.mu.
+func (g *flightGroup) forget(key string, fc *flightCall) {
+	if g.calls[key] == fc {
+		delete(g.calls, key)
+	}
+}
+
+// running reports whether a call for key is in flight.
+func (g *flightGroup) running(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	_, ok := g.calls[key]
+	return ok
+}
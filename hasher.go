@@ -0,0 +1,53 @@
+package memcachedb
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+type (
+	// Hasher derives the key of a call from the encoded form of its
+	// arguments.
+	Hasher interface {
+		Key(encoded []byte) string
+	}
+
+	// HasherFunc is a Hasher in the form of a function.
+	HasherFunc func(encoded []byte) string
+
+	namedHasher struct {
+		name string
+		HasherFunc
+	}
+)
+
+var (
+	// XXHash keys calls by the 64-bit xxHash of their arguments. It is
+	// the default.
+	XXHash Hasher = namedHasher{"xxhash", func(b []byte) string {
+		return fmt.Sprintf("%016x", xxhash.Sum64(b))
+	}}
+	// FNV keys calls by the 64-bit FNV-1a hash of their arguments.
+	FNV Hasher = namedHasher{"fnv", func(b []byte) string {
+		h := fnv.New64a()
+		h.Write(b)
+		return fmt.Sprintf("%016x", h.Sum64())
+	}}
+	// MD5 keys calls by the MD5 of their arguments, the hash the cache
+	// used before hashers could be chosen. It is slower than the others
+	// but has 128 bits, making collisions even less likely.
+	MD5 Hasher = namedHasher{"md5", func(b []byte) string {
+		return fmt.Sprintf("%x", md5.Sum(b))
+	}}
+)
+
+func (f HasherFunc) Key(encoded []byte) string {
+	return f(encoded)
+}
+
+func (h namedHasher) String() string {
+	return h.name
+}
@@ -0,0 +1,107 @@
+package memcachedb
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// minHedgeSamples is how many loads the latency distribution needs before
+// the hedging delay is derived from it.
+const minHedgeSamples = 100
+
+type (
+	// Hedging configures the hedged loads set by WithHedging.
+	Hedging struct {
+		// Percentile, such as 0.95, places the hedging delay within
+		// the distribution of load latencies.
+		Percentile float64
+		// MinDelay bounds the delay from below. It is the delay itself
+		// until 100 loads have been timed; loads are not hedged until
+		// then when it is zero.
+		MinDelay time.Duration
+		// Replica, if set, is where the second queries of GetContext,
+		// SelectContext and their variants run.
+		Replica *sqlx.DB
+	}
+
+	// hedgeKey marks the context of a second query.
+	hedgeKey struct{}
+)
+
+// IsHedge reports whether ctx is that of the second run of a query hedged
+// by WithHedging, which a query passed to DoContext may send to a replica.
+func IsHedge(ctx context.Context) bool {
+	hedge, _ := ctx.Value(hedgeKey{}).(bool)
+	return hedge
+}
+
+// hedgeDelay returns how long a query runs before it is hedged, or zero
+// if it is not.
+func (c *cache) hedgeDelay() time.Duration {
+	if c.hedging == nil {
+		return 0
+	}
+
+	h := c.stats.loadLatency.snapshot()
+	if h.Count < minHedgeSamples {
+		return c.hedging.MinDelay
+	}
+
+	return max(h.Quantile(c.hedging.Percentile), c.hedging.MinDelay)
+}
+
+// hedged runs query with run. Under WithHedging it runs query a second
+// time once the first run has not returned within the hedging delay, and
+// returns whichever succeeds first, cancelling the other.
+func (c *cache) hedged(ctx context.Context, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	delay := c.hedgeDelay()
+	if delay <= 0 {
+		return c.run(ctx, query)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		v   interface{}
+		err error
+	}
+	done := make(chan result, 2)
+	launch := func(ctx context.Context) {
+		go func() {
+			v, err := c.run(ctx, query)
+			done <- result{v, err}
+		}()
+	}
+
+	launch(ctx)
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-t.C:
+	}
+
+	c.stats.hedges.Add(1)
+	launch(context.WithValue(ctx, hedgeKey{}, true))
+	r := <-done
+	if r.err != nil {
+		if second := <-done; second.err == nil {
+			return second.v, nil
+		}
+	}
+
+	return r.v, r.err
+}
+
+// dbFor returns the database the queries of ctx run against.
+func (c *cache) dbFor(ctx context.Context) *sqlx.DB {
+	if c.hedging != nil && c.hedging.Replica != nil && IsHedge(ctx) {
+		return c.hedging.Replica
+	}
+
+	return c.db
+}
@@ -0,0 +1,89 @@
+package memcachedb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// loadLatencyBounds are the upper bounds of the load latency buckets.
+var loadLatencyBounds = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type (
+	// Histogram is a snapshot of a latency distribution.
+	Histogram struct {
+		// Bounds are the upper bounds of the buckets, in increasing order.
+		Bounds []time.Duration
+		// Counts holds the number of observations per bucket: Counts[i]
+		// counts those in (Bounds[i-1], Bounds[i]] and the extra last
+		// element those above every bound.
+		Counts []uint64
+		// Count is the total number of observations.
+		Count uint64
+		// Sum is the total of all observations.
+		Sum time.Duration
+	}
+
+	histogram struct {
+		counts [14]atomic.Uint64
+		count  atomic.Uint64
+		sum    atomic.Int64
+	}
+)
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(loadLatencyBounds) && d > loadLatencyBounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+	}
+
+	return Histogram{
+		Bounds: loadLatencyBounds,
+		Counts: counts,
+		Count:  h.count.Load(),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+}
+
+// Quantile returns the upper bound of the bucket holding the q-th quantile
+// of the observations, such as 0.99 for the 99th percentile, or zero when
+// there are none. Observations above every bound count as the last one.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(h.Count))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen > rank && i < len(h.Bounds) {
+			return h.Bounds[i]
+		}
+	}
+
+	return h.Bounds[len(h.Bounds)-1]
+}
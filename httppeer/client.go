@@ -0,0 +1,146 @@
+package httppeer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ttlHeader carries the time to live of an entry handed to its owner.
+const ttlHeader = "X-Memcachedb-Ttl"
+
+// client is a peer reached over HTTP.
+type client struct {
+	pool *Pool
+	base string
+}
+
+func (c *client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.pool.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(key), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.pool.compress > 0 {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	resp, err := c.pool.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, false, nil
+	default:
+		return nil, false, statusError(resp)
+	}
+
+	body, err := readBody(resp.Body, resp.Header)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return body, true, nil
+}
+
+func (c *client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, c.pool.timeout)
+	defer cancel()
+
+	body, gzipped, err := encodeBody(value, c.pool.compress)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(ttlHeader, strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	return c.send(req)
+}
+
+func (c *client) Delete(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.pool.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url(key), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.send(req)
+}
+
+func (c *client) send(req *http.Request) error {
+	resp, err := c.pool.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError(resp)
+	}
+
+	return nil
+}
+
+func (c *client) url(key string) string {
+	return c.base + url.PathEscape(key)
+}
+
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("httppeer: %s: %s: %s", resp.Request.URL, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// encodeBody gzips value when it is at least minSize bytes long and minSize
+// is positive.
+func encodeBody(value []byte, minSize int) ([]byte, bool, error) {
+	if minSize <= 0 || len(value) < minSize {
+		return value, false, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(value); err != nil {
+		return nil, false, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false, err
+	}
+
+	return buf.Bytes(), true, nil
+}
+
+// readBody reads r, gunzipping it when h says it is gzipped.
+func readBody(r io.Reader, h http.Header) ([]byte, error) {
+	if h.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,101 @@
+package httppeer
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	memcachedb "memcache-database-module"
+)
+
+// handler serves the local side of a cache to its peers.
+type handler struct {
+	pool  *Pool
+	local memcachedb.Peer
+}
+
+// Handler returns the http.Handler serving the entries of c to the other
+// processes of the group. Mount it at the path of the pool.
+func (p *Pool) Handler(c memcachedb.Cache) http.Handler {
+	return &handler{pool: p, local: c.Local()}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	escaped, ok := strings.CutPrefix(r.URL.EscapedPath(), h.pool.path)
+	if !ok || escaped == "" {
+		http.NotFound(w, r)
+		return
+	}
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, key)
+	case http.MethodPut:
+		h.set(w, r, key)
+	case http.MethodDelete:
+		if err := h.local.Delete(r.Context(), key); err != nil {
+			fail(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, key string) {
+	value, ok, err := h.local.Get(r.Context(), key)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, gzipped := value, false
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if body, gzipped, err = encodeBody(value, h.pool.compress); err != nil {
+			fail(w, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if gzipped {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Write(body)
+}
+
+func (h *handler) set(w http.ResponseWriter, r *http.Request, key string) {
+	value, err := readBody(r.Body, r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ms, _ := strconv.ParseInt(r.Header.Get(ttlHeader), 10, 64)
+
+	if err := h.local.Set(r.Context(), key, value, time.Duration(ms)*time.Millisecond); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func fail(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, memcachedb.ErrStopped) {
+		code = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,127 @@
+package httppeer
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	memcachedb "memcache-database-module"
+)
+
+// hotAfter is the number of times a key must be fetched from its owner
+// within a round of counting for it to be mirrored.
+const hotAfter = 3
+
+type (
+	// mirror is a peer that keeps local copies of its hottest entries.
+	mirror struct {
+		memcachedb.Peer
+		size int
+		ttl  time.Duration
+
+		mu      sync.Mutex
+		lru     *list.List
+		entries map[string]*list.Element
+		// fetches counts fetches per key. It is reset once it tracks
+		// more keys than four times size, so that it only reflects
+		// recent traffic.
+		fetches map[string]int
+	}
+
+	mirrored struct {
+		key     string
+		value   []byte
+		expires time.Time
+	}
+)
+
+func newMirror(p memcachedb.Peer, size int, ttl time.Duration) *mirror {
+	return &mirror{
+		Peer:    p,
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		fetches: make(map[string]int),
+	}
+}
+
+func (m *mirror) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if value, ok := m.lookup(key); ok {
+		return value, true, nil
+	}
+
+	value, ok, err := m.Peer.Get(ctx, key)
+	if err != nil || !ok {
+		return value, ok, err
+	}
+	m.fetched(key, value)
+
+	return value, true, nil
+}
+
+func (m *mirror) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.forget(key)
+	return m.Peer.Set(ctx, key, value, ttl)
+}
+
+func (m *mirror) Delete(ctx context.Context, key string) error {
+	m.forget(key)
+	return m.Peer.Delete(ctx, key)
+}
+
+func (m *mirror) lookup(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*mirrored)
+	if time.Now().After(e.expires) {
+		m.lru.Remove(el)
+		delete(m.entries, key)
+		return nil, false
+	}
+	m.lru.MoveToFront(el)
+
+	return e.value, true
+}
+
+// fetched counts a fetch of key from its owner and mirrors value once the
+// key turns out to be hot.
+func (m *mirror) fetched(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.fetches) >= 4*m.size {
+		clear(m.fetches)
+	}
+	m.fetches[key]++
+	if m.fetches[key] < hotAfter {
+		return
+	}
+	delete(m.fetches, key)
+
+	if el, ok := m.entries[key]; ok {
+		m.lru.Remove(el)
+	}
+	m.entries[key] = m.lru.PushFront(&mirrored{key: key, value: value, expires: time.Now().Add(m.ttl)})
+	for m.lru.Len() > m.size {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.entries, oldest.Value.(*mirrored).key)
+	}
+}
+
+func (m *mirror) forget(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.entries[key]; ok {
+		m.lru.Remove(el)
+		delete(m.entries, key)
+	}
+}
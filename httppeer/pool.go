@@ -0,0 +1,143 @@
+// Package httppeer connects the processes of a memcachedb peer group over
+// HTTP. Every process runs a Pool, which picks the owners of keys and serves
+// the requests of the others:
+//
+//	pool := httppeer.NewPool("http://10.0.0.1:8080")
+//	c := memcachedb.New(db, memcachedb.WithPeers(pool))
+//	http.Handle(httppeer.DefaultPath, pool.Handler(c))
+//	pool.Set("http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080")
+//
+// Set can be called again whenever the membership of the group changes.
+package httppeer
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	memcachedb "memcache-database-module"
+)
+
+const (
+	// DefaultPath is where the pool of each process serves its peers.
+	DefaultPath = "/_memcachedb/"
+
+	defaultTimeout     = time.Second
+	defaultCompression = 1024
+)
+
+type (
+	// Pool is a memcachedb.PeerPicker reaching the peers of a group over
+	// HTTP.
+	Pool struct {
+		self     string
+		path     string
+		client   *http.Client
+		timeout  time.Duration
+		compress int
+		replicas int
+
+		mirrorSize int
+		mirrorTTL  time.Duration
+
+		ring *memcachedb.Ring
+	}
+
+	// Option configures a Pool.
+	Option func(p *Pool)
+)
+
+var _ memcachedb.PeerPicker = (*Pool)(nil)
+
+// WithPath serves and reaches peers under path instead of DefaultPath. It
+// must be the same throughout the group.
+func WithPath(path string) Option {
+	return func(p *Pool) {
+		p.path = path
+	}
+}
+
+// WithClient sends the requests to peers with client instead of
+// http.DefaultClient.
+func WithClient(client *http.Client) Option {
+	return func(p *Pool) {
+		p.client = client
+	}
+}
+
+// WithTimeout bounds each request to a peer, after which the caller gives
+// up on the peer and runs its query itself. It defaults to one second.
+func WithTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.timeout = d
+	}
+}
+
+// WithCompression gzips entries of at least minSize bytes on the wire, in
+// both directions. It defaults to 1 KiB; a minSize that is not positive
+// turns compression off.
+func WithCompression(minSize int) Option {
+	return func(p *Pool) {
+		p.compress = minSize
+	}
+}
+
+// WithReplicas sets the number of points each process has on the hash ring.
+// See memcachedb.NewRing.
+func WithReplicas(n int) Option {
+	return func(p *Pool) {
+		p.replicas = n
+	}
+}
+
+// WithHotMirror keeps local copies of up to entries entries that this
+// process keeps fetching from their owners, for ttl each, so that a few
+// very hot keys do not pin the load on a single peer. Invalidations made
+// through this process drop its copies; others reach them only when ttl
+// runs out, so keep it short.
+func WithHotMirror(entries int, ttl time.Duration) Option {
+	return func(p *Pool) {
+		p.mirrorSize = entries
+		p.mirrorTTL = ttl
+	}
+}
+
+// NewPool returns a Pool for the process reachable at the base URL self.
+// It owns every key until Set names the group.
+func NewPool(self string, opts ...Option) *Pool {
+	p := &Pool{
+		self:     strings.TrimSuffix(self, "/"),
+		path:     DefaultPath,
+		client:   http.DefaultClient,
+		timeout:  defaultTimeout,
+		compress: defaultCompression,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.ring = memcachedb.NewRing(p.self, p.replicas)
+
+	return p
+}
+
+// Set replaces the members of the group with the processes at the base
+// URLs peers, which may include that of the pool itself.
+func (p *Pool) Set(peers ...string) {
+	m := make(map[string]memcachedb.Peer, len(peers))
+	for _, base := range peers {
+		base = strings.TrimSuffix(base, "/")
+		if base == p.self {
+			continue
+		}
+		var peer memcachedb.Peer = &client{pool: p, base: base + p.path}
+		if p.mirrorSize > 0 && p.mirrorTTL > 0 {
+			peer = newMirror(peer, p.mirrorSize, p.mirrorTTL)
+		}
+		m[base] = peer
+	}
+	p.ring.Set(m)
+}
+
+func (p *Pool) PickPeer(key string) (memcachedb.Peer, bool) {
+	return p.ring.PickPeer(key)
+}
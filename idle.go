@@ -0,0 +1,45 @@
+package memcachedb
+
+// idle reports whether e, found under key in s, has gone unread for longer
+// than WithMaxIdle allows, removing it if so.
+func (c *cache) idle(s segment, key string, e *Entry) bool {
+	if c.maxIdle <= 0 || e.usage == nil {
+		return false
+	}
+	if e.usage.accessed.Load() >= c.now()-int64(c.maxIdle) {
+		return false
+	}
+
+	if v, ok := s.deleteIf(key, e.same); ok {
+		c.stats.idle.Add(1)
+		c.removed(key, v, ReasonIdle)
+	}
+
+	return true
+}
+
+// sweepIdle removes the entries unread since WithMaxIdle before now,
+// returning how many.
+func (c *cache) sweepIdle(now int64) int {
+	since := now - int64(c.maxIdle)
+	cold := func(v *Entry) bool {
+		return v.usage != nil && v.usage.accessed.Load() < since
+	}
+
+	n := 0
+	for _, s := range c.shards {
+		s.scan(func(key string, v *Entry) bool {
+			if !cold(v) {
+				return true
+			}
+			if v, ok := s.deleteIf(key, cold); ok {
+				n++
+				c.removed(key, v, ReasonIdle)
+			}
+			return true
+		})
+	}
+	c.stats.idle.Add(uint64(n))
+
+	return n
+}
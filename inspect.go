@@ -0,0 +1,139 @@
+package memcachedb
+
+import "time"
+
+// EntryInfo describes a cached entry, as returned by Inspect. Times are
+// zero where unknown: entries restored from snapshots taken by older
+// versions have no creation time, and those kept by a Store as bytes count
+// no hits.
+type EntryInfo struct {
+	// Created is when the entry was cached.
+	Created time.Time
+	// Stale, if set, is when the entry starts being served stale while
+	// refreshed, as set by WithStaleWhileRevalidate.
+	Stale time.Time
+	// Expires is when the entry leaves the cache.
+	Expires time.Time
+	// Hits counts the calls served the entry.
+	Hits uint64
+	// LastAccess is when the entry was last hit; zero if it never was.
+	LastAccess time.Time
+	// Size is the cost of the entry under WithCost, or else an estimate
+	// of its memory use.
+	Size int64
+	// Tags are the tags of the entry, the tables of its query among them.
+	Tags []string
+	// Negative marks an empty result cached by WithNegativeCaching, and
+	// Err an error cached by WithErrorPolicy.
+	Negative bool
+	Err      error
+}
+
+// newUsage returns the usage of an entry cached at now.
+func newUsage(now int64) *usage {
+	u := new(usage)
+	u.accessed.Store(now)
+
+	return u
+}
+
+func (c *cache) Inspect(key string) (EntryInfo, bool) {
+	if !c.begin() {
+		return EntryInfo{}, false
+	}
+	defer c.end()
+
+	s := c.shard(key)
+	e, ok := s.lookup(key)
+	if !ok || c.expired(s, key, e) {
+		return EntryInfo{}, false
+	}
+
+	return c.info(key, e), true
+}
+
+func (c *cache) TTL(key string) (time.Duration, bool) {
+	if !c.begin() {
+		return 0, false
+	}
+	defer c.end()
+
+	s := c.shard(key)
+	e, ok := s.lookup(key)
+	if !ok || c.expired(s, key, e) {
+		return 0, false
+	}
+	end := e.lifetime
+	if e.fresh != 0 {
+		end = e.fresh
+	}
+
+	return max(time.Duration(end-c.now()), 0), true
+}
+
+// Range walks the shards one at a time, each from a copy of its entries
+// taken at once, so that fn runs without holding any lock and may call
+// the cache.
+func (c *cache) Range(fn func(key string, info EntryInfo) bool) {
+	if !c.begin() {
+		return
+	}
+	defer c.end()
+
+	now := c.now()
+	for _, s := range c.shards {
+		more := true
+		s.scan(func(key string, e *Entry) bool {
+			if e.lifetime < now {
+				return true
+			}
+			more = fn(key, c.info(key, e))
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
+
+// info describes e, cached under key.
+func (c *cache) info(key string, e *Entry) EntryInfo {
+	info := EntryInfo{
+		Created:  unixTime(e.created),
+		Stale:    unixTime(e.fresh),
+		Expires:  unixTime(e.lifetime),
+		Size:     e.size,
+		Tags:     append([]string(nil), e.tags...),
+		Negative: e.negative,
+		Err:      e.err,
+	}
+	if info.Size == 0 {
+		// Only tracked under a byte budget.
+		switch {
+		case c.cost != nil:
+			info.Size = c.cost(key, e.Value())
+		case e.packed != nil:
+			info.Size = int64(len(key) + len(e.packed))
+		default:
+			info.Size = int64(len(key)) + estimateSize(e.value)
+		}
+	}
+	if e.usage != nil {
+		info.Hits = e.usage.hits.Load()
+		if info.Hits > 0 {
+			info.LastAccess = unixTime(e.usage.accessed.Load())
+		}
+	}
+
+	return info
+}
+
+// unixTime returns the time of ns nanoseconds since the Unix epoch, or the
+// zero time if ns is zero.
+func unixTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ns)
+}
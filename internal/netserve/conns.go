@@ -0,0 +1,96 @@
+// Package netserve holds the connection handling the protocol servers of
+// memcachedb share.
+package netserve
+
+import (
+	"net"
+	"sync"
+)
+
+// Conns accepts the connections of a server and keeps track of them, so
+// that Close shuts them all down. Its zero value is ready to use.
+type Conns struct {
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// Serve accepts connections on l until Close is called, and then returns
+// net.ErrClosed. Each connection is handled by handle on a goroutine of its
+// own, and closed once handle returns.
+func (c *Conns) Serve(l net.Listener, handle func(conn net.Conn)) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	c.listener = l
+	c.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			c.mu.Lock()
+			closed := c.closed
+			c.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+		if !c.track(conn) {
+			conn.Close()
+			return net.ErrClosed
+		}
+		go func() {
+			defer c.untrack(conn)
+			handle(conn)
+		}()
+	}
+}
+
+// Close closes the listener and the connections, and waits for their
+// handlers to return.
+func (c *Conns) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	var err error
+	if c.listener != nil {
+		err = c.listener.Close()
+	}
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	return err
+}
+
+func (c *Conns) track(conn net.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	if c.conns == nil {
+		c.conns = make(map[net.Conn]struct{})
+	}
+	c.conns[conn] = struct{}{}
+	c.wg.Add(1)
+
+	return true
+}
+
+func (c *Conns) untrack(conn net.Conn) {
+	conn.Close()
+	c.mu.Lock()
+	delete(c.conns, conn)
+	c.mu.Unlock()
+	c.wg.Done()
+}
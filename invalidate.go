@@ -0,0 +1,76 @@
+package memcachedb
+
+import "strings"
+
+func (c *cache) Invalidate(args ...interface{}) error {
+	args, _ = c.splitArgs(args)
+	h, _, err := c.hash(args...)
+	if err != nil {
+		return err
+	}
+	c.InvalidateKey(h)
+
+	return nil
+}
+
+func (c *cache) InvalidateKey(key string) bool {
+	if owner, remote := c.owner(key); remote {
+		c.tierDelete(owner, key)
+		if c.l2 != nil {
+			c.tierDelete(c.l2, key)
+		}
+	}
+
+	return c.flush([]string{key}, ReasonInvalidated) > 0
+}
+
+func (c *cache) FlushAll() int {
+	return c.FlushPrefix("")
+}
+
+func (c *cache) FlushPrefix(prefix string) int {
+	if !c.begin() {
+		return 0
+	}
+	defer c.end()
+
+	n := 0
+	for _, s := range c.shards {
+		s.scan(func(key string, e *Entry) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return true
+			}
+			if v, ok := s.deleteIf(key, e.same); ok {
+				n++
+				c.removed(key, v, ReasonInvalidated)
+			}
+			return true
+		})
+	}
+	if c.l2 != nil {
+		c.tierFlush(c.l2, prefix)
+	}
+	c.logger.Info("memcachedb: flushed", "prefix", prefix, "removed", n)
+
+	return n
+}
+
+func (c *cache) InvalidateWhere(match func(key string, value interface{}) bool) int {
+	n := 0
+	for _, s := range c.shards {
+		// match runs without the shard lock so it may use the cache; an
+		// entry replaced in the meantime is left alone.
+		s.scan(func(key string, e *Entry) bool {
+			if !match(key, e.Value()) {
+				return true
+			}
+			if v, ok := s.deleteIf(key, e.same); ok {
+				n++
+				c.removed(key, v, ReasonInvalidated)
+			}
+			return true
+		})
+	}
+
+	return n
+}
@@ -0,0 +1,178 @@
+package memcachedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc64"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxKeyDepth bounds the nesting of encoded arguments, which also stops
+// cyclic values.
+const maxKeyDepth = 32
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// encodeKey writes the canonical form of args to buf: equal arguments
+// always encode alike, whatever the iteration order of their maps or the
+// addresses of their pointers, and arguments of different types never do.
+func encodeKey(buf *bytes.Buffer, args []interface{}) error {
+	for _, arg := range args {
+		if err := encodeTyped(buf, reflect.ValueOf(arg), 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeTyped writes the type of v before its value.
+func encodeTyped(buf *bytes.Buffer, v reflect.Value, depth int) error {
+	if !v.IsValid() {
+		buf.WriteByte('n')
+		return nil
+	}
+	buf.WriteByte('t')
+	writeString(buf, v.Type().String())
+
+	return encodeValue(buf, v, depth)
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value, depth int) error {
+	if depth > maxKeyDepth {
+		return fmt.Errorf("%w: %s nests too deeply or is cyclic", ErrKeyEncoding, v.Type())
+	}
+
+	// Times encode as the instant they denote, leaving out their location
+	// and monotonic clock reading.
+	if v.Type() == timeType && v.CanInterface() {
+		writeInt(buf, v.Interface().(time.Time).UnixNano())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint(buf, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeUint(buf, math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		writeUint(buf, math.Float64bits(real(v.Complex())))
+		writeUint(buf, math.Float64bits(imag(v.Complex())))
+	case reflect.String:
+		writeString(buf, v.String())
+	case reflect.Pointer:
+		if v.IsNil() {
+			buf.WriteByte('n')
+			return nil
+		}
+		buf.WriteByte('p')
+		return encodeValue(buf, v.Elem(), depth+1)
+	case reflect.Interface:
+		return encodeTyped(buf, v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			writeString(buf, string(v.Bytes()))
+			return nil
+		}
+		writeUint(buf, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(buf, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return encodeMap(buf, v, depth)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			writeString(buf, t.Field(i).Name)
+			if err := encodeValue(buf, v.Field(i), depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrKeyEncoding, v.Type())
+	}
+
+	return nil
+}
+
+// encodeMap writes the entries of v sorted by the encoding of their keys.
+func encodeMap(buf *bytes.Buffer, v reflect.Value, depth int) error {
+	entries := make([][]byte, 0, v.Len())
+	for it := v.MapRange(); it.Next(); {
+		var entry bytes.Buffer
+		if err := encodeValue(&entry, it.Key(), depth+1); err != nil {
+			return err
+		}
+		k := entry.Len()
+		if err := encodeValue(&entry, it.Value(), depth+1); err != nil {
+			return err
+		}
+		// Prefix the entry with the length of its key so that sorting
+		// compares keys alone.
+		e := binary.AppendUvarint(nil, uint64(k))
+		entries = append(entries, append(e, entry.Bytes()...))
+	}
+	slices.SortFunc(entries, func(a, b []byte) int {
+		ka, na := binary.Uvarint(a)
+		kb, nb := binary.Uvarint(b)
+		return bytes.Compare(a[na:na+int(ka)], b[nb:nb+int(kb)])
+	})
+
+	writeUint(buf, uint64(len(entries)))
+	for _, e := range entries {
+		buf.Write(e)
+	}
+
+	return nil
+}
+
+func writeInt(buf *bytes.Buffer, n int64) {
+	buf.Write(binary.AppendVarint(buf.AvailableBuffer(), n))
+}
+
+func writeUint(buf *bytes.Buffer, n uint64) {
+	buf.Write(binary.AppendUvarint(buf.AvailableBuffer(), n))
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+var fingerprintTable = crc64.MakeTable(crc64.ECMA)
+
+// fingerprint returns the CRC-64 of encoded arguments, never zero.
+func fingerprint(encoded []byte) uint64 {
+	return crc64.Checksum(encoded, fingerprintTable) | 1
+}
+
+// matches reports whether v was cached for the arguments fingerprinted as
+// fp. Entries cached by key and calls made by key match anything.
+func (v *Entry) matches(fp uint64) bool {
+	return v.fingerprint == 0 || fp == 0 || v.fingerprint == fp
+}
+
+// flightKey returns the key under which the load for key described by o is
+// coalesced, keeping apart loads of colliding arguments.
+func flightKey(key string, o callOptions) string {
+	if o.fingerprint == 0 {
+		return key
+	}
+
+	return key + "\x00" + strconv.FormatUint(o.fingerprint, 16)
+}
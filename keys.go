@@ -0,0 +1,77 @@
+package memcachedb
+
+import (
+	"container/heap"
+	"path"
+	"sort"
+	"strings"
+)
+
+// keyPage holds the smallest keys met so far, the largest on top, so that a
+// page of n keys costs memory for n keys rather than for every match.
+type keyPage []string
+
+func (p keyPage) Len() int           { return len(p) }
+func (p keyPage) Less(i, j int) bool { return p[i] > p[j] }
+func (p keyPage) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p *keyPage) Push(x any)        { *p = append(*p, x.(string)) }
+func (p *keyPage) Pop() any {
+	old := *p
+	x := old[len(old)-1]
+	*p = old[:len(old)-1]
+	return x
+}
+
+func (c *cache) Keys(pattern string, limit int, cursor string) ([]string, string, error) {
+	return c.pageKeys(c.shards, "", pattern, limit, cursor)
+}
+
+// pageKeys returns a page of the keys of the unexpired entries of segments
+// that start with prefix, trimmed of it, as Cache.Keys does.
+func (c *cache) pageKeys(segments []segment, prefix, pattern string, limit int, cursor string) ([]string, string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, "", err
+	}
+	if !c.begin() {
+		return nil, "", ErrStopped
+	}
+	defer c.end()
+
+	now := c.now()
+	var page keyPage
+	for _, s := range segments {
+		s.scan(func(key string, e *Entry) bool {
+			name, ok := strings.CutPrefix(key, prefix)
+			if !ok || e.lifetime < now || (cursor != "" && name <= cursor) {
+				return true
+			}
+			if pattern != "" {
+				if ok, _ := path.Match(pattern, name); !ok {
+					return true
+				}
+			}
+			switch {
+			case limit <= 0:
+				page = append(page, name)
+			case page.Len() <= limit:
+				// One more than the page holds tells whether another
+				// page follows.
+				heap.Push(&page, name)
+			case name < page[0]:
+				page[0] = name
+				heap.Fix(&page, 0)
+			}
+			return true
+		})
+	}
+
+	keys := []string(page)
+	sort.Strings(keys)
+	next := ""
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+
+	return keys, next, nil
+}
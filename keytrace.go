@@ -0,0 +1,141 @@
+package memcachedb
+
+import (
+	"sync"
+	"time"
+)
+
+// Kinds of TraceEvent.
+const (
+	// TraceCreated means a loaded or set value was cached under a key
+	// holding none.
+	TraceCreated TraceKind = iota
+	// TraceReplaced means a value was cached in place of another, as by
+	// a refresh.
+	TraceReplaced
+	// TraceRejected means a value was left uncached, turned away by the
+	// admission filter of WithTinyLFU.
+	TraceRejected
+	// TraceHit means a call was served the cached value.
+	TraceHit
+	// TraceStaleHit means a call was served the cached value stale while
+	// it is refreshed.
+	TraceStaleHit
+	// TraceMiss means a call found no entry to serve.
+	TraceMiss
+	// TraceRefresh means a background refresh of the entry started.
+	TraceRefresh
+	// TraceLoadFailed means a query of the key failed; the detail of the
+	// event is its error.
+	TraceLoadFailed
+	// TraceRemoved means the entry left the cache; the detail of the
+	// event is the Reason why.
+	TraceRemoved
+)
+
+type (
+	// TraceKind tells what a TraceEvent records.
+	TraceKind int
+
+	// TraceEvent is something that happened to a key, as recorded by
+	// WithKeyTrace.
+	TraceEvent struct {
+		Time   time.Time
+		Key    string
+		Kind   TraceKind
+		Detail string
+	}
+
+	// keyTrace keeps the latest events of the keys it matches in a ring.
+	keyTrace struct {
+		match func(key string) bool
+		clock Clock
+
+		mu     sync.Mutex
+		events []TraceEvent
+		// next is where the next event goes; the ring is full once it
+		// wraps around.
+		next int
+		full bool
+	}
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceCreated:
+		return "created"
+	case TraceReplaced:
+		return "replaced"
+	case TraceRejected:
+		return "rejected"
+	case TraceHit:
+		return "hit"
+	case TraceStaleHit:
+		return "stale hit"
+	case TraceMiss:
+		return "miss"
+	case TraceRefresh:
+		return "refresh"
+	case TraceLoadFailed:
+		return "load failed"
+	case TraceRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes k as its name, so that traces read well as JSON.
+func (k TraceKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func newKeyTrace(size int, match func(key string) bool, clock Clock) *keyTrace {
+	return &keyTrace{match: match, clock: clock, events: make([]TraceEvent, size)}
+}
+
+// record adds an event of kind for key, if it is traced. It is a no-op on a
+// nil keyTrace.
+func (t *keyTrace) record(key string, kind TraceKind, detail string) {
+	if t == nil || (t.match != nil && !t.match(key)) {
+		return
+	}
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events[t.next] = TraceEvent{Time: now, Key: key, Kind: kind, Detail: detail}
+	t.next++
+	if t.next == len(t.events) {
+		t.next, t.full = 0, true
+	}
+}
+
+// list returns the recorded events of key, or of every key if key is
+// empty, oldest first.
+func (t *keyTrace) list(key string) []TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ring := t.events[:t.next]
+	if t.full {
+		ring = append(append([]TraceEvent(nil), t.events[t.next:]...), ring...)
+	}
+	var events []TraceEvent
+	for _, ev := range ring {
+		if key == "" || ev.Key == key {
+			events = append(events, ev)
+		}
+	}
+
+	return events
+}
+
+func (c *cache) Trace(key string) []TraceEvent {
+	if c.keyTrace == nil {
+		return nil
+	}
+
+	return c.keyTrace.list(key)
+}
@@ -0,0 +1,125 @@
+package memcachedb
+
+import "container/heap"
+
+type (
+	// lfu evicts the least frequently used key, breaking ties by evicting
+	// the one accessed longest ago. Frequencies are halved every ten
+	// accesses per key, so that keys hot once and cold since get evicted
+	// in time.
+	lfu struct {
+		items    map[string]*lfuItem
+		heap     lfuHeap
+		tick     uint64
+		accesses int
+	}
+
+	lfuItem struct {
+		key   string
+		freq  uint64
+		tick  uint64
+		index int
+	}
+
+	lfuHeap []*lfuItem
+)
+
+// minAgePeriod is the fewest accesses between two agings of an lfu, which
+// keeps small ones from forgetting their frequencies right away.
+const minAgePeriod = 1024
+
+func newLFU() *lfu {
+	return &lfu{items: make(map[string]*lfuItem)}
+}
+
+func (p *lfu) add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.touch(key)
+		return
+	}
+	p.tick++
+	it := &lfuItem{key: key, freq: 1, tick: p.tick}
+	p.items[key] = it
+	heap.Push(&p.heap, it)
+	p.age()
+}
+
+func (p *lfu) touch(key string) {
+	it, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.tick++
+	it.freq++
+	it.tick = p.tick
+	heap.Fix(&p.heap, it.index)
+	p.age()
+}
+
+// age counts an access and halves the frequencies once the period is over.
+func (p *lfu) age() {
+	p.accesses++
+	if p.accesses < max(10*len(p.items), minAgePeriod) {
+		return
+	}
+	p.accesses = 0
+	for _, it := range p.heap {
+		it.freq /= 2
+	}
+	heap.Init(&p.heap)
+}
+
+func (p *lfu) remove(key string) {
+	if it, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, it.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfu) victim() (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	it := heap.Pop(&p.heap).(*lfuItem)
+	delete(p.items, it.key)
+
+	return it.key, true
+}
+
+func (p *lfu) peek() (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	return p.heap[0].key, true
+}
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	it := x.(*lfuItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return it
+}
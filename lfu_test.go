@@ -0,0 +1,101 @@
+package memcachedb
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// hitRatio runs a zipfian workload over a cache of 100 entries evicting by
+// policy, with a one-off scan of ten times as many keys as the cache holds
+// halfway through, and returns the share of the calls that hit.
+func hitRatio(t *testing.T, policy EvictionPolicy) float64 {
+	c := New(nil, WithoutJanitor(), WithShards(1), WithMaxEntries(100), WithEvictionPolicy(policy))
+	defer c.Stop(context.Background())
+
+	query := func(_ context.Context, args ...interface{}) (interface{}, error) {
+		return args[0], nil
+	}
+	get := func(key string) {
+		if _, err := c.DoContext(context.Background(), query, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	zipf := rand.NewZipf(rand.New(rand.NewPCG(1, 2)), 1.1, 1, 10000)
+	for i := 0; i < 20000; i++ {
+		get(fmt.Sprint("k", zipf.Uint64()))
+	}
+	for i := 0; i < 1000; i++ {
+		get(fmt.Sprint("scan", i))
+	}
+	for i := 0; i < 20000; i++ {
+		get(fmt.Sprint("k", zipf.Uint64()))
+	}
+
+	s := c.Stats()
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func TestLFUHitRatio(t *testing.T) {
+	lru, lfu := hitRatio(t, EvictLRU), hitRatio(t, EvictLFU)
+	if lfu <= lru {
+		t.Errorf("hit ratio of LFU = %.3f, not above the %.3f of LRU", lfu, lru)
+	}
+}
+
+func TestLFUEvictionOrder(t *testing.T) {
+	p := newLFU()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		p.add(key)
+	}
+	p.touch("a")
+	p.touch("a")
+	p.touch("c")
+	p.remove("d")
+
+	// b and the removed d were used once; of a, used three times, and c,
+	// used twice, c goes first.
+	for _, want := range []string{"b", "c", "a"} {
+		if key, ok := p.peek(); !ok || key != want {
+			t.Errorf("peek = %q, %v, want %q", key, ok, want)
+		}
+		if key, ok := p.victim(); !ok || key != want {
+			t.Errorf("victim = %q, %v, want %q", key, ok, want)
+		}
+	}
+	if key, ok := p.victim(); ok {
+		t.Errorf("victim of an empty lfu = %q", key)
+	}
+
+	// Among keys used as often, the least recently used goes first.
+	p.add("x")
+	p.add("y")
+	p.touch("x")
+	p.touch("y")
+	if key, _ := p.victim(); key != "x" {
+		t.Errorf("victim = %q, want x, used longest ago", key)
+	}
+}
+
+func TestLFUAging(t *testing.T) {
+	p := newLFU()
+	p.add("old")
+	for i := 0; i < 1000; i++ {
+		p.touch("old")
+	}
+
+	// new ends up used less often than old overall, but more often since
+	// the frequencies were last halved.
+	p.add("new")
+	for i := 0; i < 600; i++ {
+		p.touch("new")
+	}
+	if it := p.items["old"]; it.freq >= 1001 {
+		t.Errorf("frequency of old = %d, not halved", it.freq)
+	}
+	if key, _ := p.victim(); key != "old" {
+		t.Errorf("victim = %q, want old, which went cold", key)
+	}
+}
@@ -0,0 +1,58 @@
+package memcachedb
+
+import "reflect"
+
+// oversized reports whether the result v loaded for key exceeds the limits
+// set by WithResultLimit.
+func (c *cache) oversized(key string, v interface{}) bool {
+	cur := c.cur()
+	if cur.resultRows > 0 && rowCount(v) > cur.resultRows {
+		return true
+	}
+	if cur.resultBytes > 0 {
+		size := estimateSize(v)
+		if c.cost != nil {
+			size = c.cost(key, v)
+		}
+		return size > cur.resultBytes
+	}
+
+	return false
+}
+
+// tooLarge reports whether e, to be cached under key, exceeds the limit set
+// by WithMaxValueSize.
+func (c *cache) tooLarge(key string, e *Entry) bool {
+	limit := c.cur().maxValueSize
+	if limit <= 0 {
+		return false
+	}
+	if e.packed != nil {
+		return int64(len(e.packed)) > limit
+	}
+	if c.cost != nil {
+		return c.cost(key, e.value) > limit
+	}
+
+	return estimateSize(e.value) > limit
+}
+
+// discard drops the entry under key in s that a result left uncached was
+// meant to replace.
+func (c *cache) discard(s segment, key string) {
+	if old, ok := s.delete(key); ok {
+		c.removed(key, old, ReasonInvalidated)
+	}
+}
+
+// rowCount returns the length of v, or of what it points to, if it is a
+// slice, an array or a map, and 1 otherwise.
+func rowCount(v interface{}) int {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len()
+	default:
+		return 1
+	}
+}
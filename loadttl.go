@@ -0,0 +1,59 @@
+package memcachedb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// loadTTLKey is the context key of the loadTTL of a load.
+	loadTTLKey struct{}
+
+	// loadTTL holds the TTL a query picked for its result with SetTTL.
+	loadTTL struct {
+		mu  sync.Mutex
+		ttl time.Duration
+		set bool
+	}
+)
+
+// SetTTL sets the TTL of the result of the load running with ctx to d, so
+// that a query can tell how long what it found stays fresh, such as until
+// the end of the day:
+//
+//	c.DoContext(ctx, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+//		rates, err := loadRates(ctx)
+//		memcachedb.SetTTL(ctx, time.Until(endOfDay()))
+//		return rates, err
+//	})
+//
+// d overrides WithTTL, the default TTL and WithAdaptiveTTL; a d that is
+// not positive keeps the result from being cached at all. Empty results
+// and errors keep the TTLs of WithNegativeCaching and WithErrorPolicy.
+// SetTTL reports whether ctx is that of a load.
+func SetTTL(ctx context.Context, d time.Duration) bool {
+	lt, ok := ctx.Value(loadTTLKey{}).(*loadTTL)
+	if !ok {
+		return false
+	}
+
+	lt.mu.Lock()
+	lt.ttl, lt.set = d, true
+	lt.mu.Unlock()
+	return true
+}
+
+// SetExpiry is SetTTL for a result that expires at t, such as the end of
+// an auction the query found.
+func SetExpiry(ctx context.Context, t time.Time) bool {
+	return SetTTL(ctx, time.Until(t))
+}
+
+// get returns the TTL set with SetTTL, if any.
+func (lt *loadTTL) get() (time.Duration, bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	return lt.ttl, lt.set
+}
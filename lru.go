@@ -0,0 +1,55 @@
+package memcachedb
+
+import "container/list"
+
+// lru evicts the least recently used key.
+type lru struct {
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (p *lru) add(key string) {
+	if e, ok := p.items[key]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.items[key] = p.ll.PushFront(key)
+}
+
+func (p *lru) touch(key string) {
+	if e, ok := p.items[key]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lru) remove(key string) {
+	if e, ok := p.items[key]; ok {
+		p.ll.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+func (p *lru) victim() (string, bool) {
+	e := p.ll.Back()
+	if e == nil {
+		return "", false
+	}
+	key := p.ll.Remove(e).(string)
+	delete(p.items, key)
+
+	return key, true
+}
+
+func (p *lru) peek() (string, bool) {
+	if e := p.ll.Back(); e != nil {
+		return e.Value.(string), true
+	}
+	return "", false
+}
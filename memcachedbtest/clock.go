@@ -0,0 +1,123 @@
+// Package memcachedbtest helps test code built on memcachedb. FakeClock
+// moves the time of a cache by hand, so that tests expire entries without
+// waiting:
+//
+//	clk := memcachedbtest.NewFakeClock(time.Now())
+//	c := memcachedb.New(db, memcachedb.WithClock(clk))
+//	defer c.Stop(ctx)
+//	c.DoKeyed(ctx, "user:1", load)
+//	clk.Advance(10 * time.Minute) // past the default TTL
+//	c.DoKeyed(ctx, "user:1", load) // loads again
+//
+// Fake stands in for a whole memcachedb.Cache, with hits and misses set by
+// hand and every call recorded:
+//
+//	f := new(memcachedbtest.Fake)
+//	f.Put("user:1", user)
+//	svc := NewService(f)
+//	svc.User(ctx, 1)
+//	f.CallsTo("DoKeyed") // [{DoKeyed user:1 true}]
+package memcachedbtest
+
+import (
+	"sync"
+	"time"
+
+	memcachedb "memcache-database-module"
+)
+
+type (
+	// FakeClock is a memcachedb.Clock whose time only moves when Advance
+	// or Set says so. Its tickers tick as the time passes their period,
+	// dropping ticks their receiver is not ready for, as time.Ticker
+	// does. It is safe for concurrent use.
+	FakeClock struct {
+		mu      sync.Mutex
+		now     time.Time
+		tickers []*fakeTicker
+	}
+
+	fakeTicker struct {
+		clock  *FakeClock
+		c      chan time.Time
+		period time.Duration
+		// next is when the ticker ticks next; zero once stopped.
+		next time.Time
+	}
+)
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// NewTicker returns a ticker ticking every d of the clock's time. It
+// panics if d is not positive, as time.NewTicker does.
+func (f *FakeClock) NewTicker(d time.Duration) memcachedb.Ticker {
+	if d <= 0 {
+		panic("memcachedbtest: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTicker{clock: f, c: make(chan time.Time, 1), period: d, next: f.now.Add(d)}
+	f.tickers = append(f.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, ticking the tickers due.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock to t, ticking the tickers due if it moves forward.
+func (f *FakeClock) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(t)
+}
+
+// set moves the clock to t. The caller holds f.mu.
+func (f *FakeClock) set(t time.Time) {
+	f.now = t
+	for _, tk := range f.tickers {
+		if tk.next.IsZero() || tk.next.After(t) {
+			continue
+		}
+		select {
+		case tk.c <- t:
+		default:
+		}
+		for !tk.next.After(t) {
+			tk.next = tk.next.Add(tk.period)
+		}
+	}
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	t.next = time.Time{}
+	for i, tk := range t.clock.tickers {
+		if tk == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package memcachedbtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/memcachedbtest"
+)
+
+func TestFakeClockTicker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := memcachedbtest.NewFakeClock(start)
+	tk := clk.NewTicker(time.Minute)
+
+	clk.Advance(30 * time.Second)
+	select {
+	case <-tk.C():
+		t.Fatal("ticker ticked before its period")
+	default:
+	}
+
+	clk.Advance(5 * time.Minute)
+	if got := <-tk.C(); !got.Equal(start.Add(5*time.Minute + 30*time.Second)) {
+		t.Errorf("tick = %s, want the time of the clock", got)
+	}
+	select {
+	case <-tk.C():
+		t.Fatal("ticker kept ticks its receiver was not ready for")
+	default:
+	}
+
+	tk.Stop()
+	clk.Advance(time.Hour)
+	select {
+	case <-tk.C():
+		t.Fatal("stopped ticker ticked")
+	default:
+	}
+	if now := clk.Now(); !now.Equal(start.Add(65*time.Minute + 30*time.Second)) {
+		t.Errorf("Now = %s", now)
+	}
+}
+
+func TestFakeClockExpires(t *testing.T) {
+	clk := memcachedbtest.NewFakeClock(time.Now())
+	c := memcachedb.New(nil, memcachedb.WithClock(clk), memcachedb.WithoutJanitor())
+	defer c.Stop(context.Background())
+
+	loads := 0
+	load := func(context.Context) (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+	ctx := context.Background()
+	c.DoKeyed(ctx, "k", load, memcachedb.WithTTL(time.Minute))
+	clk.Advance(30 * time.Second)
+	c.DoKeyed(ctx, "k", load, memcachedb.WithTTL(time.Minute))
+	clk.Advance(time.Minute)
+	c.DoKeyed(ctx, "k", load, memcachedb.WithTTL(time.Minute))
+
+	if loads != 2 {
+		t.Errorf("loader ran %d times, want 2", loads)
+	}
+}
@@ -0,0 +1,727 @@
+package memcachedbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	memcachedb "memcache-database-module"
+)
+
+var _ memcachedb.Cache = (*Fake)(nil)
+
+type (
+	// Fake is an in-memory memcachedb.Cache for unit tests of code built
+	// on one. It keeps entries in a map, runs queries on the calling
+	// goroutine and never starts one of its own, and records every call
+	// for tests to check. Its zero value is ready to use.
+	//
+	// Entries never expire, and the CallOptions passed to a Fake are
+	// ignored: entries carry no tags, so InvalidateTag and
+	// InvalidateTables only record the call. Hashed calls are keyed by
+	// the %#v form of their arguments, as Key returns it. Namespace,
+	// WithTx and Local are served by a real cache with no database, kept
+	// apart from the entries of the Fake: only the calls to get them are
+	// recorded, and Put, Miss and the other controls leave them be.
+	Fake struct {
+		// Query, if set, answers the misses of GetContext and the other
+		// calls taking a query rather than a function, returning a value
+		// of the type their dest points to, or []map[string]interface{}
+		// for QueryContext. Without it those misses fail with
+		// memcachedb.ErrNoDB.
+		Query func(ctx context.Context, query string, args ...interface{}) (interface{}, error)
+		// Exec, if set, runs the statements of ExecContext, which
+		// otherwise succeed with no rows affected.
+		Exec func(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+
+		mu      sync.Mutex
+		entries map[string]fakeEntry
+		// missing holds the keys that always miss; every key misses when
+		// missAll is set.
+		missing map[string]bool
+		missAll bool
+		calls   []Call
+		stats   memcachedb.Stats
+		stopped bool
+		// backing serves Namespace, WithTx and Local once one is called.
+		backing memcachedb.Cache
+	}
+
+	// Call is a call made to a Fake.
+	Call struct {
+		// Method is the name of the Cache method called.
+		Method string
+		// Key is the key the call read, wrote or invalidated, or the tag
+		// or tables it invalidated, joined by commas.
+		Key string
+		// Hit reports whether the call was served from the Fake.
+		Hit bool
+	}
+
+	fakeEntry struct {
+		value interface{}
+		err   error
+		hits  uint64
+	}
+)
+
+// Put caches value under key, as if a query had returned it.
+func (f *Fake) Put(key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.put(key, value, nil)
+}
+
+// Miss makes every call for keys miss and run its query, whatever is
+// cached, until Hit is called for them.
+func (f *Fake) Miss(keys ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.missing == nil {
+		f.missing = make(map[string]bool)
+	}
+	for _, key := range keys {
+		f.missing[key] = true
+	}
+}
+
+// Hit undoes Miss for keys, or for every key if none are given.
+func (f *Fake) Hit(keys ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(keys) == 0 {
+		f.missing, f.missAll = nil, false
+	}
+	for _, key := range keys {
+		delete(f.missing, key)
+	}
+}
+
+// MissAll makes every call miss and run its query while on is set.
+func (f *Fake) MissAll(on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.missAll = on
+}
+
+// Calls returns the calls made so far, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the calls made so far to method, in order.
+func (f *Fake) CallsTo(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []Call
+	for _, c := range f.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the entries, the calls, the counters, the keys made to miss
+// and the cache backing Namespace, WithTx and Local, leaving a Fake as good
+// as new. It does not undo Stop.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.entries, f.missing, f.missAll, f.calls = nil, nil, false, nil
+	f.stats = memcachedb.Stats{}
+	if f.backing != nil {
+		f.backing.Stop(context.Background())
+		f.backing = nil
+	}
+}
+
+// record appends a call. The caller holds f.mu.
+func (f *Fake) record(method, key string, hit bool) {
+	f.calls = append(f.calls, Call{Method: method, Key: key, Hit: hit})
+}
+
+// put caches value and err under key. The caller holds f.mu.
+func (f *Fake) put(key string, value interface{}, err error) {
+	if f.entries == nil {
+		f.entries = make(map[string]fakeEntry)
+	}
+	f.entries[key] = fakeEntry{value: value, err: err}
+}
+
+// lookup returns the entry for key unless it is made to miss. The caller
+// holds f.mu.
+func (f *Fake) lookup(key string) (fakeEntry, bool) {
+	if f.missAll || f.missing[key] {
+		return fakeEntry{}, false
+	}
+	e, ok := f.entries[key]
+	return e, ok
+}
+
+// load serves key for method, running query on a miss and caching what it
+// returns.
+func (f *Fake) load(ctx context.Context, method, key string, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return nil, memcachedb.ErrStopped
+	}
+	if e, ok := f.lookup(key); ok {
+		e.hits++
+		f.entries[key] = e
+		f.stats.Hits++
+		f.record(method, key, true)
+		f.mu.Unlock()
+		return e.value, e.err
+	}
+	f.stats.Misses++
+	f.stats.Loads++
+	f.record(method, key, false)
+	f.mu.Unlock()
+
+	v, err := query(ctx)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.stats.LoadErrors++
+		return nil, &memcachedb.LoadError{Key: key, Err: err}
+	}
+	f.put(key, v, nil)
+	return v, nil
+}
+
+// scan serves the query of method into dest.
+func (f *Fake) scan(ctx context.Context, method string, dest interface{}, query string, args []interface{}) error {
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Pointer || d.IsNil() {
+		return fmt.Errorf("memcachedbtest: %s destination must be a non-nil pointer, not %T", method, dest)
+	}
+	args = queryArgs(args)
+	key := fakeKey(append([]interface{}{d.Type().Elem().String(), query}, args...))
+
+	v, err := f.load(ctx, method, key, func(ctx context.Context) (interface{}, error) {
+		if f.Query == nil {
+			return nil, memcachedb.ErrNoDB
+		}
+		return f.Query(ctx, query, args...)
+	})
+	if err != nil {
+		return err
+	}
+
+	return assign(d, v)
+}
+
+// assign sets what d points to to v.
+func assign(d reflect.Value, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	switch {
+	case !rv.IsValid():
+		d.Elem().SetZero()
+	case rv.Type().AssignableTo(d.Type().Elem()):
+		d.Elem().Set(rv)
+	default:
+		return fmt.Errorf("%w: %T, not %s", memcachedb.ErrTypeMismatch, v, d.Type().Elem())
+	}
+
+	return nil
+}
+
+// queryArgs returns args without the CallOptions among them.
+func queryArgs(args []interface{}) []interface{} {
+	rest := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if _, ok := arg.(memcachedb.CallOption); !ok {
+			rest = append(rest, arg)
+		}
+	}
+
+	return rest
+}
+
+func fakeKey(args []interface{}) string {
+	return fmt.Sprintf("%#v", args)
+}
+
+func rowKey(table string, pk interface{}) string {
+	return "row:" + strings.ToLower(table) + ":" + fmt.Sprint(pk)
+}
+
+// Start does nothing: a Fake has no janitor.
+func (f *Fake) Start(context.Context) {}
+
+// SweepExpired returns 0: the entries of a Fake never expire.
+func (f *Fake) SweepExpired() int {
+	return 0
+}
+
+func (f *Fake) DoContext(ctx context.Context, query func(ctx context.Context, args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
+	args = queryArgs(args)
+	return f.load(ctx, "DoContext", fakeKey(args), func(ctx context.Context) (interface{}, error) {
+		return query(ctx, args...)
+	})
+}
+
+func (f *Fake) Do(query func(args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
+	args = queryArgs(args)
+	return f.load(context.Background(), "Do", fakeKey(args), func(context.Context) (interface{}, error) {
+		return query(args...)
+	})
+}
+
+func (f *Fake) DoKeyed(ctx context.Context, key string, loader func(ctx context.Context) (interface{}, error), _ ...memcachedb.CallOption) (interface{}, error) {
+	return f.load(ctx, "DoKeyed", key, loader)
+}
+
+func (f *Fake) Key(args ...interface{}) (string, error) {
+	return fakeKey(queryArgs(args)), nil
+}
+
+func (f *Fake) Set(key string, value interface{}, _ time.Duration, _ ...memcachedb.CallOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stopped {
+		return memcachedb.ErrStopped
+	}
+	f.record("Set", key, false)
+	f.put(key, value, nil)
+	return nil
+}
+
+func (f *Fake) Peek(args ...interface{}) (interface{}, bool) {
+	return f.peek("Peek", fakeKey(queryArgs(args)))
+}
+
+func (f *Fake) PeekKey(key string) (interface{}, bool) {
+	return f.peek("PeekKey", key)
+}
+
+func (f *Fake) peek(method, key string) (interface{}, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e, ok := f.lookup(key)
+	ok = ok && e.err == nil
+	f.record(method, key, ok)
+	return e.value, ok
+}
+
+// TTL reports whether an entry is cached under key, for as long as the
+// Fake lasts: its entries never expire.
+func (f *Fake) TTL(key string) (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.entries[key]; !ok {
+		return 0, false
+	}
+	return time.Duration(math.MaxInt64), true
+}
+
+// Inspect describes the entry cached under key with its hits alone: the
+// entries of a Fake have no lifetime.
+func (f *Fake) Inspect(key string) (memcachedb.EntryInfo, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e, ok := f.entries[key]
+	if !ok {
+		return memcachedb.EntryInfo{}, false
+	}
+	return memcachedb.EntryInfo{Hits: e.hits, Err: e.err}, true
+}
+
+// Range walks the entries in key order, as Inspect describes them.
+func (f *Fake) Range(fn func(key string, info memcachedb.EntryInfo) bool) {
+	for _, key := range f.keys() {
+		info, ok := f.Inspect(key)
+		if ok && !fn(key, info) {
+			return
+		}
+	}
+}
+
+func (f *Fake) Keys(pattern string, limit int, cursor string) ([]string, string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, "", err
+	}
+
+	var keys []string
+	for _, key := range f.keys() {
+		if cursor != "" && key <= cursor {
+			continue
+		}
+		if ok, _ := path.Match(pattern, key); pattern != "" && !ok {
+			continue
+		}
+		if limit > 0 && len(keys) == limit {
+			return keys, keys[limit-1], nil
+		}
+		keys = append(keys, key)
+	}
+	return keys, "", nil
+}
+
+// keys returns the keys of the entries in order.
+func (f *Fake) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.entries))
+	for key := range f.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *Fake) Invalidate(args ...interface{}) error {
+	f.invalidate("Invalidate", fakeKey(queryArgs(args)))
+	return nil
+}
+
+func (f *Fake) InvalidateKey(key string) bool {
+	return f.invalidate("InvalidateKey", key)
+}
+
+func (f *Fake) invalidate(method, key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.entries[key]
+	delete(f.entries, key)
+	f.record(method, key, ok)
+	return ok
+}
+
+func (f *Fake) InvalidateWhere(match func(key string, value interface{}) bool) int {
+	f.mu.Lock()
+	entries := make(map[string]fakeEntry, len(f.entries))
+	for key, e := range f.entries {
+		entries[key] = e
+	}
+	f.mu.Unlock()
+
+	// match runs unlocked, free to call the Fake.
+	var keys []string
+	for key, e := range entries {
+		if match(key, e.value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		delete(f.entries, key)
+	}
+	f.record("InvalidateWhere", strings.Join(keys, ","), false)
+	return len(keys)
+}
+
+func (f *Fake) FlushAll() int {
+	return f.flush("FlushAll", "")
+}
+
+func (f *Fake) FlushPrefix(prefix string) int {
+	return f.flush("FlushPrefix", prefix)
+}
+
+func (f *Fake) flush(method, prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for key := range f.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(f.entries, key)
+			n++
+		}
+	}
+	f.record(method, prefix, false)
+	return n
+}
+
+func (f *Fake) InvalidateTag(tag string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record("InvalidateTag", tag, false)
+	return 0
+}
+
+func (f *Fake) InvalidateTables(tables ...string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record("InvalidateTables", strings.Join(tables, ","), false)
+	return 0
+}
+
+func (f *Fake) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return f.scan(ctx, "GetContext", dest, query, args)
+}
+
+func (f *Fake) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return f.scan(ctx, "SelectContext", dest, query, args)
+}
+
+func (f *Fake) QueryContext(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	err := f.scan(ctx, "QueryContext", &rows, query, args)
+	return rows, err
+}
+
+// NamedGetContext passes arg to Query as the single argument of query.
+func (f *Fake) NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}, _ ...memcachedb.CallOption) error {
+	return f.scan(ctx, "NamedGetContext", dest, query, []interface{}{arg})
+}
+
+// NamedSelectContext passes arg to Query as the single argument of query.
+func (f *Fake) NamedSelectContext(ctx context.Context, dest interface{}, query string, arg interface{}, _ ...memcachedb.CallOption) error {
+	return f.scan(ctx, "NamedSelectContext", dest, query, []interface{}{arg})
+}
+
+func (f *Fake) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return nil, memcachedb.ErrStopped
+	}
+	f.record("ExecContext", query, false)
+	f.mu.Unlock()
+
+	if f.Exec == nil {
+		return driver.RowsAffected(0), nil
+	}
+	return f.Exec(ctx, query, queryArgs(args)...)
+}
+
+// GetRowContext caches the row under the key "row:<table>:<pk>", the
+// table lower-cased, and asks Query for it as
+// "SELECT * FROM table WHERE column = ?" on a miss.
+func (f *Fake) GetRowContext(ctx context.Context, dest interface{}, table, column string, pk interface{}, _ ...memcachedb.CallOption) error {
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Pointer || d.IsNil() {
+		return fmt.Errorf("memcachedbtest: GetRowContext destination must be a non-nil pointer, not %T", dest)
+	}
+	v, err := f.row(ctx, "GetRowContext", table, column, pk)
+	if err != nil {
+		return err
+	}
+
+	return assign(d, v)
+}
+
+// SelectRowsContext serves every row as GetRowContext does, leaving out
+// those Query finds none of with sql.ErrNoRows.
+func (f *Fake) SelectRowsContext(ctx context.Context, dest interface{}, table, column string, pks []interface{}, _ ...memcachedb.CallOption) error {
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Pointer || d.IsNil() || d.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("memcachedbtest: SelectRowsContext destination must point to a slice, not %T", dest)
+	}
+
+	rows := reflect.MakeSlice(d.Elem().Type(), 0, len(pks))
+	for _, pk := range pks {
+		v, err := f.row(ctx, "SelectRowsContext", table, column, pk)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			continue
+		case err != nil:
+			return err
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.IsValid() || !rv.Type().AssignableTo(rows.Type().Elem()) {
+			return fmt.Errorf("%w: %T, not %s", memcachedb.ErrTypeMismatch, v, rows.Type().Elem())
+		}
+		rows = reflect.Append(rows, rv)
+	}
+	d.Elem().Set(rows)
+
+	return nil
+}
+
+func (f *Fake) row(ctx context.Context, method, table, column string, pk interface{}) (interface{}, error) {
+	query := "SELECT * FROM " + table + " WHERE " + column + " = ?"
+	return f.load(ctx, method, rowKey(table, pk), func(ctx context.Context) (interface{}, error) {
+		if f.Query == nil {
+			return nil, memcachedb.ErrNoDB
+		}
+		return f.Query(ctx, query, pk)
+	})
+}
+
+func (f *Fake) InvalidateRows(table string, pks ...interface{}) int {
+	n := 0
+	for _, pk := range pks {
+		if f.invalidate("InvalidateRows", rowKey(table, pk)) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// DoMulti serves the requests one after another.
+func (f *Fake) DoMulti(ctx context.Context, requests []memcachedb.Request) ([]memcachedb.Result, error) {
+	results := make([]memcachedb.Result, len(requests))
+	for i, r := range requests {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		results[i].Value, results[i].Err = f.DoContext(ctx, r.Query, r.Args...)
+		if errors.Is(results[i].Err, memcachedb.ErrStopped) {
+			return nil, memcachedb.ErrStopped
+		}
+	}
+
+	return results, nil
+}
+
+// Warm runs the specs one after another.
+func (f *Fake) Warm(ctx context.Context, specs []memcachedb.WarmSpec) error {
+	var errs []error
+	for _, spec := range specs {
+		if _, err := f.DoContext(ctx, spec.Query, spec.Args...); err != nil {
+			errs = append(errs, fmt.Errorf("memcachedbtest: warm %s: %w", spec.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SaveSnapshot writes the entries holding no error to w with
+// encoding/gob, whose values must be registered with gob.Register.
+func (f *Fake) SaveSnapshot(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values := make(map[string]interface{}, len(f.entries))
+	for key, e := range f.entries {
+		if e.err == nil {
+			values[key] = e.value
+		}
+	}
+	return gob.NewEncoder(w).Encode(values)
+}
+
+// LoadSnapshot restores the entries saved by SaveSnapshot, keeping those
+// already cached under the same keys.
+func (f *Fake) LoadSnapshot(r io.Reader) error {
+	var values map[string]interface{}
+	if err := gob.NewDecoder(r).Decode(&values); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, v := range values {
+		if _, ok := f.entries[key]; !ok {
+			f.put(key, v, nil)
+		}
+	}
+	return nil
+}
+
+// backed records a call to method and returns the cache serving it,
+// created on first use.
+func (f *Fake) backed(method, key string) memcachedb.Cache {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record(method, key, false)
+	if f.backing == nil {
+		f.backing = memcachedb.New(nil, memcachedb.WithoutJanitor())
+		if f.stopped {
+			f.backing.Stop(context.Background())
+		}
+	}
+	return f.backing
+}
+
+// Namespace returns a namespace of the cache backing the Fake.
+func (f *Fake) Namespace(name string, opts ...memcachedb.CallOption) *memcachedb.Namespace {
+	return f.backed("Namespace", name).Namespace(name, opts...)
+}
+
+// WithTx returns a view for tx of the cache backing the Fake.
+func (f *Fake) WithTx(tx *sqlx.Tx) *memcachedb.Tx {
+	return f.backed("WithTx", "").WithTx(tx)
+}
+
+// Local returns the peer of the cache backing the Fake.
+func (f *Fake) Local() memcachedb.Peer {
+	return f.backed("Local", "").Local()
+}
+
+// Stats counts the hits, misses, loads and load errors of the Fake and
+// its entries.
+func (f *Fake) Stats() memcachedb.Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.stats
+	s.Entries = len(f.entries)
+	return s
+}
+
+// TopPatterns returns nil: a Fake counts no patterns.
+func (f *Fake) TopPatterns(int, memcachedb.PatternOrder) []memcachedb.PatternStats {
+	return nil
+}
+
+// Trace returns nil: a Fake traces no keys; Calls tells what was asked of
+// it instead.
+func (f *Fake) Trace(string) []memcachedb.TraceEvent {
+	return nil
+}
+
+func (f *Fake) Settings() map[string]any {
+	return map[string]any{"store": "fake"}
+}
+
+// UpdateConfig validates cfg and otherwise ignores it.
+func (f *Fake) UpdateConfig(cfg memcachedb.Config) error {
+	f.mu.Lock()
+	f.record("UpdateConfig", "", false)
+	f.mu.Unlock()
+
+	return cfg.Validate()
+}
+
+func (f *Fake) Stop(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stopped = true
+	if f.backing != nil {
+		return f.backing.Stop(context.Background())
+	}
+	return nil
+}
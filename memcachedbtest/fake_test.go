@@ -0,0 +1,153 @@
+package memcachedbtest_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/memcachedbtest"
+)
+
+func TestFakeHitsAndMisses(t *testing.T) {
+	var f memcachedbtest.Fake
+	ctx := context.Background()
+	loads := 0
+	load := func(context.Context) (interface{}, error) {
+		loads++
+		return "loaded", nil
+	}
+
+	f.Put("user:1", "put")
+	if v, err := f.DoKeyed(ctx, "user:1", load); err != nil || v != "put" {
+		t.Errorf("DoKeyed of a put key = %v, %v, want put", v, err)
+	}
+	if v, err := f.DoKeyed(ctx, "user:2", load); err != nil || v != "loaded" {
+		t.Errorf("DoKeyed of a new key = %v, %v, want loaded", v, err)
+	}
+	f.DoKeyed(ctx, "user:2", load)
+
+	f.Miss("user:1")
+	f.DoKeyed(ctx, "user:1", load)
+	f.Hit()
+	f.DoKeyed(ctx, "user:1", load)
+	if loads != 2 {
+		t.Errorf("queries ran %d times, want 2", loads)
+	}
+
+	want := []memcachedbtest.Call{
+		{Method: "DoKeyed", Key: "user:1", Hit: true},
+		{Method: "DoKeyed", Key: "user:2"},
+		{Method: "DoKeyed", Key: "user:2", Hit: true},
+		{Method: "DoKeyed", Key: "user:1"},
+		{Method: "DoKeyed", Key: "user:1", Hit: true},
+	}
+	if got := f.CallsTo("DoKeyed"); !slices.Equal(got, want) {
+		t.Errorf("CallsTo(DoKeyed) = %v, want %v", got, want)
+	}
+	if s := f.Stats(); s.Hits != 3 || s.Misses != 2 || s.Entries != 2 {
+		t.Errorf("Stats = %+v, want 3 hits, 2 misses and 2 entries", s)
+	}
+
+	f.Reset()
+	if calls, s := f.Calls(), f.Stats(); len(calls) != 0 || s.Hits+s.Misses+uint64(s.Entries) != 0 {
+		t.Errorf("after Reset, Calls = %v and Stats = %+v, want none", calls, s)
+	}
+}
+
+func TestFakeLoadError(t *testing.T) {
+	var f memcachedbtest.Fake
+	failed := errors.New("failed")
+
+	_, err := f.DoContext(context.Background(), func(context.Context, ...interface{}) (interface{}, error) {
+		return nil, failed
+	}, 1)
+	var le *memcachedb.LoadError
+	if !errors.As(err, &le) || !errors.Is(err, failed) {
+		t.Errorf("DoContext = %v, want a *LoadError wrapping the query error", err)
+	}
+	if s := f.Stats(); s.LoadErrors != 1 || s.Entries != 0 {
+		t.Errorf("Stats = %+v, want 1 load error and no entry", s)
+	}
+}
+
+func TestFakeQuery(t *testing.T) {
+	type user struct{ Name string }
+	f := memcachedbtest.Fake{
+		Query: func(_ context.Context, query string, args ...interface{}) (interface{}, error) {
+			return user{Name: "ann"}, nil
+		},
+	}
+
+	var u user
+	if err := f.GetContext(context.Background(), &u, "SELECT * FROM users WHERE id = $1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "ann" {
+		t.Errorf("GetContext = %+v, want ann", u)
+	}
+
+	var none memcachedbtest.Fake
+	if err := none.GetContext(context.Background(), &u, "SELECT 1"); !errors.Is(err, memcachedb.ErrNoDB) {
+		t.Errorf("GetContext without Query = %v, want ErrNoDB", err)
+	}
+}
+
+func TestFakeKeysAndFlush(t *testing.T) {
+	var f memcachedbtest.Fake
+	for _, key := range []string{"a:1", "a:2", "a:3", "b:1"} {
+		f.Put(key, key)
+	}
+
+	keys, next, err := f.Keys("a:*", 2, "")
+	if err != nil || !slices.Equal(keys, []string{"a:1", "a:2"}) || next != "a:2" {
+		t.Errorf("Keys = %q, %q, %v", keys, next, err)
+	}
+	if keys, next, _ = f.Keys("a:*", 2, next); !slices.Equal(keys, []string{"a:3"}) || next != "" {
+		t.Errorf("Keys of the second page = %q, %q", keys, next)
+	}
+
+	if n := f.FlushPrefix("a:"); n != 3 {
+		t.Errorf("FlushPrefix = %d, want 3", n)
+	}
+	if _, ok := f.PeekKey("b:1"); !ok {
+		t.Error("FlushPrefix removed a key outside the prefix")
+	}
+	if ttl, ok := f.TTL("b:1"); !ok || ttl < time.Hour {
+		t.Errorf("TTL = %s, %t, want a key that never expires", ttl, ok)
+	}
+}
+
+func TestFakeBacking(t *testing.T) {
+	var f memcachedbtest.Fake
+	ctx := context.Background()
+
+	ns := f.Namespace("users")
+	if err := ns.Set("1", "ann", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ns.PeekKey("1"); !ok || v != "ann" {
+		t.Errorf("Namespace PeekKey = %v, %t, want ann", v, ok)
+	}
+	if v, err := f.WithTx(nil).DoKeyed(ctx, "k", func(context.Context) (interface{}, error) { return 1, nil }); err != nil || v != 1 {
+		t.Errorf("WithTx DoKeyed = %v, %v", v, err)
+	}
+	if _, ok, err := f.Local().Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("Local Get = %t, %v, want a miss", ok, err)
+	}
+	if n := len(f.CallsTo("Namespace")); n != 1 {
+		t.Errorf("Namespace recorded %d calls, want 1", n)
+	}
+
+	if err := f.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.DoKeyed(ctx, "k", nil); !errors.Is(err, memcachedb.ErrStopped) {
+		t.Errorf("DoKeyed after Stop = %v, want ErrStopped", err)
+	}
+	if err := f.Namespace("users").Set("2", "bob", time.Minute); !errors.Is(err, memcachedb.ErrStopped) {
+		t.Errorf("Namespace Set after Stop = %v, want ErrStopped", err)
+	}
+}
@@ -0,0 +1,370 @@
+// Package memcachedserver serves a memcachedb cache over the memcached
+// text protocol, so that existing memcached clients can use it. It
+// supports get, gets, set, delete, flush_all, version and quit. As in
+// memcached, items set with an exptime of 0 stay until they are evicted or
+// deleted, whatever the TTL of the cache.
+//
+// With a Loader, a get that finds nothing cached reads through to the
+// database:
+//
+//	srv := memcachedserver.New(c, memcachedserver.WithLoader(func(ctx context.Context, key string) ([]byte, error) {
+//		var name string
+//		err := db.GetContext(ctx, &name, "SELECT name FROM users WHERE id = $1", strings.TrimPrefix(key, "user:"))
+//		return []byte(name), err
+//	}))
+//	log.Fatal(srv.ListenAndServe(":11211"))
+package memcachedserver
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/internal/netserve"
+)
+
+const (
+	defaultMaxValue = 1 << 20
+	maxKeyLength    = 250
+	// maxRelative is the longest expiration memcached takes as a number of
+	// seconds; larger ones are Unix times.
+	maxRelative = 30 * 24 * 60 * 60
+	// forever is the TTL of items set with exptime 0, which memcached
+	// never expires: a century, as long as the lifetimes of entries
+	// reach with room for their jitter.
+	forever = 100 * 365 * 24 * time.Hour
+)
+
+type (
+	// Loader returns the value for a key that is not cached, or
+	// sql.ErrNoRows when there is none.
+	Loader func(ctx context.Context, key string) ([]byte, error)
+
+	// Server speaks the memcached text protocol.
+	Server struct {
+		cache    memcachedb.Cache
+		loader   Loader
+		logger   *slog.Logger
+		maxValue int
+
+		conns netserve.Conns
+	}
+
+	// Option configures a Server.
+	Option func(s *Server)
+
+	// item is what the server caches: memcached values carry flags.
+	item struct {
+		Flags uint32
+		Value []byte
+	}
+)
+
+// WithLoader makes gets that find nothing cached call l and cache what it
+// returns.
+func WithLoader(l Loader) Option {
+	return func(s *Server) {
+		s.loader = l
+	}
+}
+
+// WithLogger logs connection and loader errors to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithMaxValueSize rejects values longer than n bytes. It defaults to
+// 1 MiB, like memcached.
+func WithMaxValueSize(n int) Option {
+	return func(s *Server) {
+		s.maxValue = n
+	}
+}
+
+// New returns a Server for c.
+func New(c memcachedb.Cache, opts ...Option) *Server {
+	s := &Server{
+		cache:    c,
+		logger:   slog.Default(),
+		maxValue: defaultMaxValue,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ListenAndServe serves on the TCP address addr.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called, and then returns
+// net.ErrClosed.
+func (s *Server) Serve(l net.Listener) error {
+	return s.conns.Serve(l, s.serve)
+}
+
+// Close stops the server, closing its listener and connections, and waits
+// for the commands being served to finish.
+func (s *Server) Close() error {
+	return s.conns.Close()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debug("memcachedserver: read", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
+		if !s.command(ctx, strings.Fields(string(line)), r, w) {
+			w.Flush()
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// command runs the command of fields, reading its data block from r, and
+// writes the reply to w. It returns false when the connection must close.
+func (s *Server) command(ctx context.Context, fields []string, r *bufio.Reader, w *bufio.Writer) bool {
+	if len(fields) == 0 {
+		w.WriteString("ERROR\r\n")
+		return true
+	}
+
+	switch fields[0] {
+	case "get", "gets":
+		s.get(ctx, fields[0] == "gets", fields[1:], w)
+	case "set":
+		return s.set(fields[1:], r, w)
+	case "delete":
+		s.delete(fields[1:], w)
+	case "flush_all":
+		s.flushAll(fields[1:], w)
+	case "version":
+		w.WriteString("VERSION memcachedb\r\n")
+	case "quit":
+		return false
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+
+	return true
+}
+
+func (s *Server) get(ctx context.Context, cas bool, keys []string, w *bufio.Writer) {
+	if len(keys) == 0 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+
+	for _, key := range keys {
+		if !validKey(key) {
+			w.WriteString("CLIENT_ERROR bad key\r\n")
+			return
+		}
+		it, ok, err := s.lookup(ctx, key)
+		if err != nil {
+			fmt.Fprintf(w, "SERVER_ERROR %s\r\n", oneLine(err))
+			return
+		}
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "VALUE %s %d %d", key, it.Flags, len(it.Value))
+		if cas {
+			// Entries have no CAS token; clients get a constant one.
+			w.WriteString(" 0")
+		}
+		w.WriteString("\r\n")
+		w.Write(it.Value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// lookup returns the item under key, loading it when a loader is set.
+func (s *Server) lookup(ctx context.Context, key string) (item, bool, error) {
+	if s.loader == nil {
+		v, ok := s.cache.Peek(key)
+		it, isItem := v.(item)
+		return it, ok && isItem, nil
+	}
+
+	v, err := s.cache.DoContext(ctx, func(ctx context.Context, _ ...interface{}) (interface{}, error) {
+		value, err := s.loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return item{Value: value}, nil
+	}, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return item{}, false, nil
+	}
+	if err != nil {
+		s.logger.Warn("memcachedserver: load", "key", key, "error", err)
+		return item{}, false, err
+	}
+	it, ok := v.(item)
+
+	return it, ok, nil
+}
+
+// set handles "set <key> <flags> <exptime> <bytes> [noreply]".
+func (s *Server) set(args []string, r *bufio.Reader, w *bufio.Writer) bool {
+	noreply := len(args) == 5 && args[4] == "noreply"
+	if len(args) != 4 && !noreply {
+		w.WriteString("ERROR\r\n")
+		return true
+	}
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	n, err3 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil || err3 != nil || n < 0 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return false
+	}
+
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return false
+	}
+	if string(data[n:]) != "\r\n" {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return false
+	}
+
+	reply := "STORED\r\n"
+	switch key := args[0]; {
+	case !validKey(key):
+		reply = "CLIENT_ERROR bad key\r\n"
+	case n > s.maxValue:
+		reply = "SERVER_ERROR object too large for cache\r\n"
+	default:
+		if err := s.store(key, item{Flags: uint32(flags), Value: data[:n]}, exptime); err != nil {
+			reply = "SERVER_ERROR " + oneLine(err) + "\r\n"
+		}
+	}
+	if !noreply {
+		w.WriteString(reply)
+	}
+
+	return true
+}
+
+func (s *Server) store(key string, it item, exptime int64) error {
+	ck, err := s.cache.Key(key)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	switch {
+	case exptime < 0:
+		s.cache.InvalidateKey(ck)
+		return nil
+	case exptime == 0:
+		ttl = forever
+	case exptime > maxRelative:
+		ttl = time.Until(time.Unix(exptime, 0))
+		if ttl <= 0 {
+			s.cache.InvalidateKey(ck)
+			return nil
+		}
+	default:
+		ttl = time.Duration(exptime) * time.Second
+	}
+
+	return s.cache.Set(ck, it, ttl)
+}
+
+// delete handles "delete <key> [noreply]".
+func (s *Server) delete(args []string, w *bufio.Writer) {
+	noreply := len(args) == 2 && args[1] == "noreply"
+	if len(args) != 1 && !noreply {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+
+	reply := "NOT_FOUND\r\n"
+	if ck, err := s.cache.Key(args[0]); err == nil && s.cache.InvalidateKey(ck) {
+		reply = "DELETED\r\n"
+	}
+	if !noreply {
+		w.WriteString(reply)
+	}
+}
+
+// flushAll handles "flush_all [delay] [noreply]". Only the entries set or
+// loaded through the server are flushed, and at once: delays are not
+// supported.
+func (s *Server) flushAll(args []string, w *bufio.Writer) {
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+	if len(args) > 1 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	if len(args) == 1 && args[0] != "0" {
+		if !noreply {
+			w.WriteString("CLIENT_ERROR delayed flush_all not supported\r\n")
+		}
+		return
+	}
+
+	s.cache.InvalidateWhere(func(_ string, v interface{}) bool {
+		_, ok := v.(item)
+		return ok
+	})
+	if !noreply {
+		w.WriteString("OK\r\n")
+	}
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// oneLine keeps an error message from breaking the line-based protocol.
+func oneLine(err error) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+}
@@ -0,0 +1,56 @@
+package memcachedserver_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/memcachedserver"
+)
+
+func TestSetExptime(t *testing.T) {
+	c := memcachedb.New(nil, memcachedb.WithoutJanitor(), memcachedb.WithDefaultTTL(time.Minute))
+	defer c.Stop(context.Background())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := memcachedserver.New(c)
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for _, tt := range []struct {
+		key     string
+		exptime string
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"forever", "0", 50 * 365 * 24 * time.Hour, 200 * 365 * 24 * time.Hour},
+		{"relative", "30", 29 * time.Second, 30 * time.Second},
+		{"absolute", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10), 59 * time.Minute, time.Hour},
+	} {
+		if _, err := conn.Write([]byte("set " + tt.key + " 0 " + tt.exptime + " 1\r\nx\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		if line, err := r.ReadString('\n'); err != nil || line != "STORED\r\n" {
+			t.Fatalf("set %s = %q, %v", tt.key, line, err)
+		}
+
+		key, _ := c.Key(tt.key)
+		if ttl, ok := c.TTL(key); !ok || ttl < tt.min || ttl > tt.max {
+			t.Errorf("TTL of %s set with exptime %s = %v, %t, want within [%v, %v]", tt.key, tt.exptime, ttl, ok, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Package memcachedtier shares memcachedb entries between processes through
+// memcached:
+//
+//	mc := memcache.New("10.0.0.1:11211", "10.0.0.2:11211")
+//	c := memcachedb.New(db,
+//		memcachedb.WithL2(memcachedtier.New(mc, memcachedtier.WithPrefix("users:"))))
+package memcachedtier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	memcachedb "memcache-database-module"
+)
+
+const (
+	// maxKeyLength is the longest key memcached accepts.
+	maxKeyLength = 250
+	// maxRelative is the longest expiration memcached takes as a number of
+	// seconds; longer ones must be given as a Unix time.
+	maxRelative = 30 * 24 * time.Hour
+)
+
+type (
+	// Tier is a memcachedb.Tier backed by memcached. It is no
+	// memcachedb.FlushingTier, as memcached cannot list its keys.
+	Tier struct {
+		client *memcache.Client
+		prefix string
+	}
+
+	// Option configures a Tier.
+	Option func(t *Tier)
+)
+
+var _ memcachedb.Tier = (*Tier)(nil)
+
+// WithPrefix prepends prefix to every key, so that caches sharing memcached
+// servers keep their entries apart.
+func WithPrefix(prefix string) Option {
+	return func(t *Tier) {
+		t.prefix = prefix
+	}
+}
+
+// New returns a Tier storing entries through client. The client has no
+// notion of contexts, so its Timeout bounds every call instead.
+func New(client *memcache.Client, opts ...Option) *Tier {
+	t := &Tier{client: client}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *Tier) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	it, err := t.client.Get(t.key(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return it.Value, true, nil
+}
+
+func (t *Tier) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return t.client.Set(&memcache.Item{
+		Key:        t.key(key),
+		Value:      value,
+		Expiration: expiration(ttl),
+	})
+}
+
+func (t *Tier) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := t.client.Delete(t.key(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+
+	return err
+}
+
+// key returns the memcached key of key. Keys memcached would reject, for
+// being too long or holding spaces or control characters, are replaced by
+// their SHA-256.
+func (t *Tier) key(key string) string {
+	k := t.prefix + key
+	if len(k) <= maxKeyLength && legal(k) {
+		return k
+	}
+	sum := sha256.Sum256([]byte(key))
+
+	return t.prefix + hex.EncodeToString(sum[:])
+}
+
+func legal(key string) bool {
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expiration converts ttl to a memcached expiration, rounding up so that a
+// remaining fraction of a second does not read as "never expires". TTLs
+// ending past what a memcached expiration holds never expire.
+func expiration(ttl time.Duration) int32 {
+	if ttl > maxRelative {
+		at := time.Now().Add(ttl).Unix()
+		if at > math.MaxInt32 {
+			return 0
+		}
+		return int32(at)
+	}
+
+	return int32((ttl + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,16 @@
+// Package msgpackcodec encodes cached values with MessagePack, which is
+// more compact and faster to decode than JSON:
+//
+//	c := memcachedb.New(db, memcachedb.WithCodec(msgpackcodec.Codec{}))
+package msgpackcodec
+
+import "github.com/vmihailenco/msgpack/v5"
+
+// Codec is a memcachedb.Codec using MessagePack.
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) { return msgpack.Marshal(v) }
+
+func (Codec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+func (Codec) String() string { return "msgpack" }
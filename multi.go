@@ -0,0 +1,94 @@
+package memcachedb
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// Request is one call of a DoMulti batch. Args are handled as the
+	// arguments of DoContext, call options included.
+	Request struct {
+		Query func(ctx context.Context, args ...interface{}) (interface{}, error)
+		Args  []interface{}
+	}
+
+	// Result is the outcome of one Request.
+	Result struct {
+		Value interface{}
+		Err   error
+	}
+)
+
+func (c *cache) DoMulti(ctx context.Context, requests []Request) ([]Result, error) {
+	if !c.begin() {
+		return nil, ErrStopped
+	}
+	defer c.end()
+
+	ctx, span := c.tracer.Start(ctx, "memcachedb.DoMulti",
+		trace.WithAttributes(attribute.Int("memcachedb.requests", len(requests))))
+	defer span.End()
+
+	type pending struct {
+		i     int
+		s     segment
+		key   string
+		prev  *Entry
+		o     callOptions
+		query func(ctx context.Context) (interface{}, error)
+	}
+
+	results := make([]Result, len(requests))
+	var misses []pending
+	for i, r := range requests {
+		args, o := c.splitArgs(r.Args)
+		key, fp, err := c.hash(args...)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		o.fingerprint = fp
+		c.trackPattern(&o, c.funcPattern(r.Query))
+
+		query := r.Query
+		p := pending{i: i, s: c.shard(key), key: key, o: o, query: func(ctx context.Context) (interface{}, error) {
+			return query(ctx, args...)
+		}}
+		p.prev = c.previous(p.s, key)
+		if !o.force {
+			if v, err, ok := c.hit(ctx, p.s, key, o, p.query); ok {
+				results[i] = Result{Value: v, Err: err}
+				continue
+			}
+		}
+		misses = append(misses, p)
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(c.batchConcurrency, 1))
+	)
+	for _, p := range misses {
+		if err := ctx.Err(); err != nil {
+			results[p.i].Err = err
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(p pending) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			v, err := c.missOrStale(ctx, p.s, p.key, p.prev, p.o, p.query)
+			results[p.i] = Result{Value: v, Err: err}
+		}(p)
+	}
+	wg.Wait()
+
+	return results, ctx.Err()
+}
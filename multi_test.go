@@ -0,0 +1,50 @@
+package memcachedb
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testClock is a Clock moved by hand.
+type testClock struct{ now atomic.Int64 }
+
+func (c *testClock) Now() time.Time                 { return time.Unix(0, c.now.Load()) }
+func (c *testClock) NewTicker(time.Duration) Ticker { return testTicker{} }
+func (c *testClock) advance(d time.Duration)        { c.now.Add(int64(d)) }
+
+type testTicker struct{}
+
+func (testTicker) C() <-chan time.Time { return nil }
+func (testTicker) Stop()               {}
+
+func TestDoMultiStaleOnError(t *testing.T) {
+	clk := new(testClock)
+	clk.advance(time.Hour)
+	c := New(nil, WithoutJanitor(), WithClock(clk), WithStaleOnError(nil))
+	defer c.Stop(context.Background())
+	ctx := context.Background()
+
+	if _, err := c.DoContext(ctx, loadUser, 1, WithTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	clk.advance(2 * time.Minute)
+
+	failed := errors.New("failed")
+	failing := func(context.Context, ...interface{}) (interface{}, error) { return nil, failed }
+	results, err := c.DoMulti(ctx, []Request{
+		{Query: failing, Args: []interface{}{1}},
+		{Query: failing, Args: []interface{}{2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results[0]; r.Err != nil || r.Value != 1 {
+		t.Errorf("result of the stale key = %v, %v, want the stale 1", r.Value, r.Err)
+	}
+	if r := results[1]; !errors.Is(r.Err, failed) {
+		t.Errorf("result of the uncached key = %v, %v, want the load error", r.Value, r.Err)
+	}
+}
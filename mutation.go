@@ -0,0 +1,45 @@
+package memcachedb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// checksum returns the checksum of v, or zero for values that cannot be
+// checksummed. It reuses the canonical key encoding, which follows
+// pointers and orders maps.
+func checksum(v interface{}) uint64 {
+	buf := keyBuffers.Get().(*bytes.Buffer)
+	defer keyBuffers.Put(buf)
+	buf.Reset()
+
+	if err := encodeKey(buf, []interface{}{v}); err != nil {
+		return 0
+	}
+
+	return xxhash.Sum64(buf.Bytes()) | 1
+}
+
+// seal records the checksum of the value of v for WithMutationCheck.
+// Encoded values cannot be modified by callers and are left out.
+func (c *cache) seal(v *Entry) {
+	if c.mutationCheck && v.packed == nil && v.value != nil {
+		v.checksum = checksum(v.value)
+	}
+}
+
+// checkMutation reports the value of v, cached under key, if it no longer
+// matches the checksum it was sealed with.
+func (c *cache) checkMutation(key string, v *Entry) {
+	if v.checksum == 0 || checksum(v.value) == v.checksum {
+		return
+	}
+
+	c.stats.mutations.Add(1)
+	if c.mutationPanics {
+		panic(fmt.Sprintf("memcachedb: cached value for key %q was modified in place", key))
+	}
+	c.logger.Error("memcachedb: cached value modified in place", "key", key, "type", fmt.Sprintf("%T", v.value))
+}
@@ -0,0 +1,110 @@
+// Package mysqlbinlog invalidates memcachedb cache entries from the MySQL
+// binary log. It connects as a replica, reads row events and maps every
+// changed table, and optionally every changed row, to invalidations.
+//
+// The server must log in ROW format.
+package mysqlbinlog
+
+import (
+	"context"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+
+	memcachedb "memcache-database-module"
+)
+
+type (
+	// Config configures a Tailer.
+	Config struct {
+		// Syncer is the replication connection. ServerID must be unique
+		// among the replicas of the server.
+		Syncer replication.BinlogSyncerConfig
+		// Position is where to start reading. The zero value starts at the
+		// oldest binlog still on the server.
+		Position mysql.Position
+		// Tables holds the rules of the tables to follow, keyed by
+		// "schema.table" or bare "table". When it is empty every table is
+		// followed with the zero Rule.
+		Tables map[string]Rule
+	}
+
+	// Rule says how changes to one table invalidate the cache.
+	Rule struct {
+		// Tags returns the tags to invalidate for a changed row, given the
+		// row image as decoded by the replication client. Update events
+		// call it for both the before and the after image.
+		Tags func(row []interface{}) []string
+		// RowsOnly skips invalidating every entry of the table, leaving
+		// invalidation to Tags.
+		RowsOnly bool
+	}
+
+	// Tailer follows the binlog and applies changes to a cache.
+	Tailer struct {
+		cache memcachedb.Cache
+		cfg   Config
+	}
+)
+
+// New returns a Tailer applying changes to c.
+func New(c memcachedb.Cache, cfg Config) *Tailer {
+	return &Tailer{cache: c, cfg: cfg}
+}
+
+// Run reads the binlog until ctx is done or the connection fails.
+func (t *Tailer) Run(ctx context.Context) error {
+	syncer := replication.NewBinlogSyncer(t.cfg.Syncer)
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(t.cfg.Position)
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return err
+		}
+		t.Handle(ev)
+	}
+}
+
+// Handle applies a single binlog event to the cache. Events other than row
+// events are ignored.
+func (t *Tailer) Handle(ev *replication.BinlogEvent) {
+	rows, ok := ev.Event.(*replication.RowsEvent)
+	if !ok || rows.Table == nil {
+		return
+	}
+
+	table := string(rows.Table.Table)
+	rule, ok := t.rule(string(rows.Table.Schema), table)
+	if !ok {
+		return
+	}
+
+	if !rule.RowsOnly {
+		t.cache.InvalidateTables(table)
+	}
+	if rule.Tags != nil {
+		for _, row := range rows.Rows {
+			for _, tag := range rule.Tags(row) {
+				t.cache.InvalidateTag(tag)
+			}
+		}
+	}
+}
+
+func (t *Tailer) rule(schema, table string) (Rule, bool) {
+	if len(t.cfg.Tables) == 0 {
+		return Rule{}, true
+	}
+	if r, ok := t.cfg.Tables[schema+"."+table]; ok {
+		return r, true
+	}
+	r, ok := t.cfg.Tables[table]
+
+	return r, ok
+}
@@ -0,0 +1,248 @@
+package memcachedb
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Namespace is a view of a Cache confined to the keys of one logical
+	// domain, as returned by Cache.Namespace. Keys taken and returned by
+	// its methods are relative to the namespace: the entry of key is held
+	// by the cache under the namespace prefix followed by key.
+	Namespace struct {
+		c      *cache
+		name   string
+		prefix string
+		opts   []CallOption
+		stats  *namespaceCounters
+	}
+
+	// NamespaceStats is a point-in-time snapshot of the counters of a
+	// namespace.
+	NamespaceStats struct {
+		// Hits counts calls served from the cache.
+		Hits uint64
+		// Misses counts calls that found no entry.
+		Misses uint64
+		// Loads counts query executions.
+		Loads uint64
+		// LoadErrors counts query executions that returned an error.
+		LoadErrors uint64
+
+		// Entries is the number of entries currently cached.
+		Entries int
+	}
+
+	// NamespaceConfig tunes one namespace apart from the rest of the
+	// cache, as set by WithNamespaceConfig. Zero fields inherit the
+	// settings of the cache.
+	NamespaceConfig struct {
+		// TTL is the TTL default of the calls made through the views of
+		// the namespace.
+		TTL time.Duration `yaml:"ttl"`
+		// MaxEntries and MaxBytes, if either is set, give the namespace
+		// storage of its own, bounded to them and evicting by Eviction,
+		// so that it neither crowds out nor is crowded out by the rest of
+		// the cache. Its budget adds to that of the cache.
+		MaxEntries int   `yaml:"max_entries"`
+		MaxBytes   int64 `yaml:"max_bytes"`
+		// Eviction is "lru", "lfu" or "arc".
+		Eviction string `yaml:"eviction"`
+	}
+
+	namespaceCounters struct {
+		hits       atomic.Uint64
+		misses     atomic.Uint64
+		loads      atomic.Uint64
+		loadErrors atomic.Uint64
+	}
+)
+
+// HitRatio returns the fraction of calls served from the cache.
+func (s NamespaceStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+func (c *cache) Namespace(name string, opts ...CallOption) *Namespace {
+	v, _ := c.namespaces.LoadOrStore(name, new(namespaceCounters))
+	stats := v.(*namespaceCounters)
+
+	defaults := []CallOption{inNamespace(stats)}
+	if p := c.profiles[name]; p.TTL > 0 {
+		defaults = append(defaults, WithTTL(p.TTL))
+	}
+
+	return &Namespace{
+		c:      c,
+		name:   name,
+		prefix: name + ":",
+		opts:   append(defaults, opts...),
+		stats:  stats,
+	}
+}
+
+// routeNamespaces gives storage of their own to the namespaces configured
+// with bounds.
+func (c *cache) routeNamespaces() {
+	for name, p := range c.profiles {
+		if p.MaxEntries <= 0 && p.MaxBytes <= 0 {
+			continue
+		}
+		eviction, ok := evictionPolicies[p.Eviction]
+		if !ok {
+			eviction = c.eviction
+		}
+		if c.routes == nil {
+			c.routes = make(map[string][]segment)
+		}
+		c.routes[name] = c.newShards(p.MaxEntries, p.MaxBytes, eviction)
+		c.shards = append(c.shards, c.routes[name]...)
+	}
+}
+
+// inNamespace counts a call against the statistics of a namespace.
+func inNamespace(stats *namespaceCounters) CallOption {
+	return func(o *callOptions) {
+		o.ns = stats
+	}
+}
+
+// Name returns the name of the namespace.
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// Key returns the key under which the result for args, as they would be
+// passed to DoContext or Do, is cached in the namespace.
+func (n *Namespace) Key(args ...interface{}) (string, error) {
+	args, _ = n.c.splitArgs(args)
+	key, _, err := n.c.hash(args...)
+
+	return key, err
+}
+
+// DoContext is Cache.DoContext within the namespace.
+func (n *Namespace) DoContext(ctx context.Context, query func(ctx context.Context, args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
+	args, o := n.c.splitArgs(args, n.opts...)
+	h, fp, err := n.c.hash(args...)
+	if err != nil {
+		return nil, err
+	}
+	o.fingerprint = fp
+	n.c.trackPattern(&o, n.c.funcPattern(query))
+
+	return n.c.load(ctx, n.prefix+h, o, func(ctx context.Context) (interface{}, error) {
+		return query(ctx, args...)
+	})
+}
+
+// Do is Cache.Do within the namespace.
+func (n *Namespace) Do(query func(args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
+	if n.c.patterns != nil {
+		// Counted under query rather than the wrapper below; a Pattern
+		// among args still comes after.
+		args = append([]interface{}{Pattern(n.c.patterns.funcName(query))}, args...)
+	}
+	return n.DoContext(context.Background(), func(_ context.Context, args ...interface{}) (interface{}, error) {
+		return query(args...)
+	}, args...)
+}
+
+// DoKeyed is Cache.DoKeyed within the namespace.
+func (n *Namespace) DoKeyed(ctx context.Context, key string, loader func(ctx context.Context) (interface{}, error), opts ...CallOption) (interface{}, error) {
+	return n.c.DoKeyed(ctx, n.prefix+key, loader, slices.Concat(n.opts, opts)...)
+}
+
+// Set is Cache.Set within the namespace. A ttl that is not positive stands
+// for the TTL default of the namespace.
+func (n *Namespace) Set(key string, value interface{}, ttl time.Duration, opts ...CallOption) error {
+	return n.c.Set(n.prefix+key, value, ttl, slices.Concat(n.opts, opts)...)
+}
+
+// Peek is Cache.Peek within the namespace.
+func (n *Namespace) Peek(args ...interface{}) (interface{}, bool) {
+	args, _ = n.c.splitArgs(args)
+	h, fp, err := n.c.hash(args...)
+	if err != nil {
+		return nil, false
+	}
+
+	return n.c.peek(n.prefix+h, fp)
+}
+
+// PeekKey is Cache.PeekKey within the namespace.
+func (n *Namespace) PeekKey(key string) (interface{}, bool) {
+	return n.c.PeekKey(n.prefix + key)
+}
+
+// Keys is Cache.Keys within the namespace, its keys matched and returned
+// without the namespace prefix.
+func (n *Namespace) Keys(pattern string, limit int, cursor string) ([]string, string, error) {
+	return n.c.pageKeys(n.segments(), n.prefix, pattern, limit, cursor)
+}
+
+// segments returns the segments holding the entries of the namespace.
+func (n *Namespace) segments() []segment {
+	if shards, ok := n.c.routes[n.name]; ok {
+		return shards
+	}
+
+	return n.c.shards
+}
+
+// Invalidate is Cache.Invalidate within the namespace.
+func (n *Namespace) Invalidate(args ...interface{}) error {
+	key, err := n.Key(args...)
+	if err != nil {
+		return err
+	}
+	n.InvalidateKey(key)
+
+	return nil
+}
+
+// InvalidateKey is Cache.InvalidateKey within the namespace.
+func (n *Namespace) InvalidateKey(key string) bool {
+	return n.c.InvalidateKey(n.prefix + key)
+}
+
+// InvalidateAll removes every entry cached in the namespace and returns how
+// many were removed.
+func (n *Namespace) InvalidateAll() int {
+	return n.c.FlushPrefix(n.prefix)
+}
+
+// Stats returns a snapshot of the counters of the namespace.
+func (n *Namespace) Stats() NamespaceStats {
+	entries := 0
+	n.scan(func(string, *Entry) { entries++ })
+
+	return NamespaceStats{
+		Hits:       n.stats.hits.Load(),
+		Misses:     n.stats.misses.Load(),
+		Loads:      n.stats.loads.Load(),
+		LoadErrors: n.stats.loadErrors.Load(),
+		Entries:    entries,
+	}
+}
+
+// scan calls fn for every entry cached in the namespace.
+func (n *Namespace) scan(fn func(key string, e *Entry)) {
+	for _, s := range n.segments() {
+		s.scan(func(key string, e *Entry) bool {
+			if strings.HasPrefix(key, n.prefix) {
+				fn(key, e)
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,536 @@
+package memcachedb
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithDefaultTTL sets how long entries live unless the call caching them
+// says otherwise with WithTTL.
+func WithDefaultTTL(d time.Duration) Option {
+	return func(c *cache) {
+		c.ttl = d
+	}
+}
+
+// WithContext stops the janitor when ctx is done, rather than only on Stop.
+func WithContext(ctx context.Context) Option {
+	return func(c *cache) {
+		c.ctx = ctx
+	}
+}
+
+// WithNamespaceConfig tunes the namespace name, as returned by
+// Cache.Namespace, apart from the rest of the cache: for instance
+// reference data cached for an hour next to balances cached for two
+// seconds, each within bounds of its own. The name must not contain ':'.
+func WithNamespaceConfig(name string, cfg NamespaceConfig) Option {
+	return func(c *cache) {
+		if c.profiles == nil {
+			c.profiles = make(map[string]NamespaceConfig)
+		}
+		c.profiles[name] = cfg
+	}
+}
+
+// WithClock sets the Clock the lifetimes of entries and the janitor keep
+// to, SystemClock unless set.
+func WithClock(clk Clock) Option {
+	return func(c *cache) {
+		c.clock = clk
+	}
+}
+
+// WithShards sets the number of lock-striped shards the entries are spread
+// across. More shards mean less lock contention under concurrent use.
+func WithShards(n int) Option {
+	return func(c *cache) {
+		c.shardCount = n
+	}
+}
+
+// WithCleanupInterval makes the janitor remove expired entries every d
+// rather than every TTL. Expired entries are never served either way; the
+// interval bounds how long those nobody asks for hold memory.
+func WithCleanupInterval(d time.Duration) Option {
+	return func(c *cache) {
+		c.cleanupInterval = d
+	}
+}
+
+// WithoutJanitor keeps New from starting the janitor, leaving no goroutine
+// behind for tests, serverless functions and other embedders that decide
+// when expired entries go: SweepExpired removes them, and Start still
+// launches the janitor later. Expired entries are never served either way.
+func WithoutJanitor() Option {
+	return func(c *cache) {
+		c.noJanitor = true
+	}
+}
+
+// WithJitter randomizes each entry's TTL by up to ±fraction of it, so that
+// entries created together do not all expire together. 0.1 spreads
+// expirations over ±10% of the TTL.
+func WithJitter(fraction float64) Option {
+	return func(c *cache) {
+		if fraction > 0 && fraction < 1 {
+			c.jitter = fraction
+		}
+	}
+}
+
+// WithMaxEntries bounds the cache to n entries, evicting entries beyond
+// that according to the eviction policy. The bound is split evenly across
+// shards, of which there are no more than n.
+func WithMaxEntries(n int) Option {
+	return func(c *cache) {
+		c.maxEntries = n
+	}
+}
+
+// WithEvictionPolicy sets the policy used once WithMaxEntries is reached.
+// The default is EvictLRU.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(c *cache) {
+		c.eviction = p
+	}
+}
+
+// WithTinyLFU puts a TinyLFU admission filter in front of the eviction
+// policy: once a shard is full, a new entry is only stored if its key has
+// been requested more often than the key it would evict. This keeps
+// one-off results from pushing out hot entries. It has no effect unless the
+// cache is bounded by WithMaxEntries or WithMaxBytes.
+func WithTinyLFU() Option {
+	return func(c *cache) {
+		c.tinyLFU = true
+	}
+}
+
+// WithMaxBytes bounds the total cost of cached entries to about n bytes,
+// evicting entries according to the eviction policy beyond that. The cost of
+// an entry comes from WithCost, or from a reflection-based estimate of its
+// memory use. The budget is split evenly across shards; a single entry
+// costing more than a shard's share is not cached.
+func WithMaxBytes(n int64) Option {
+	return func(c *cache) {
+		c.maxBytes = n
+	}
+}
+
+// WithCost sets the function that weighs entries against WithMaxBytes.
+func WithCost(cost func(key string, value interface{}) int64) Option {
+	return func(c *cache) {
+		c.cost = cost
+	}
+}
+
+// WithResultLimit leaves uncached the loaded results of more than rows
+// rows, counted as the length of a slice, array or map, or costing more
+// than bytes, as weighed by WithCost or estimated, so that a rare massive
+// report does not push out thousands of small hot entries. The call still
+// returns the result, and any entry it was refreshing is dropped. Zero
+// disables either limit.
+func WithResultLimit(rows int, bytes int64) Option {
+	return func(c *cache) {
+		c.resultRows = rows
+		c.resultBytes = bytes
+	}
+}
+
+// WithMaxValueSize refuses to cache values of more than n bytes: their
+// encoded length under WithCodec or WithCompression, or their cost as
+// weighed by WithCost or estimated. Set fails with ErrValueTooLarge, and a
+// load returns its result together with ErrValueTooLarge rather than
+// caching it. Unlike WithResultLimit, callers learn about it.
+func WithMaxValueSize(n int64) Option {
+	return func(c *cache) {
+		c.maxValueSize = n
+	}
+}
+
+// WithCompression stores values of at least minSize bytes encoded and
+// compressed with algo, decoding them again on every hit. This fits more
+// large results in memory, and within WithMaxBytes, at the cost of CPU;
+// hits then get a copy of the value rather than the one loaded. Values are
+// encoded with the codec set by WithCodec, or else with GobCodec; those it
+// cannot encode are stored as they are.
+func WithCompression(algo Compression, minSize int64) Option {
+	return func(c *cache) {
+		c.compression = algo
+		c.compressMin = minSize
+	}
+}
+
+// WithCodec stores every cached value encoded with codec rather than as
+// the live value the query returned, decoding it on every hit. Hits then
+// get a copy of their own, so that a caller modifying a result cannot
+// corrupt the entry or race with other callers. Values the codec cannot
+// encode are stored as they are.
+func WithCodec(codec Codec) Option {
+	return func(c *cache) {
+		c.codec = codec
+	}
+}
+
+// WithCopyOnReturn makes the cache hand every caller a copy of the cached
+// value made by clone, and keep a copy of the values passed to Set, so
+// that no caller can modify a value another one sees. CloneWith makes a
+// clone function out of a Codec. Values stored encoded by WithCodec are
+// decoded afresh for every hit and not cloned again.
+func WithCopyOnReturn(clone func(v interface{}) interface{}) Option {
+	return func(c *cache) {
+		c.clone = clone
+	}
+}
+
+// WithMutationCheck is a development aid catching callers that modify
+// cached values in place, which corrupts them for every other caller. The
+// cache checksums each value it stores and checks it again on every hit,
+// Peek and removal, logging a value found modified as an error, or
+// panicking when panics is set. Checksumming walks the whole value on
+// every access, so leave it off in production.
+func WithMutationCheck(panics bool) Option {
+	return func(c *cache) {
+		c.mutationCheck = true
+		c.mutationPanics = panics
+	}
+}
+
+// WithMemoryPressure sheds cached entries while the process is close to
+// its memory limit, least recently used first or as the eviction policy
+// prefers, and holds the cache to its reduced size until the pressure
+// drops. It has no effect on a Store set by WithStore.
+func WithMemoryPressure(p MemoryPressure) Option {
+	return func(c *cache) {
+		c.pressure = &p
+	}
+}
+
+// WithPreparedStatements makes the loads of GetContext, SelectContext and
+// their named variants run on prepared statements, keeping those of the n
+// most recently loaded queries for later loads. The statements are closed
+// once the cache is stopped and drained.
+func WithPreparedStatements(n int) Option {
+	return func(c *cache) {
+		c.stmtCount = n
+	}
+}
+
+// WithTracerProvider traces cache calls with tp. Every call gets a span
+// recording the key and whether it hit, and each database load a child span
+// covering the query. Tracing is off by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *cache) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithExpvar publishes the cache statistics and configuration as the expvar
+// variable name, so they show up under /debug/vars. Publishing two caches
+// under the same name panics, as expvar.Publish does.
+func WithExpvar(name string) Option {
+	return func(c *cache) {
+		c.expvarName = name
+	}
+}
+
+// WithPatternStats counts hits, misses and loads by query pattern as well,
+// for TopPatterns to tell which queries cache poorly or load slowly: every
+// SQL statement, table of rows and query function apart, up to 1000 of
+// them, past which the rest count under "(other)". Name patterns with the
+// Pattern call option where query functions are built on the fly.
+func WithPatternStats() Option {
+	return func(c *cache) {
+		c.patterns = new(patterns)
+	}
+}
+
+// WithKeyTrace records what happens to the keys match accepts, or to every
+// key if match is nil: when they are cached, hit, missed, refreshed, fail
+// to load and leave the cache, and why. The latest size events are kept,
+// for Trace to answer why an entry was stale or missing. Tracing costs a
+// lock per event; keep match narrow on busy caches.
+func WithKeyTrace(size int, match func(key string) bool) Option {
+	return func(c *cache) {
+		c.traceSize, c.traceMatch = size, match
+	}
+}
+
+// WithLogger makes the cache log notable events to logger: failed and slow
+// loads at error and warning level, janitor sweeps and evictions at debug
+// level. The cache logs nothing by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *cache) {
+		c.logger = logger
+	}
+}
+
+// WithSlowLoadThreshold makes the cache log a warning for every load that
+// takes d or longer.
+func WithSlowLoadThreshold(d time.Duration) Option {
+	return func(c *cache) {
+		c.slowLoad = d
+	}
+}
+
+// WithOnEvict calls fn whenever an entry leaves the cache, whether it
+// expired, was evicted or was removed explicitly. fn runs synchronously on
+// the goroutine that removed the entry, outside of any cache lock.
+func WithOnEvict(fn func(key string, value interface{}, reason Reason)) Option {
+	return func(c *cache) {
+		c.onEvict = fn
+	}
+}
+
+// WithLoaderTimeout cuts every query off after d, whatever the deadline of
+// the caller, failing the load with a TimeoutError. The query's context is
+// cancelled then; one that ignores it keeps running in the background, its
+// result dropped. If serveStale is set, a call whose load times out is
+// served the entry still held for the key, even expired, if there is one.
+func WithLoaderTimeout(d time.Duration, serveStale bool) Option {
+	return func(c *cache) {
+		c.loaderTimeout = d
+		c.staleOnTimeout = serveStale && d > 0
+	}
+}
+
+// WithStaleOnError serves a call whose load fails the entry still held for
+// its key, even expired, if there is one, instead of the error. Expired
+// entries are held until the janitor removes them, one cleanup interval at
+// most. onStale, if set, is called with the key and the error each time;
+// it runs synchronously on the goroutine of the call.
+func WithStaleOnError(onStale func(key string, err error)) Option {
+	return func(c *cache) {
+		c.staleOnError = true
+		c.onStale = onStale
+	}
+}
+
+// WithCircuitBreaker guards the database with the circuit breaker b, so
+// that a failing database stops receiving queries for a while. Calls whose
+// load is refused are served the entry still held for their key, even
+// expired, if there is one, and fail with ErrCircuitOpen otherwise. A
+// Breaker with neither Failures nor FailureRate set never opens.
+func WithCircuitBreaker(b Breaker) Option {
+	return func(c *cache) {
+		if b.Failures > 0 || b.FailureRate > 0 {
+			c.breakerCfg = &b
+		} else {
+			c.breakerCfg = nil
+		}
+	}
+}
+
+// WithAdaptiveTTL scales the TTL of every loaded entry by how often its
+// key's value changes: each reload finding the value unchanged lengthens
+// the TTL of the key, each finding it changed shortens it, within a's
+// bounds. Values are compared by checksum, as WithMutationCheck does;
+// values it cannot checksum keep their TTL. It is ignored unless a.Max is
+// positive.
+func WithAdaptiveTTL(a AdaptiveTTL) Option {
+	return func(c *cache) {
+		if a.Max > 0 {
+			c.adaptiveCfg = &a
+		} else {
+			c.adaptiveCfg = nil
+		}
+	}
+}
+
+// WithStaleWhileRevalidate keeps serving entries for up to staleFor after
+// their TTL while a background load refreshes them, trading bounded
+// staleness for latency. At most maxRefreshes refreshes run at once; stale
+// hits beyond that are served without starting one.
+func WithStaleWhileRevalidate(staleFor time.Duration, maxRefreshes int) Option {
+	return func(c *cache) {
+		c.staleFor = staleFor
+		c.maxRefreshes = maxRefreshes
+	}
+}
+
+// WithSlidingTTL makes every hit on an entry push its expiry back to a
+// full TTL from the hit, so that entries in use stay cached, as sessions
+// do. maxLifetime, if positive, is how long an entry lives at most however
+// often it is hit. The TTL is that of the entry when it was cached,
+// including the stale period of WithStaleWhileRevalidate.
+func WithSlidingTTL(maxLifetime time.Duration) Option {
+	return func(c *cache) {
+		c.sliding = true
+		c.maxLifetime = maxLifetime
+	}
+}
+
+// WithMaxIdle removes entries that went unread for d, however long their
+// TTL, so that cold keys stop taking memory under long TTLs. Without
+// WithCleanupInterval the janitor then sweeps at least every d. Entries
+// held by a Store that decodes them on every read are left alone.
+func WithMaxIdle(d time.Duration) Option {
+	return func(c *cache) {
+		c.maxIdle = d
+	}
+}
+
+// WithRefreshAhead makes a hit on an entry that has lived past fraction of
+// its TTL reload it in the background, so keys that keep being read are
+// refreshed before they expire and never take a miss. 0.8 refreshes once
+// 80% of the TTL has elapsed. Refreshes share the limit set by
+// WithStaleWhileRevalidate, or 16 without it.
+func WithRefreshAhead(fraction float64) Option {
+	return func(c *cache) {
+		if fraction > 0 && fraction < 1 {
+			c.refreshAhead = fraction
+		}
+	}
+}
+
+// WithNegativeCaching caches empty results for ttl, usually shorter than the
+// cache TTL, so that lookups of missing rows stop reaching the database.
+// A query returning sql.ErrNoRows, or a nil result without an error, counts
+// as empty; hits on it return the same error or nil result.
+func WithNegativeCaching(ttl time.Duration) Option {
+	return func(c *cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithErrorPolicy sets which query errors are cached and for how long. By
+// default no error is cached. sql.ErrNoRows is governed by
+// WithNegativeCaching when that is set.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(c *cache) {
+		c.errorPolicy = p
+	}
+}
+
+// WithLoadInterval runs the query of a key at most once every d, guarding
+// the database against loops that keep invalidating and reloading the
+// same keys. A load held back is served the result of the last one while
+// that is still cached or was dropped since; otherwise it waits for its
+// turn.
+func WithLoadInterval(d time.Duration) Option {
+	return func(c *cache) {
+		c.loadInterval = d
+	}
+}
+
+// WithHedging runs a query a second time when the first run has not
+// returned within the latency at h.Percentile of past loads, and takes
+// whichever succeeds first, cancelling the other. This trades extra
+// database load for a shorter tail. Queries passed to DoContext must be
+// safe to run twice at once; they can tell the second run by IsHedge.
+func WithHedging(h Hedging) Option {
+	return func(c *cache) {
+		if h.Percentile > 0 && h.Percentile < 1 {
+			c.hedging = &h
+		} else {
+			c.hedging = nil
+		}
+	}
+}
+
+// WithRetryPolicy sets how failed queries are retried. By default they are
+// not. Under WithLoaderTimeout every run gets the full timeout.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *cache) {
+		c.retry = p
+	}
+}
+
+// WithBatchConcurrency lets DoMulti run up to n queries of a batch at once.
+// By default they run one after another.
+func WithBatchConcurrency(n int) Option {
+	return func(c *cache) {
+		c.batchConcurrency = n
+	}
+}
+
+// WithWarmConcurrency lets Warm run up to n specs at once. By default they
+// run one after another.
+func WithWarmConcurrency(n int) Option {
+	return func(c *cache) {
+		c.warmConcurrency = n
+	}
+}
+
+// WithWarmProgress calls fn each time Warm finishes a spec. Calls are
+// serialized.
+func WithWarmProgress(fn func(p WarmProgress)) Option {
+	return func(c *cache) {
+		c.warmProgress = fn
+	}
+}
+
+// WithSnapshot restores the cache from the snapshot file at path when it is
+// created and, if every is positive, saves a snapshot there every interval
+// and once more on Stop, after the calls in flight finish. See SaveSnapshot
+// for what a snapshot holds.
+func WithSnapshot(path string, every time.Duration) Option {
+	return func(c *cache) {
+		c.snapshotPath = path
+		c.snapshotInterval = every
+	}
+}
+
+// WithAppendLog records every entry cached and every invalidation in an
+// append-only log at path, so that a cache created with the same path after
+// a crash comes back in the exact last state instead of that of the latest
+// snapshot. The log is replayed and compacted when the cache is created and
+// compacted again in the background whenever it grows mostly stale. It is
+// closed on Stop, after the calls in flight finish. Records reach the disk
+// within syncEvery, or before each call returns when syncEvery is not
+// positive. As with snapshots, cached value types must be registered with
+// gob.Register.
+func WithAppendLog(path string, syncEvery time.Duration) Option {
+	return func(c *cache) {
+		c.logPath = path
+		c.logSyncEvery = syncEvery
+	}
+}
+
+// WithL2 puts t behind the cache as a second level shared with other
+// processes. A miss is served from t when it has the entry, and only runs
+// the query otherwise; loaded results and values passed to Set are copied
+// to t, and invalidations remove them from it. Tags and tables are tracked
+// per process, so InvalidateTag and InvalidateTables only reach the
+// entries this process has cached, and ForceRefresh skips t.
+func WithL2(t Tier) Option {
+	return func(c *cache) {
+		c.l2 = t
+	}
+}
+
+// WithStore keeps the entries of the cache in st instead of the built-in
+// sharded map. See Store for the options it overrides.
+func WithStore(st Store) Option {
+	return func(c *cache) {
+		c.backend = st
+	}
+}
+
+// WithPeers makes the cache one of a group of processes that split the keys
+// between them, multiplying the number of entries the group holds. Keys
+// owned by another process, as picked by p, are not cached locally: a miss
+// asks the owner for its entry, and only when it has none runs the query
+// and hands the result to the owner. Set and InvalidateKey act on the
+// owner as well. Tags and tables are tracked by each owner, so
+// InvalidateTag, InvalidateTables and InvalidateWhere must run on every
+// process of the group, as pgnotify does.
+func WithPeers(p PeerPicker) Option {
+	return func(c *cache) {
+		c.peers = p
+	}
+}
+
+// WithHasher derives the keys of calls from their arguments with h instead
+// of XXHash. Changing hashers changes every key, so entries saved in
+// snapshots, append logs or shared tiers under the old keys are no longer
+// found.
+func WithHasher(h Hasher) Option {
+	return func(c *cache) {
+		c.hasher = h
+	}
+}
@@ -0,0 +1,222 @@
+package memcachedb
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxPatterns bounds how many query patterns WithPatternStats tracks
+	// apart; the calls of the others count under otherPattern.
+	maxPatterns  = 1000
+	otherPattern = "(other)"
+)
+
+// Orders of TopPatterns.
+const (
+	// ByMissRate ranks patterns by the fraction of their calls missing,
+	// then by their misses.
+	ByMissRate PatternOrder = iota
+	// ByLoadLatency ranks patterns by their mean query duration.
+	ByLoadLatency
+	// ByLoadTime ranks patterns by the total duration of their queries.
+	ByLoadTime
+)
+
+type (
+	// PatternStats is a point-in-time snapshot of the counters of a query
+	// pattern, as tracked by WithPatternStats.
+	PatternStats struct {
+		// Pattern names the calls counted: the SQL of GetContext and
+		// its variants, "rows:" and the table for GetRowContext and
+		// SelectRowsContext, the name of the query function for
+		// DoContext, its variants and the requests of DoMulti, or the
+		// name given with Pattern.
+		Pattern string
+		// Hits counts calls served from the cache.
+		Hits uint64
+		// Misses counts calls that found no entry.
+		Misses uint64
+		// Loads counts query executions.
+		Loads uint64
+		// LoadErrors counts query executions that returned an error.
+		LoadErrors uint64
+		// LoadTime is the total duration of the queries.
+		LoadTime time.Duration
+	}
+
+	// PatternOrder is how TopPatterns ranks patterns.
+	PatternOrder int
+
+	patternCounters struct {
+		hits       atomic.Uint64
+		misses     atomic.Uint64
+		loads      atomic.Uint64
+		loadErrors atomic.Uint64
+		loadTime   atomic.Int64
+	}
+
+	// patterns holds the counters of the query patterns by name.
+	patterns struct {
+		counters sync.Map
+		n        atomic.Int64
+		// funcs caches the names of query functions by entry point.
+		funcs sync.Map
+	}
+)
+
+// HitRatio returns the fraction of calls served from the cache.
+func (s PatternStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+// MissRate returns the fraction of calls that found no entry.
+func (s PatternStats) MissRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Misses) / float64(total)
+}
+
+// LoadLatency returns the mean duration of the queries.
+func (s PatternStats) LoadLatency() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+
+	return s.LoadTime / time.Duration(s.Loads)
+}
+
+// Pattern names the query pattern this call counts under in the report of
+// WithPatternStats, in place of its SQL or the name of its query function.
+func Pattern(name string) CallOption {
+	return func(o *callOptions) {
+		o.pattern = name
+	}
+}
+
+// get returns the counters of the pattern name, or of otherPattern once
+// maxPatterns are tracked.
+func (p *patterns) get(name string) *patternCounters {
+	if v, ok := p.counters.Load(name); ok {
+		return v.(*patternCounters)
+	}
+	if p.n.Load() >= maxPatterns {
+		name = otherPattern
+	}
+	v, loaded := p.counters.LoadOrStore(name, new(patternCounters))
+	if !loaded {
+		p.n.Add(1)
+	}
+
+	return v.(*patternCounters)
+}
+
+// funcName returns the name of the function fn.
+func (p *patterns) funcName(fn interface{}) string {
+	pc := reflect.ValueOf(fn).Pointer()
+	if name, ok := p.funcs.Load(pc); ok {
+		return name.(string)
+	}
+	name := "func"
+	if f := runtime.FuncForPC(pc); f != nil {
+		name = f.Name()
+	}
+	p.funcs.Store(pc, name)
+
+	return name
+}
+
+// trackPattern points o at the counters of its pattern, named name unless
+// set with Pattern, when WithPatternStats is set.
+func (c *cache) trackPattern(o *callOptions, name func() string) {
+	if c.patterns == nil {
+		return
+	}
+	if o.pattern == "" {
+		o.pattern = name()
+	}
+	o.pat = c.patterns.get(o.pattern)
+}
+
+// sqlPattern returns the pattern of the calls running query: its SQL, with
+// runs of whitespace collapsed.
+func sqlPattern(query string) func() string {
+	return func() string {
+		return strings.Join(strings.Fields(query), " ")
+	}
+}
+
+// rowsPattern returns the pattern of the calls loading rows of table.
+func rowsPattern(table string) func() string {
+	return func() string {
+		return "rows:" + strings.ToLower(table)
+	}
+}
+
+// funcPattern returns the pattern of the calls running the query function
+// fn: its name.
+func (c *cache) funcPattern(fn interface{}) func() string {
+	return func() string {
+		return c.patterns.funcName(fn)
+	}
+}
+
+func (c *cache) TopPatterns(n int, by PatternOrder) []PatternStats {
+	if c.patterns == nil {
+		return nil
+	}
+
+	var all []PatternStats
+	c.patterns.counters.Range(func(k, v any) bool {
+		p := v.(*patternCounters)
+		all = append(all, PatternStats{
+			Pattern:    k.(string),
+			Hits:       p.hits.Load(),
+			Misses:     p.misses.Load(),
+			Loads:      p.loads.Load(),
+			LoadErrors: p.loadErrors.Load(),
+			LoadTime:   time.Duration(p.loadTime.Load()),
+		})
+		return true
+	})
+
+	less := func(a, b PatternStats) bool {
+		switch by {
+		case ByLoadLatency:
+			if a.LoadLatency() != b.LoadLatency() {
+				return a.LoadLatency() > b.LoadLatency()
+			}
+		case ByLoadTime:
+			if a.LoadTime != b.LoadTime {
+				return a.LoadTime > b.LoadTime
+			}
+		default:
+			if a.MissRate() != b.MissRate() {
+				return a.MissRate() > b.MissRate()
+			}
+			if a.Misses != b.Misses {
+				return a.Misses > b.Misses
+			}
+		}
+		return a.Pattern < b.Pattern
+	}
+	sort.Slice(all, func(i, j int) bool { return less(all[i], all[j]) })
+	if n > 0 && n < len(all) {
+		all = all[:n]
+	}
+
+	return all
+}
@@ -0,0 +1,41 @@
+package memcachedb
+
+import (
+	"context"
+	"testing"
+)
+
+func loadUser(_ context.Context, args ...interface{}) (interface{}, error) {
+	return args[0], nil
+}
+
+func TestPatternsDoMulti(t *testing.T) {
+	c := New(nil, WithoutJanitor(), WithPatternStats())
+	defer c.Stop(context.Background())
+	ctx := context.Background()
+
+	c.DoContext(ctx, loadUser, 1)
+	if _, err := c.DoMulti(ctx, []Request{
+		{Query: loadUser, Args: []interface{}{1}},
+		{Query: loadUser, Args: []interface{}{2}},
+		{Query: loadUser, Args: []interface{}{3, Pattern("named")}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]PatternStats)
+	for _, p := range c.TopPatterns(0, ByMissRate) {
+		got[p.Pattern] = p
+	}
+	if p := got[funcName(loadUser)]; p.Hits != 1 || p.Misses != 2 || p.Loads != 2 {
+		t.Errorf("pattern of loadUser = %+v, want 1 hit, 2 misses and 2 loads", p)
+	}
+	if p := got["named"]; p.Misses != 1 || p.Loads != 1 {
+		t.Errorf("named pattern = %+v, want 1 miss and 1 load", p)
+	}
+}
+
+// funcName returns the pattern calls running fn count under.
+func funcName(fn interface{}) string {
+	return new(patterns).funcName(fn)
+}
@@ -0,0 +1,37 @@
+package memcachedb
+
+func (c *cache) Peek(args ...interface{}) (interface{}, bool) {
+	args, _ = c.splitArgs(args)
+	h, fp, err := c.hash(args...)
+	if err != nil {
+		return nil, false
+	}
+
+	return c.peek(h, fp)
+}
+
+func (c *cache) PeekKey(key string) (interface{}, bool) {
+	return c.peek(key, 0)
+}
+
+// peek returns the value cached under key for the arguments fingerprinted
+// as fp.
+func (c *cache) peek(key string, fp uint64) (interface{}, bool) {
+	if !c.begin() {
+		return nil, false
+	}
+	defer c.end()
+
+	s := c.shard(key)
+	v, ok := s.lookup(key)
+	if !ok || c.expired(s, key, v) || v.err != nil || !v.matches(fp) {
+		return nil, false
+	}
+	c.checkMutation(key, v)
+
+	if v.packed != nil {
+		return v.Value(), true
+	}
+
+	return c.isolate(v.value), true
+}
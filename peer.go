@@ -0,0 +1,192 @@
+package memcachedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"hash/crc32"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultReplicas = 64
+
+type (
+	// Peer is another process of a group of caches sharing their entries,
+	// as reached through some transport. It has the shape of a Tier: Get
+	// returns what the peer has cached, Set hands it an entry to keep and
+	// Delete invalidates an entry there.
+	Peer interface {
+		Tier
+	}
+
+	// PeerPicker tells which process of a group owns a key.
+	PeerPicker interface {
+		// PickPeer returns the peer owning key, or false when this
+		// process owns it.
+		PickPeer(key string) (Peer, bool)
+	}
+
+	// Ring is a PeerPicker spreading keys over a group of processes by
+	// consistent hashing, so that a change of membership only moves the
+	// keys of the processes joining or leaving.
+	Ring struct {
+		self     string
+		replicas int
+
+		mu     sync.RWMutex
+		hashes []uint32
+		owners map[uint32]string
+		peers  map[string]Peer
+	}
+
+	// localPeer is the side of a cache that serves its peers.
+	localPeer struct {
+		c *cache
+	}
+)
+
+// NewRing returns a Ring for the process named self, placing each process
+// at replicas points of the ring, or at 64 when replicas is not positive.
+// It owns every key until Set gives it peers.
+func NewRing(self string, replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+
+	return &Ring{self: self, replicas: replicas}
+}
+
+// Set replaces the members of the group with peers, keyed by process name.
+// The entry for the process of the ring itself, if any, is ignored.
+func (r *Ring) Set(peers map[string]Peer) {
+	names := []string{r.self}
+	for name := range peers {
+		if name != r.self {
+			names = append(names, name)
+		}
+	}
+
+	hashes := make([]uint32, 0, len(names)*r.replicas)
+	owners := make(map[uint32]string, len(names)*r.replicas)
+	for _, name := range names {
+		for i := 0; i < r.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + name))
+			if _, taken := owners[h]; taken {
+				continue
+			}
+			hashes = append(hashes, h)
+			owners[h] = name
+		}
+	}
+	slices.Sort(hashes)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hashes = hashes
+	r.owners = owners
+	r.peers = peers
+}
+
+// Owner returns the name of the process owning key.
+func (r *Ring) Owner(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.owner(key)
+}
+
+func (r *Ring) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return r.self
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	i, _ := slices.BinarySearch(r.hashes, h)
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.owners[r.hashes[i]]
+}
+
+func (r *Ring) PickPeer(key string) (Peer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name := r.owner(key)
+	if name == r.self {
+		return nil, false
+	}
+	p, ok := r.peers[name]
+
+	return p, ok
+}
+
+// owner returns the peer owning key when another process does.
+func (c *cache) owner(key string) (Peer, bool) {
+	if c.peers == nil {
+		return nil, false
+	}
+
+	return c.peers.PickPeer(key)
+}
+
+func (c *cache) Local() Peer {
+	return localPeer{c}
+}
+
+// Get returns the entry cached under key, counting it as an access. Entries
+// that are expired or cannot be encoded are reported as missing.
+func (p localPeer) Get(_ context.Context, key string) ([]byte, bool, error) {
+	if !p.c.begin() {
+		return nil, false, ErrStopped
+	}
+	defer p.c.end()
+
+	v, ok := p.c.shard(key).get(key)
+	if !ok || !v.persistable() || v.lifetime <= p.c.now() {
+		return nil, false, nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(newSnapshotEntry(key, v)); err != nil {
+		p.c.logger.Debug("memcachedb: entry not shared", "key", key, "error", err)
+		return nil, false, nil
+	}
+
+	return buf.Bytes(), true, nil
+}
+
+// Set caches the entry a peer loaded for a key this process owns. The
+// lifetime of the entry travels with it, so ttl is ignored.
+func (p localPeer) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	if !p.c.begin() {
+		return ErrStopped
+	}
+	defer p.c.end()
+
+	var e snapshotEntry
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&e); err != nil {
+		return err
+	}
+	if e.Lifetime > p.c.now() {
+		p.c.store(p.c.shard(key), key, p.c.restoredEntity(e))
+	}
+
+	return nil
+}
+
+func (p localPeer) Delete(_ context.Context, key string) error {
+	if !p.c.begin() {
+		return ErrStopped
+	}
+	defer p.c.end()
+
+	p.c.flush([]string{key}, ReasonInvalidated)
+
+	return nil
+}
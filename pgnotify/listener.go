@@ -0,0 +1,153 @@
+// Package pgnotify keeps memcachedb caches consistent across instances by
+// invalidating entries named in Postgres NOTIFY payloads.
+//
+// A payload is either a JSON object listing tags and tables,
+//
+//	{"tags": ["orders:42"], "tables": ["orders"]}
+//
+// or a comma-separated list of table names, which lets a plain trigger do
+// the work:
+//
+//	CREATE FUNCTION notify_cache() RETURNS trigger AS $$
+//	BEGIN
+//		PERFORM pg_notify('memcachedb', TG_TABLE_NAME);
+//		RETURN NULL;
+//	END;
+//	$$ LANGUAGE plpgsql;
+//
+//	CREATE TRIGGER users_cache AFTER INSERT OR UPDATE OR DELETE ON users
+//		FOR EACH STATEMENT EXECUTE FUNCTION notify_cache();
+package pgnotify
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	memcachedb "memcache-database-module"
+)
+
+type (
+	// Listener invalidates cache entries named in notifications received
+	// on a set of channels.
+	Listener struct {
+		cache  memcachedb.Cache
+		dsn    string
+		logger *slog.Logger
+
+		minReconnect time.Duration
+		maxReconnect time.Duration
+	}
+
+	// Option configures a Listener.
+	Option func(l *Listener)
+
+	// Payload is the JSON form of a notification payload.
+	Payload struct {
+		Tags   []string `json:"tags"`
+		Tables []string `json:"tables"`
+	}
+)
+
+// WithLogger makes the listener log connection events and malformed
+// payloads to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(l *Listener) {
+		l.logger = logger
+	}
+}
+
+// WithReconnectInterval sets the bounds of the back-off between attempts to
+// reconnect to the database.
+func WithReconnectInterval(min, max time.Duration) Option {
+	return func(l *Listener) {
+		l.minReconnect = min
+		l.maxReconnect = max
+	}
+}
+
+// New returns a Listener that connects to the database at dsn and
+// invalidates entries of c.
+func New(c memcachedb.Cache, dsn string, opts ...Option) *Listener {
+	l := &Listener{
+		cache:        c,
+		dsn:          dsn,
+		logger:       slog.Default(),
+		minReconnect: time.Second,
+		maxReconnect: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Run listens on channels until ctx is done. Notifications may be lost
+// while the connection is down, so every entry of the cache is invalidated
+// after a reconnect.
+func (l *Listener) Run(ctx context.Context, channels ...string) error {
+	pl := pq.NewListener(l.dsn, l.minReconnect, l.maxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			l.logger.Warn("pgnotify: listener event", "event", ev, "error", err)
+		}
+	})
+	defer pl.Close()
+
+	for _, ch := range channels {
+		if err := pl.Listen(ch); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-pl.Notify:
+			if n == nil {
+				l.logger.Info("pgnotify: reconnected, invalidating every entry")
+				l.cache.InvalidateWhere(func(string, interface{}) bool { return true })
+				continue
+			}
+			l.Handle(n.Extra)
+		}
+	}
+}
+
+// Handle applies a single notification payload to the cache.
+func (l *Listener) Handle(payload string) {
+	p, err := ParsePayload(payload)
+	if err != nil {
+		l.logger.Warn("pgnotify: malformed payload", "payload", payload, "error", err)
+		return
+	}
+
+	for _, tag := range p.Tags {
+		l.cache.InvalidateTag(tag)
+	}
+	l.cache.InvalidateTables(p.Tables...)
+}
+
+// ParsePayload decodes a notification payload.
+func ParsePayload(payload string) (Payload, error) {
+	var p Payload
+
+	payload = strings.TrimSpace(payload)
+	if strings.HasPrefix(payload, "{") {
+		err := json.Unmarshal([]byte(payload), &p)
+		return p, err
+	}
+
+	for _, table := range strings.Split(payload, ",") {
+		if table = strings.TrimSpace(table); table != "" {
+			p.Tables = append(p.Tables, table)
+		}
+	}
+
+	return p, nil
+}
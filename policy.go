@@ -0,0 +1,40 @@
+package memcachedb
+
+// EvictionPolicy selects which entries a bounded cache evicts first.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used entry.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU evicts the least frequently used entry, which keeps hot keys
+	// through one-off scans on skewed workloads. Frequencies decay over
+	// time, so that keys which have gone cold are evicted in the end.
+	EvictLFU
+	// EvictARC adapts between recency and frequency on its own, which suits
+	// mixed workloads.
+	EvictARC
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLRU:
+		return "lru"
+	case EvictLFU:
+		return "lfu"
+	case EvictARC:
+		return "arc"
+	default:
+		return "unknown"
+	}
+}
+
+func (p EvictionPolicy) new(capacity int) policy {
+	switch p {
+	case EvictLFU:
+		return newLFU()
+	case EvictARC:
+		return newARC(capacity)
+	default:
+		return newLRU()
+	}
+}
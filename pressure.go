@@ -0,0 +1,112 @@
+package memcachedb
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+)
+
+// MemoryPressure configures the controller set by WithMemoryPressure. Zero
+// fields take their defaults.
+type MemoryPressure struct {
+	// Limit is the memory limit of the process in bytes. It defaults to
+	// the limit set by GOMEMLIMIT or debug.SetMemoryLimit.
+	Limit uint64
+	// High is the fraction of Limit above which the cache starts shedding
+	// entries, 0.9 by default.
+	High float64
+	// Low is the fraction of Limit the cache sheds entries down to before
+	// it relaxes, 0.8 by default.
+	Low float64
+	// Step is the fraction of the entries shed at each check, 0.1 by
+	// default.
+	Step float64
+	// Interval is the time between checks, a second by default.
+	Interval time.Duration
+	// Usage reports the memory in use in bytes. It defaults to the memory
+	// the Go runtime counts against its own limit.
+	Usage func() uint64
+}
+
+func (p *MemoryPressure) defaults() {
+	if p.Limit == 0 {
+		if l := debug.SetMemoryLimit(-1); l != math.MaxInt64 {
+			p.Limit = uint64(l)
+		}
+	}
+	if p.High <= 0 || p.High > 1 {
+		p.High = 0.9
+	}
+	if p.Low <= 0 || p.Low > p.High {
+		p.Low = min(0.8, p.High)
+	}
+	if p.Step <= 0 || p.Step >= 1 {
+		p.Step = 0.1
+	}
+	if p.Interval <= 0 {
+		p.Interval = time.Second
+	}
+	if p.Usage == nil {
+		p.Usage = runtimeMemory
+	}
+}
+
+// runtimeMemory returns the memory mapped by the Go runtime and not yet
+// returned to the system, as GOMEMLIMIT counts it.
+func runtimeMemory() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// watchPressure sheds the coldest entries while memory use is above the
+// high watermark of p, until it falls below the low one.
+func (c *cache) watchPressure(p MemoryPressure) {
+	p.defaults()
+	if p.Limit == 0 {
+		c.logger.Warn("memcachedb: no memory limit to watch; set MemoryPressure.Limit or GOMEMLIMIT")
+		return
+	}
+	high := uint64(p.High * float64(p.Limit))
+	low := uint64(p.Low * float64(p.Limit))
+
+	// Registered as a call so that Stop waits for it.
+	c.begin()
+	go func() {
+		defer c.end()
+
+		tt := time.NewTicker(p.Interval)
+		defer tt.Stop()
+		shedding := false
+		for {
+			select {
+			case <-tt.C:
+			case <-c.stop:
+				return
+			}
+
+			used := p.Usage()
+			switch {
+			case used >= high || (shedding && used >= low):
+				if !shedding {
+					c.logger.Info("memcachedb: memory pressure, shedding entries", "used", used, "limit", p.Limit)
+					shedding = true
+				}
+				for _, s := range c.shards {
+					c.evicted(s.shrink(p.Step))
+				}
+			case shedding:
+				c.logger.Info("memcachedb: memory pressure relieved", "used", used, "limit", p.Limit)
+				shedding = false
+				for _, s := range c.shards {
+					s.relax()
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,100 @@
+// Package prommetrics exports memcachedb cache statistics as Prometheus
+// metrics.
+package prommetrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	memcachedb "memcache-database-module"
+)
+
+const namespace = "memcachedb"
+
+// Collector is a prometheus.Collector for one cache. Every metric carries a
+// "cache" label with the name given to NewCollector, so several caches can
+// be registered side by side.
+type Collector struct {
+	cache memcachedb.Cache
+
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	coalesced   *prometheus.Desc
+	loads       *prometheus.Desc
+	loadErrors  *prometheus.Desc
+	evictions   *prometheus.Desc
+	expirations *prometheus.Desc
+	hitRatio    *prometheus.Desc
+	entries     *prometheus.Desc
+	bytes       *prometheus.Desc
+	loadLatency *prometheus.Desc
+	timeSaved   *prometheus.Desc
+}
+
+// NewCollector returns a Collector reading c's statistics on every scrape.
+func NewCollector(name string, c memcachedb.Cache) *Collector {
+	labels := prometheus.Labels{"cache": name}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, labels)
+	}
+
+	return &Collector{
+		cache:       c,
+		hits:        desc("hits_total", "Calls served from the cache."),
+		misses:      desc("misses_total", "Calls that found no cached entry."),
+		coalesced:   desc("coalesced_total", "Missing calls that shared another call's in-flight load."),
+		loads:       desc("loads_total", "Database queries run to fill the cache."),
+		loadErrors:  desc("load_errors_total", "Database queries that returned an error."),
+		evictions:   desc("evictions_total", "Entries evicted to stay within the cache bounds."),
+		expirations: desc("expirations_total", "Entries removed after their TTL."),
+		hitRatio:    desc("hit_ratio", "Fraction of calls served from the cache."),
+		entries:     desc("entries", "Number of cached entries."),
+		bytes:       desc("bytes", "Total cost of the cached entries."),
+		loadLatency: desc("load_duration_seconds", "Duration of database queries run to fill the cache."),
+		timeSaved:   desc("db_time_saved_seconds_total", "Estimated database time avoided by cache hits."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.coalesced
+	ch <- c.loads
+	ch <- c.loadErrors
+	ch <- c.evictions
+	ch <- c.expirations
+	ch <- c.hitRatio
+	ch <- c.entries
+	ch <- c.bytes
+	ch <- c.loadLatency
+	ch <- c.timeSaved
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.cache.Stats()
+
+	counter := func(d *prometheus.Desc, v uint64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v))
+	}
+	counter(c.hits, s.Hits)
+	counter(c.misses, s.Misses)
+	counter(c.coalesced, s.Coalesced)
+	counter(c.loads, s.Loads)
+	counter(c.loadErrors, s.LoadErrors)
+	counter(c.evictions, s.Evictions)
+	counter(c.expirations, s.Expirations)
+
+	ch <- prometheus.MustNewConstMetric(c.hitRatio, prometheus.GaugeValue, s.HitRatio())
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Entries))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(s.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.timeSaved, prometheus.CounterValue, s.TimeSaved.Seconds())
+
+	buckets := make(map[float64]uint64, len(s.LoadLatency.Bounds))
+	var cumulative uint64
+	for i, bound := range s.LoadLatency.Bounds {
+		cumulative += s.LoadLatency.Counts[i]
+		buckets[bound.Seconds()] = cumulative
+	}
+	ch <- prometheus.MustNewConstHistogram(c.loadLatency, s.LoadLatency.Count, s.LoadLatency.Sum.Seconds(), buckets)
+}
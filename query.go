@@ -0,0 +1,155 @@
+package memcachedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// runQuery is the signature of sqlx.DB.GetContext and SelectContext.
+type runQuery func(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+
+func (c *cache) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if c.db == nil {
+		return ErrNoDB
+	}
+
+	return c.scanInto(ctx, "get", dest, query, args, c.dbGet)
+}
+
+func (c *cache) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if c.db == nil {
+		return ErrNoDB
+	}
+
+	return c.scanInto(ctx, "select", dest, query, args, c.dbSelect)
+}
+
+func (c *cache) QueryContext(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	if c.db == nil {
+		return nil, ErrNoDB
+	}
+
+	var rows []map[string]interface{}
+	err := c.scanInto(ctx, "query", &rows, query, args, c.dbMaps)
+	if err != nil && !errors.Is(err, ErrValueTooLarge) {
+		return nil, err
+	}
+
+	return rows, err
+}
+
+func (c *cache) NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}, opts ...CallOption) error {
+	if c.db == nil {
+		return ErrNoDB
+	}
+
+	q, args, err := bindNamed(c.db, query, arg, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.scanInto(ctx, "get", dest, q, args, c.dbGet)
+}
+
+func (c *cache) NamedSelectContext(ctx context.Context, dest interface{}, query string, arg interface{}, opts ...CallOption) error {
+	if c.db == nil {
+		return ErrNoDB
+	}
+
+	q, args, err := bindNamed(c.db, query, arg, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.scanInto(ctx, "select", dest, q, args, c.dbSelect)
+}
+
+// bindNamed turns a query with named parameters into one with the
+// positional bind variables of db, followed by opts.
+func bindNamed(db sqlx.ExtContext, query string, arg interface{}, opts []CallOption) (string, []interface{}, error) {
+	q, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, opt := range opts {
+		args = append(args, opt)
+	}
+
+	return db.Rebind(q), args, nil
+}
+
+// scanMaps appends every row of rows, as a map of column names to values,
+// to the slice dest points to.
+func scanMaps(rows *sqlx.Rows, err error, dest interface{}) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	maps := dest.(*[]map[string]interface{})
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return err
+		}
+		*maps = append(*maps, row)
+	}
+
+	return rows.Err()
+}
+
+// scanInto caches what run scans for query and args, keyed by kind, the
+// type of dest, query and args, and sets dest to it. The entry is tagged
+// with the tables query reads.
+func (c *cache) scanInto(ctx context.Context, kind string, dest interface{}, query string, args []interface{}, run runQuery) error {
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Pointer || d.IsNil() {
+		return fmt.Errorf("memcachedb: %s destination must be a non-nil pointer, not %T", kind, dest)
+	}
+	typ := d.Type().Elem()
+
+	args, o := c.splitArgs(args)
+	for _, table := range readTables(query) {
+		o.tags = append(o.tags, tableTag(table))
+	}
+	h, fp, err := c.hash(append([]interface{}{kind, typ.String(), query}, args...)...)
+	if err != nil {
+		return err
+	}
+	o.fingerprint = fp
+	c.trackPattern(&o, sqlPattern(query))
+
+	v, err := c.load(ctx, h, o, func(ctx context.Context) (interface{}, error) {
+		p := reflect.New(typ)
+		if err := run(ctx, p.Interface(), query, args...); err != nil {
+			return nil, err
+		}
+		return p.Elem().Interface(), nil
+	})
+
+	return assign(d, typ, v, err, query)
+}
+
+// assign sets what dest points to, of type typ, to v, the result of query
+// returned with err. A result too large to cache is set all the same, and
+// ErrValueTooLarge returned.
+func assign(d reflect.Value, typ reflect.Type, v interface{}, err error, query string) error {
+	if err != nil && !errors.Is(err, ErrValueTooLarge) {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		d.Elem().SetZero()
+		return err
+	}
+	if rv.Type() != typ {
+		return fmt.Errorf("%w: result of %q is %T, not %s", ErrTypeMismatch, query, v, typ)
+	}
+	d.Elem().Set(rv)
+
+	return err
+}
@@ -0,0 +1,123 @@
+// Package redistier shares memcachedb entries between processes through
+// Redis:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	c := memcachedb.New(db,
+//		memcachedb.WithL2(redistier.New(rdb, redistier.WithPrefix("users:"))))
+package redistier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	memcachedb "memcache-database-module"
+)
+
+type (
+	// Tier is a memcachedb.Tier backed by Redis.
+	Tier struct {
+		client redis.UniversalClient
+		prefix string
+	}
+
+	// Option configures a Tier.
+	Option func(t *Tier)
+)
+
+// scanBatch is how many keys DeletePrefix asks Redis for, and deletes, at a
+// time.
+const scanBatch = 1000
+
+var _ memcachedb.FlushingTier = (*Tier)(nil)
+
+// WithPrefix prepends prefix to every key, so that caches sharing a Redis
+// database keep their entries apart.
+func WithPrefix(prefix string) Option {
+	return func(t *Tier) {
+		t.prefix = prefix
+	}
+}
+
+// New returns a Tier storing entries through client, which may be a
+// single-node, cluster or sentinel client.
+func New(client redis.UniversalClient, opts ...Option) *Tier {
+	t := &Tier{client: client}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *Tier) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := t.client.Get(ctx, t.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+func (t *Tier) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return t.client.Set(ctx, t.prefix+key, value, ttl).Err()
+}
+
+func (t *Tier) Delete(ctx context.Context, key string) error {
+	return t.client.Del(ctx, t.prefix+key).Err()
+}
+
+// DeletePrefix deletes the keys starting with the prefix of the Tier and
+// prefix, scanning every master of a cluster. Without WithPrefix, an empty
+// prefix deletes every key of the database.
+func (t *Tier) DeletePrefix(ctx context.Context, prefix string) error {
+	match := globEscaper.Replace(t.prefix+prefix) + "*"
+	if cc, ok := t.client.(*redis.ClusterClient); ok {
+		return cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return deleteMatching(ctx, node, match)
+		})
+	}
+
+	return deleteMatching(ctx, t.client, match)
+}
+
+// globEscaper escapes the characters Redis patterns give a meaning to.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// deleteMatching deletes the keys of client matching the pattern match, one
+// by one so that keys of different cluster slots never share a command.
+func deleteMatching(ctx context.Context, client redis.Cmdable, match string) error {
+	iter := client.Scan(ctx, 0, match, scanBatch).Iterator()
+	keys := make([]string, 0, scanBatch)
+	del := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		pipe := client.Pipeline()
+		for _, key := range keys {
+			pipe.Unlink(ctx, key)
+		}
+		keys = keys[:0]
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == scanBatch {
+			if err := del(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	return del()
+}
@@ -0,0 +1,117 @@
+package memcachedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// defaultMaxRefreshes bounds concurrent background refreshes when no limit
+// is configured.
+const defaultMaxRefreshes = 16
+
+// stale reports whether v is past its fresh period and due for a refresh.
+func (c *cache) stale(v *Entry) bool {
+	return v.fresh != 0 && c.now() >= v.fresh
+}
+
+// servesStale reports whether a call whose load failed with err is served
+// the entry cached before, if any: under WithStaleOnError, when the
+// circuit breaker is open, or when the load timed out under
+// WithLoaderTimeout with serveStale set. An empty result is no failure.
+func (c *cache) servesStale(err error) bool {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false
+	case c.staleOnError, errors.Is(err, ErrCircuitOpen):
+		return true
+	}
+
+	return c.staleOnTimeout && errors.Is(err, ErrLoaderTimeout)
+}
+
+// fallback returns the value of prev, an entry that was cached for key
+// before a load of it failed with err, unless it holds an error, an empty
+// result or the result of other arguments.
+func (c *cache) fallback(ctx context.Context, key string, prev *Entry, o callOptions, err error) (interface{}, bool) {
+	if prev.err != nil || prev.negative || !prev.matches(o.fingerprint) {
+		return nil, false
+	}
+	v, lerr := prev.load()
+	if lerr != nil {
+		return nil, false
+	}
+	if prev.packed == nil {
+		v = c.isolate(v)
+	}
+
+	c.stats.fallbacks.Add(1)
+	c.logger.WarnContext(ctx, "memcachedb: serving stale value after failed load", "key", key, "error", err)
+	if c.onStale != nil {
+		c.onStale(key, err)
+	}
+	return v, true
+}
+
+// touch pushes the lifetime of e, hit under key in s, as far as its slide
+// allows. Entries moved by less than a tenth of their slide are left
+// alone, sparing most hits the swap.
+func (c *cache) touch(s segment, key string, e *Entry) {
+	if e.slide == 0 {
+		return
+	}
+	lifetime := c.now() + e.slide
+	if e.deadline != 0 && lifetime > e.deadline {
+		lifetime = e.deadline
+	}
+	shift := lifetime - e.lifetime
+	if shift < e.slide/10 {
+		return
+	}
+
+	moved := *e
+	moved.lifetime = lifetime
+	if moved.fresh != 0 {
+		moved.fresh += shift
+	}
+	if moved.refreshAt != 0 {
+		moved.refreshAt += shift
+	}
+	if !s.swap(key, e, &moved) {
+		return
+	}
+	c.expiries.push(key, lifetime)
+	if c.journal != nil {
+		c.logSet(key, &moved)
+	}
+}
+
+// refresh reloads key in the background unless a load of it is already
+// running or the refresh limit is reached. The load is detached from the
+// cancellation of ctx, which belongs to a caller that has been served.
+func (c *cache) refresh(ctx context.Context, s segment, key string, o callOptions, query func(ctx context.Context) (interface{}, error)) {
+	if c.flight.running(flightKey(key, o)) {
+		return
+	}
+	select {
+	case c.refreshes <- struct{}{}:
+	default:
+		return
+	}
+	if !c.begin() {
+		<-c.refreshes
+		return
+	}
+
+	c.stats.refreshes.Add(1)
+	c.keyTrace.record(key, TraceRefresh, "")
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer c.end()
+		defer func() { <-c.refreshes }()
+
+		_, _, _ = c.flight.do(ctx, flightKey(key, o), func(ctx context.Context) (interface{}, error) {
+			return c.fetch(ctx, s, key, o, query)
+		})
+	}()
+}
@@ -0,0 +1,77 @@
+package memcachedb
+
+import (
+	"fmt"
+	"time"
+)
+
+// settings are the tunables UpdateConfig can change while the cache runs.
+// Once the cache is created they are only read through cache.cur.
+type settings struct {
+	ttl          time.Duration
+	jitter       float64
+	negativeTTL  time.Duration
+	slowLoad     time.Duration
+	maxEntries   int
+	maxBytes     int64
+	eviction     EvictionPolicy
+	tinyLFU      bool
+	resultRows   int
+	resultBytes  int64
+	maxValueSize int64
+}
+
+// cur returns the settings in effect.
+func (c *cache) cur() *settings {
+	return c.live.Load()
+}
+
+func (c *cache) UpdateConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	n := len(c.routing)
+	if c.backend == nil && ((cfg.MaxEntries > 0 && cfg.MaxEntries < n) || (cfg.MaxBytes > 0 && cfg.MaxBytes < int64(n))) {
+		return fmt.Errorf("memcachedb: bounds of %d entries and %d bytes are below the %d shards of the cache", cfg.MaxEntries, cfg.MaxBytes, n)
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	prev, every := c.cur(), c.cleanupEvery()
+	next := &settings{
+		ttl:          cfg.TTL,
+		jitter:       cfg.Jitter,
+		negativeTTL:  cfg.NegativeTTL,
+		slowLoad:     cfg.SlowLoadThreshold,
+		maxEntries:   cfg.MaxEntries,
+		maxBytes:     cfg.MaxBytes,
+		eviction:     evictionPolicies[cfg.Eviction],
+		tinyLFU:      cfg.TinyLFU,
+		resultRows:   cfg.ResultRows,
+		resultBytes:  cfg.ResultBytes,
+		maxValueSize: cfg.MaxValueSize,
+	}
+	if next.ttl <= 0 {
+		next.ttl = defaultTTL
+	}
+	c.live.Store(next)
+	if c.rearm != nil && c.cleanupEvery() != every {
+		close(c.rearm)
+		c.rearm = nil
+	}
+
+	if c.backend != nil || (next.maxEntries == prev.maxEntries && next.maxBytes == prev.maxBytes &&
+		next.eviction == prev.eviction && next.tinyLFU == prev.tinyLFU) {
+		return nil
+	}
+	for i, s := range c.routing {
+		c.evicted(s.(*shard).resize(
+			int(share(int64(next.maxEntries), n, i)),
+			share(next.maxBytes, n, i),
+			next.eviction,
+			next.tinyLFU))
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package memcachedb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// tickerClock is a testClock telling the intervals of the tickers made
+// from it.
+type tickerClock struct {
+	testClock
+	intervals chan time.Duration
+}
+
+func (c *tickerClock) NewTicker(d time.Duration) Ticker {
+	c.intervals <- d
+	return testTicker{}
+}
+
+func TestUpdateConfigRearmsJanitor(t *testing.T) {
+	clk := &tickerClock{intervals: make(chan time.Duration, 4)}
+	c := New(nil, WithClock(clk), WithDefaultTTL(time.Hour))
+	defer c.Stop(context.Background())
+
+	if d := <-clk.intervals; d != time.Hour {
+		t.Fatalf("janitor sweeps every %v, want the TTL of 1h", d)
+	}
+	if err := c.UpdateConfig(Config{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-clk.intervals:
+		if d != time.Minute {
+			t.Errorf("janitor sweeps every %v after UpdateConfig, want the new TTL of 1m", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("janitor kept its ticker after the TTL changed")
+	}
+
+	if err := c.UpdateConfig(Config{TTL: time.Minute, MaxEntries: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-clk.intervals:
+		t.Errorf("janitor rearmed for %v with the TTL unchanged", d)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
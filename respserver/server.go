@@ -0,0 +1,414 @@
+// Package respserver serves a memcachedb cache over RESP, the Redis
+// protocol, so that redis-cli and Redis client libraries can inspect it and
+// use it for simple integrations. It supports GET, SET (with EX or PX),
+// DEL, EXISTS, TTL, PTTL, SCAN (with MATCH and COUNT), PING, ECHO and
+// QUIT.
+//
+// The server acts on the entries it sets or loads itself, under the names
+// clients give them. With a Loader, a GET that finds nothing cached reads
+// through to the database.
+package respserver
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/internal/netserve"
+)
+
+const (
+	defaultMaxValue = 512 << 20
+	defaultScan     = 10
+)
+
+type (
+	// Loader returns the value for a key that is not cached, or
+	// sql.ErrNoRows when there is none.
+	Loader func(ctx context.Context, key string) ([]byte, error)
+
+	// Server speaks RESP.
+	Server struct {
+		cache    memcachedb.Cache
+		loader   Loader
+		logger   *slog.Logger
+		maxValue int
+		ttl      time.Duration
+
+		conns netserve.Conns
+
+		// names holds the names of the entries set or loaded through
+		// the server, for SCAN. Names whose entry is gone are pruned as
+		// they are met.
+		nmu   sync.Mutex
+		names map[string]struct{}
+	}
+
+	// Option configures a Server.
+	Option func(s *Server)
+
+	// item is what the server caches.
+	item struct {
+		Value []byte
+	}
+)
+
+// WithLoader makes GETs that find nothing cached call l and cache what it
+// returns.
+func WithLoader(l Loader) Option {
+	return func(s *Server) {
+		s.loader = l
+	}
+}
+
+// WithLogger logs connection and loader errors to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithTTL caches the values the server loads, and those set without an
+// expiration, for d instead of the TTL of the cache.
+func WithTTL(d time.Duration) Option {
+	return func(s *Server) {
+		s.ttl = d
+	}
+}
+
+// WithMaxValueSize rejects values longer than n bytes. It defaults to
+// 512 MiB, like Redis.
+func WithMaxValueSize(n int) Option {
+	return func(s *Server) {
+		s.maxValue = n
+	}
+}
+
+// New returns a Server for c.
+func New(c memcachedb.Cache, opts ...Option) *Server {
+	s := &Server{
+		cache:    c,
+		logger:   slog.Default(),
+		maxValue: defaultMaxValue,
+		names:    make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ListenAndServe serves on the TCP address addr.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close is called, and then returns
+// net.ErrClosed.
+func (s *Server) Serve(l net.Listener) error {
+	return s.conns.Serve(l, s.serve)
+}
+
+// Close stops the server, closing its listener and connections, and waits
+// for the commands being served to finish.
+func (s *Server) Close() error {
+	return s.conns.Close()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := bufio.NewReader(conn)
+	w := &writer{bufio.NewWriter(conn)}
+	for {
+		args, err := readCommand(r, s.maxValue)
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				w.error("ERR Protocol error: " + string(perr))
+				w.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debug("respserver: read", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		open := s.command(ctx, args, w)
+		// Replies to pipelined commands go out together.
+		if r.Buffered() == 0 || !open {
+			if err := w.Flush(); err != nil || !open {
+				return
+			}
+		}
+	}
+}
+
+// command runs args and writes the reply to w. It returns false when the
+// connection must close.
+func (s *Server) command(ctx context.Context, args []string, w *writer) bool {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	arity := map[string][2]int{
+		"PING": {0, 1}, "ECHO": {1, 1}, "QUIT": {0, 0},
+		"GET": {1, 1}, "SET": {2, 4}, "DEL": {1, -1}, "EXISTS": {1, -1},
+		"TTL": {1, 1}, "PTTL": {1, 1}, "SCAN": {1, 5},
+	}
+	bounds, ok := arity[name]
+	if !ok {
+		w.error("ERR unknown command '" + strings.ToLower(name) + "'")
+		return true
+	}
+	if len(args) < bounds[0] || (bounds[1] >= 0 && len(args) > bounds[1]) {
+		w.error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return true
+	}
+
+	switch name {
+	case "PING":
+		if len(args) == 1 {
+			w.bulk([]byte(args[0]))
+		} else {
+			w.simple("PONG")
+		}
+	case "ECHO":
+		w.bulk([]byte(args[0]))
+	case "QUIT":
+		w.simple("OK")
+		return false
+	case "GET":
+		s.get(ctx, args[0], w)
+	case "SET":
+		s.set(args, w)
+	case "DEL":
+		n := 0
+		for _, key := range args {
+			if s.del(key) {
+				n++
+			}
+		}
+		w.integer(int64(n))
+	case "EXISTS":
+		n := 0
+		for _, key := range args {
+			if _, ok := s.peek(key); ok {
+				n++
+			}
+		}
+		w.integer(int64(n))
+	case "TTL", "PTTL":
+		ttl, ok := s.ttlOf(args[0])
+		switch {
+		case !ok:
+			w.integer(-2)
+		case name == "TTL":
+			w.integer(int64((ttl + time.Second - 1) / time.Second))
+		default:
+			w.integer(ttl.Milliseconds())
+		}
+	case "SCAN":
+		s.scan(args, w)
+	}
+
+	return true
+}
+
+func (s *Server) get(ctx context.Context, key string, w *writer) {
+	if it, ok := s.peek(key); ok || s.loader == nil {
+		if ok {
+			w.bulk(it.Value)
+		} else {
+			w.null()
+		}
+		return
+	}
+
+	args := []interface{}{key}
+	if s.ttl > 0 {
+		args = append(args, memcachedb.WithTTL(s.ttl))
+	}
+	v, err := s.cache.DoContext(ctx, func(ctx context.Context, _ ...interface{}) (interface{}, error) {
+		value, err := s.loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		s.remember(key)
+		return item{Value: value}, nil
+	}, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.null()
+		return
+	}
+	if err != nil {
+		s.logger.Warn("respserver: load", "key", key, "error", err)
+		w.error("ERR " + err.Error())
+		return
+	}
+	it, _ := v.(item)
+	w.bulk(it.Value)
+}
+
+// set handles "SET key value [EX seconds | PX milliseconds]".
+func (s *Server) set(args []string, w *writer) {
+	key, value := args[0], args[1]
+
+	ttl := s.ttl
+	switch len(args) {
+	case 2:
+	case 4:
+		n, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || n <= 0 {
+			w.error("ERR invalid expire time in 'set' command")
+			return
+		}
+		switch strings.ToUpper(args[2]) {
+		case "EX":
+			ttl = time.Duration(n) * time.Second
+		case "PX":
+			ttl = time.Duration(n) * time.Millisecond
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	default:
+		w.error("ERR syntax error")
+		return
+	}
+
+	ck, err := s.cache.Key(key)
+	if err == nil {
+		s.remember(key)
+		err = s.cache.Set(ck, item{Value: []byte(value)}, ttl)
+	}
+	if err != nil {
+		w.error("ERR " + err.Error())
+		return
+	}
+	w.simple("OK")
+}
+
+// scan handles "SCAN cursor [MATCH pattern] [COUNT count]". The cursor is
+// an offset in the sorted names, so entries added during a scan may be
+// missed or returned twice, as Redis allows.
+func (s *Server) scan(args []string, w *writer) {
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		w.error("ERR invalid cursor")
+		return
+	}
+	pattern, count := "*", defaultScan
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				w.error("ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	s.nmu.Lock()
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	s.nmu.Unlock()
+	slices.Sort(names)
+
+	var keys []string
+	next := min(cursor+count, len(names))
+	for _, name := range names[min(cursor, len(names)):next] {
+		if _, ok := s.peek(name); !ok {
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			keys = append(keys, name)
+		}
+	}
+	if next == len(names) {
+		next = 0
+	}
+
+	w.array(2)
+	w.bulk([]byte(strconv.Itoa(next)))
+	w.array(len(keys))
+	for _, key := range keys {
+		w.bulk([]byte(key))
+	}
+}
+
+// peek returns the item cached under name, forgetting the name when its
+// entry is gone.
+func (s *Server) peek(name string) (item, bool) {
+	v, ok := s.cache.Peek(name)
+	it, isItem := v.(item)
+	if !ok || !isItem {
+		s.forget(name)
+		return item{}, false
+	}
+
+	return it, true
+}
+
+func (s *Server) del(name string) bool {
+	s.forget(name)
+	ck, err := s.cache.Key(name)
+
+	return err == nil && s.cache.InvalidateKey(ck)
+}
+
+func (s *Server) remember(name string) {
+	s.nmu.Lock()
+	defer s.nmu.Unlock()
+
+	s.names[name] = struct{}{}
+}
+
+func (s *Server) forget(name string) {
+	s.nmu.Lock()
+	defer s.nmu.Unlock()
+
+	delete(s.names, name)
+}
+
+// ttlOf returns how long the entry of name has left, as the cache tells.
+func (s *Server) ttlOf(name string) (time.Duration, bool) {
+	if _, ok := s.peek(name); !ok {
+		return 0, false
+	}
+	ck, err := s.cache.Key(name)
+	if err != nil {
+		return 0, false
+	}
+
+	return s.cache.TTL(ck)
+}
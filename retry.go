@@ -0,0 +1,74 @@
+package memcachedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy decides how failed queries are retried before their error
+// counts as the result of the load, so that a transient failure, such as
+// a database failing over, neither reaches the callers nor gets cached by
+// WithNegativeCaching or WithErrorPolicy. The zero value retries nothing.
+type RetryPolicy struct {
+	// Attempts is how many times a query runs at most, the first run
+	// included. Queries are not retried when it is below 2.
+	Attempts int
+	// Backoff is the wait before the first retry, doubled before each
+	// later one and randomized down to half of that.
+	Backoff time.Duration
+	// MaxBackoff, if positive, caps the waits.
+	MaxBackoff time.Duration
+	// Retryable selects the errors to retry. When it is nil every error
+	// is retried but sql.ErrNoRows and panics.
+	Retryable func(err error) bool
+}
+
+// retries reports whether a query that failed with err on its attempt-th
+// run is run again.
+func (p RetryPolicy) retries(err error, attempt int) bool {
+	if attempt >= p.Attempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, ErrLoaderPanic)
+}
+
+// backoff returns the wait before the retry following the attempt-th run.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return d/2 + time.Duration(rand.Int64N(int64(d/2)+1))
+}
+
+// attempt runs query with call, retrying it as the RetryPolicy allows
+// until ctx is done.
+func (c *cache) attempt(ctx context.Context, key string, query func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	v, err := c.call(ctx, query)
+	for n := 1; err != nil && ctx.Err() == nil && c.retry.retries(err, n); n++ {
+		c.logger.DebugContext(ctx, "memcachedb: retrying load", "key", key, "attempt", n+1, "error", err)
+		t := time.NewTimer(c.retry.backoff(n))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return v, err
+		case <-t.C:
+		}
+
+		c.stats.retries.Add(1)
+		v, err = c.call(ctx, query)
+	}
+
+	return v, err
+}
@@ -0,0 +1,178 @@
+// Package ristrettostore keeps memcachedb entries in a Ristretto cache, for
+// its cost-based admission and eviction and its throughput under heavy
+// concurrency:
+//
+//	st, err := ristrettostore.New(ristrettostore.Config{MaxCost: 1 << 30})
+//	if err != nil {
+//		return err
+//	}
+//	defer st.Close()
+//	c := memcachedb.New(db, memcachedb.WithStore(st))
+//
+// Ristretto applies writes asynchronously and may drop them under
+// contention, so a value stored can take a moment to be visible and is
+// occasionally never stored at all; both show as a cache miss.
+package ristrettostore
+
+import (
+	"sync"
+
+	"github.com/dgraph-io/ristretto/v2"
+
+	memcachedb "memcache-database-module"
+)
+
+type (
+	// Config configures a Store.
+	Config struct {
+		// MaxCost bounds the total cost of the entries.
+		MaxCost int64
+		// NumCounters is the number of keys whose access frequency is
+		// tracked for admission. It defaults to ten times the number of
+		// entries expected to fit, assuming each costs one.
+		NumCounters int64
+		// Cost returns the cost of caching value under key. It defaults
+		// to one per entry, making MaxCost an entry count.
+		Cost func(key string, value interface{}) int64
+	}
+
+	// Store is a memcachedb.Store backed by Ristretto.
+	Store struct {
+		cache *ristretto.Cache[string, *slot]
+		cost  func(key string, value interface{}) int64
+
+		// keys indexes the entries for Scan and Len, which Ristretto
+		// does not offer.
+		mu      sync.Mutex
+		keys    map[string]*memcachedb.Entry
+		onEvict func(key string, e *memcachedb.Entry)
+	}
+
+	// slot is what Ristretto stores: its callbacks only get the hash of
+	// a key, so the key travels with the entry.
+	slot struct {
+		key   string
+		entry *memcachedb.Entry
+	}
+)
+
+var _ memcachedb.EvictingStore = (*Store)(nil)
+
+// New returns a Store configured by cfg. Close it once the cache using it
+// is stopped.
+func New(cfg Config) (*Store, error) {
+	s := &Store{
+		cost: cfg.Cost,
+		keys: make(map[string]*memcachedb.Entry),
+	}
+	if s.cost == nil {
+		s.cost = func(string, interface{}) int64 { return 1 }
+	}
+	if cfg.NumCounters <= 0 {
+		cfg.NumCounters = 10 * max(cfg.MaxCost, 1)
+	}
+
+	c, err := ristretto.NewCache(&ristretto.Config[string, *slot]{
+		NumCounters:        cfg.NumCounters,
+		MaxCost:            cfg.MaxCost,
+		BufferItems:        64,
+		IgnoreInternalCost: true,
+		OnEvict:            func(item *ristretto.Item[*slot]) { s.dropped(item.Value, true) },
+		OnReject:           func(item *ristretto.Item[*slot]) { s.dropped(item.Value, false) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cache = c
+
+	return s, nil
+}
+
+// dropped forgets the entry of sl once Ristretto let go of it, reporting
+// it as evicted when it was cached before.
+func (s *Store) dropped(sl *slot, evicted bool) {
+	if sl == nil {
+		return
+	}
+
+	s.mu.Lock()
+	current := s.keys[sl.key] == sl.entry
+	if current {
+		delete(s.keys, sl.key)
+	}
+	onEvict := s.onEvict
+	s.mu.Unlock()
+
+	if current && evicted && onEvict != nil {
+		onEvict(sl.key, sl.entry)
+	}
+}
+
+func (s *Store) OnEvict(fn func(key string, e *memcachedb.Entry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onEvict = fn
+}
+
+func (s *Store) Get(key string) (*memcachedb.Entry, bool) {
+	sl, ok := s.cache.Get(key)
+	if !ok || sl.key != key {
+		return nil, false
+	}
+
+	return sl.entry, true
+}
+
+func (s *Store) Set(key string, e *memcachedb.Entry) (*memcachedb.Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.keys[key]
+	if !s.cache.Set(key, &slot{key: key, entry: e}, s.cost(key, e.Value())) {
+		return old, false
+	}
+	s.keys[key] = e
+
+	return old, true
+}
+
+func (s *Store) Delete(key string) (*memcachedb.Entry, bool) {
+	s.mu.Lock()
+	e, ok := s.keys[key]
+	delete(s.keys, key)
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+	// Del may wait for Ristretto to apply pending writes, which report
+	// evictions under s.mu.
+	s.cache.Del(key)
+
+	return e, true
+}
+
+func (s *Store) Scan(fn func(key string, e *memcachedb.Entry) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, e := range s.keys {
+		if !fn(k, e) {
+			return
+		}
+	}
+}
+
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.keys)
+}
+
+// Close stops the goroutines of Ristretto. The store must not be used
+// afterwards.
+func (s *Store) Close() {
+	s.cache.Close()
+}
@@ -0,0 +1,226 @@
+package memcachedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// rowKey returns the key the row of table whose primary key is pk is cached
+// under. Keys are built from the text of pk, so that the int64 a row scans
+// into and the int a caller passes give the same key.
+func rowKey(table string, pk interface{}) string {
+	return "row:" + strings.ToLower(table) + ":" + fmt.Sprint(pk)
+}
+
+// WithRows declares rows of table, by primary key, that the statement run
+// by ExecContext writes, so that their entries cached by GetRowContext and
+// SelectRowsContext are removed once it succeeds. The other cached rows of
+// table stay, although the statement writes to it.
+func WithRows(table string, pks ...interface{}) CallOption {
+	return func(o *callOptions) {
+		for _, pk := range pks {
+			o.rows = append(o.rows, rowKey(table, pk))
+		}
+		o.rowTables = append(o.rowTables, table)
+	}
+}
+
+func (c *cache) GetRowContext(ctx context.Context, dest interface{}, table, column string, pk interface{}, opts ...CallOption) error {
+	if c.db == nil {
+		return ErrNoDB
+	}
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Pointer || d.IsNil() {
+		return fmt.Errorf("memcachedb: row destination must be a non-nil pointer, not %T", dest)
+	}
+	typ := d.Type().Elem()
+
+	o := callOptions{ttl: c.cur().ttl, tags: []string{rowsTag(table)}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c.trackPattern(&o, rowsPattern(table))
+	query := c.db.Rebind("SELECT * FROM " + table + " WHERE " + column + " = ?")
+	v, err := c.load(ctx, rowKey(table, pk), o, c.rowLoader(typ, query, pk))
+
+	return assign(d, typ, v, err, query)
+}
+
+func (c *cache) SelectRowsContext(ctx context.Context, dest interface{}, table, column string, pks []interface{}, opts ...CallOption) error {
+	if c.db == nil {
+		return ErrNoDB
+	}
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Pointer || d.IsNil() || d.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("memcachedb: rows destination must be a non-nil pointer to a slice, not %T", dest)
+	}
+	typ := d.Type().Elem().Elem()
+	if base := reflectx.Deref(typ); base.Kind() != reflect.Struct {
+		return fmt.Errorf("memcachedb: rows must be structs, not %s", typ)
+	}
+
+	if !c.begin() {
+		return ErrStopped
+	}
+	defer c.end()
+
+	o := callOptions{ttl: c.cur().ttl, tags: []string{rowsTag(table)}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c.trackPattern(&o, rowsPattern(table))
+	query := c.db.Rebind("SELECT * FROM " + table + " WHERE " + column + " = ?")
+
+	rows := make([]reflect.Value, len(pks))
+	var missing []interface{}
+	for i, pk := range pks {
+		key := rowKey(table, pk)
+		v, err, ok := c.hit(ctx, c.shard(key), key, o, c.rowLoader(typ, query, pk))
+		switch {
+		case !ok:
+			c.stats.misses.Add(1)
+			if o.pat != nil {
+				o.pat.misses.Add(1)
+			}
+			c.keyTrace.record(key, TraceMiss, "")
+			missing = append(missing, pk)
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			rv := reflect.ValueOf(v)
+			if !rv.IsValid() || rv.Type() != typ {
+				return fmt.Errorf("%w: row %s is %T, not %s", ErrTypeMismatch, key, v, typ)
+			}
+			rows[i] = rv
+		}
+	}
+
+	if len(missing) > 0 {
+		loaded, err := c.loadRows(ctx, typ, table, column, missing, o)
+		if err != nil {
+			return err
+		}
+		for i, pk := range pks {
+			if !rows[i].IsValid() {
+				rows[i] = loaded[rowKey(table, pk)]
+			}
+		}
+	}
+
+	out := reflect.MakeSlice(d.Type().Elem(), 0, len(rows))
+	for _, row := range rows {
+		if row.IsValid() {
+			out = reflect.Append(out, row)
+		}
+	}
+	d.Elem().Set(out)
+
+	return nil
+}
+
+func (c *cache) InvalidateRows(table string, pks ...interface{}) int {
+	n := 0
+	for _, pk := range pks {
+		if c.InvalidateKey(rowKey(table, pk)) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// rowLoader returns the query loading the row whose primary key is pk, as
+// a value of type typ.
+func (c *cache) rowLoader(typ reflect.Type, query string, pk interface{}) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		p := reflect.New(typ)
+		if err := c.dbGet(ctx, p.Interface(), query, pk); err != nil {
+			return nil, err
+		}
+		return p.Elem().Interface(), nil
+	}
+}
+
+// loadRows loads the rows of table whose column is among pks with a single
+// query, caches each of them and returns them by key. They are not
+// coalesced with concurrent loads of the same rows.
+func (c *cache) loadRows(ctx context.Context, typ reflect.Type, table, column string, pks []interface{}, o callOptions) (map[string]reflect.Value, error) {
+	ctx, span := c.tracer.Start(ctx, "memcachedb.load")
+	defer span.End()
+
+	query, args, err := sqlx.In("SELECT * FROM "+table+" WHERE "+column+" IN (?)", pks)
+	if err != nil {
+		return nil, err
+	}
+	query = c.db.Rebind(query)
+
+	if !c.breaker.allow() {
+		c.stats.refused.Add(1)
+		return nil, fmt.Errorf("memcachedb: load rows of %s: %w", table, ErrCircuitOpen)
+	}
+	c.stats.loads.Add(1)
+	start := time.Now()
+	res, err := c.attempt(ctx, rowKey(table, "*"), func(ctx context.Context) (interface{}, error) {
+		// Fresh for every attempt: a failed one may leave rows behind.
+		p := reflect.New(reflect.SliceOf(typ))
+		return p, c.dbSelect(ctx, p.Interface(), query, args...)
+	})
+	elapsed := time.Since(start)
+	c.stats.loadLatency.observe(elapsed)
+	if o.pat != nil {
+		o.pat.loads.Add(1)
+		o.pat.loadTime.Add(int64(elapsed))
+	}
+	if ctx.Err() != nil {
+		c.breaker.release()
+	} else {
+		c.breaker.record(err != nil)
+	}
+	if err != nil {
+		c.stats.loadErrors.Add(1)
+		if o.pat != nil {
+			o.pat.loadErrors.Add(1)
+		}
+		recordError(span, err)
+		c.logger.ErrorContext(ctx, "memcachedb: load failed", "table", table, "error", err)
+		return nil, fmt.Errorf("memcachedb: load rows of %s: %w", table, err)
+	}
+	p := res.(reflect.Value)
+	// The rows count against WithResultLimit together, as the result of
+	// one query, and each on its own, as the entry it is cached as.
+	whole := !c.oversized(rowKey(table, "*"), p.Interface())
+
+	loaded := make(map[string]reflect.Value, p.Elem().Len())
+	for i := 0; i < p.Elem().Len(); i++ {
+		row := p.Elem().Index(i)
+		v := reflect.Indirect(row)
+		if !v.IsValid() {
+			continue
+		}
+		pk := c.db.Mapper.FieldByName(v, column)
+		if !pk.IsValid() {
+			return nil, fmt.Errorf("memcachedb: %s has no field for column %q", typ, column)
+		}
+		key := rowKey(table, pk.Interface())
+		value := c.isolate(row.Interface())
+		switch {
+		case !whole || c.oversized(key, value):
+			c.stats.oversized.Add(1)
+			c.discard(c.shard(key), key)
+		case errors.Is(c.put(ctx, key, c.newEntity(key, value, o)), ErrValueTooLarge):
+			c.discard(c.shard(key), key)
+		}
+		loaded[key] = row
+	}
+
+	return loaded, nil
+}
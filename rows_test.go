@@ -0,0 +1,170 @@
+package memcachedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// rowsDriver is a database/sql driver whose every query returns a
+	// users row, with columns id and name, for each of its arguments,
+	// and whose statements affect one row.
+	rowsDriver struct{ queries atomic.Int32 }
+	rowsConn   struct{ d *rowsDriver }
+	userRows   struct {
+		ids []driver.NamedValue
+		i   int
+	}
+	user struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+)
+
+func (d *rowsDriver) Open(string) (driver.Conn, error) { return rowsConn{d}, nil }
+
+func (c rowsConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c rowsConn) Close() error                        { return nil }
+func (c rowsConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c rowsConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.queries.Add(1)
+	return &userRows{ids: args}, nil
+}
+
+func (c rowsConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (r *userRows) Columns() []string { return []string{"id", "name"} }
+func (r *userRows) Close() error      { return nil }
+
+func (r *userRows) Next(dest []driver.Value) error {
+	if r.i == len(r.ids) {
+		return io.EOF
+	}
+	id := r.ids[r.i].Value
+	r.i++
+	dest[0], dest[1] = id, fmt.Sprint("user", id)
+	return nil
+}
+
+var testRows = new(rowsDriver)
+
+func TestRowsInvalidatedByTable(t *testing.T) {
+	db := sqlx.NewDb(sql.OpenDB(connector{testRows}), "memcachedb-rows")
+	c := New(db, WithoutJanitor())
+	defer c.Stop(context.Background())
+	ctx := context.Background()
+
+	var u user
+	if err := c.GetRowContext(ctx, &u, "users", "id", 1); err != nil {
+		t.Fatal(err)
+	}
+	var us []user
+	if err := c.SelectRowsContext(ctx, &us, "users", "id", []interface{}{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "user1" || len(us) != 2 {
+		t.Fatalf("rows = %+v, %+v", u, us)
+	}
+
+	if n := c.InvalidateTables("Users"); n != 3 {
+		t.Errorf("InvalidateTables = %d, want the 3 cached rows", n)
+	}
+	before := testRows.queries.Load()
+	if err := c.GetRowContext(ctx, &u, "users", "id", 1); err != nil {
+		t.Fatal(err)
+	}
+	if testRows.queries.Load() == before {
+		t.Error("row served from the cache after InvalidateTables")
+	}
+	if n := c.InvalidateRows("users", 1); n != 1 {
+		t.Errorf("InvalidateRows = %d, want 1", n)
+	}
+}
+
+func TestExecWithRows(t *testing.T) {
+	db := sqlx.NewDb(sql.OpenDB(connector{testRows}), "memcachedb-rows")
+	c := New(db, WithoutJanitor())
+	defer c.Stop(context.Background())
+	ctx := context.Background()
+
+	var us []user
+	if err := c.SelectRowsContext(ctx, &us, "users", "id", []interface{}{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", "x", 1, WithRows("Users", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := func(pk int) bool {
+		before := testRows.queries.Load()
+		var u user
+		if err := c.GetRowContext(ctx, &u, "users", "id", pk); err != nil {
+			t.Fatal(err)
+		}
+		return testRows.queries.Load() == before
+	}
+	if cached(1) {
+		t.Error("row 1 served from the cache after a write naming it")
+	}
+	if !cached(2) {
+		t.Error("row 2 removed by a write naming row 1 only")
+	}
+
+	if _, err := c.ExecContext(ctx, "UPDATE users SET name = ?", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if cached(2) {
+		t.Error("row 2 served from the cache after a write to its table without WithRows")
+	}
+}
+
+func TestSelectRowsResultLimit(t *testing.T) {
+	costly := func(key string, _ interface{}) int64 {
+		if key == rowKey("users", 2) {
+			return 100
+		}
+		return 1
+	}
+	for _, tt := range []struct {
+		name     string
+		opts     []Option
+		uncached int
+	}{
+		{"rows", []Option{WithResultLimit(2, 0)}, 3},
+		{"bytes", []Option{WithResultLimit(0, 8)}, 3},
+		{"row bytes", []Option{WithResultLimit(0, 10), WithCost(costly)}, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqlx.NewDb(sql.OpenDB(connector{testRows}), "memcachedb-rows")
+			c := New(db, append([]Option{WithoutJanitor()}, tt.opts...)...)
+			defer c.Stop(context.Background())
+
+			var us []user
+			if err := c.SelectRowsContext(context.Background(), &us, "users", "id", []interface{}{1, 2, 3}); err != nil {
+				t.Fatal(err)
+			}
+			if len(us) != 3 {
+				t.Fatalf("rows = %+v, want 3", us)
+			}
+			if s := c.Stats(); s.Entries != 3-tt.uncached || s.Oversized != uint64(tt.uncached) {
+				t.Errorf("%d entries and %d oversized results, want %d rows left uncached", s.Entries, s.Oversized, tt.uncached)
+			}
+		})
+	}
+}
+
+// connector opens connections of a driver without a DSN.
+type connector struct{ d driver.Driver }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
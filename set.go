@@ -0,0 +1,48 @@
+package memcachedb
+
+import (
+	"context"
+	"time"
+)
+
+func (c *cache) Key(args ...interface{}) (string, error) {
+	args, _ = c.splitArgs(args)
+	key, _, err := c.hash(args...)
+
+	return key, err
+}
+
+func (c *cache) Set(key string, value interface{}, ttl time.Duration, opts ...CallOption) error {
+	if !c.begin() {
+		return ErrStopped
+	}
+	defer c.end()
+
+	o := callOptions{ttl: c.cur().ttl}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if ttl > 0 {
+		o.ttl = ttl
+	}
+	return c.put(context.Background(), key, c.newEntity(key, c.isolate(value), o))
+}
+
+// put caches e under key, on the peer owning key if it is another one, and
+// in the L2 tier.
+func (c *cache) put(ctx context.Context, key string, e *Entry) error {
+	if c.tooLarge(key, e) {
+		c.stats.rejected.Add(1)
+		return ErrValueTooLarge
+	}
+	if owner, remote := c.owner(key); remote {
+		c.tierSet(ctx, owner, key, e)
+	} else {
+		c.store(c.shard(key), key, e)
+	}
+	if c.l2 != nil {
+		c.tierSet(ctx, c.l2, key, e)
+	}
+
+	return nil
+}
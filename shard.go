@@ -0,0 +1,357 @@
+package memcachedb
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultShards = 32
+
+type (
+	shard struct {
+		// data is read without locks, so that hits never wait. mu
+		// serializes the writers, keeping count and the policy in step
+		// with data.
+		mu    sync.Mutex
+		data  sync.Map
+		count int
+
+		// policy is nil when the shard is unbounded, and tracked is set
+		// when it is not. It has its own lock, which hits only try to
+		// take: an access is not recorded when another goroutine holds
+		// it. kind is the policy of policy; pressured keeps a policy even
+		// without bounds, for WithMemoryPressure.
+		pmu       sync.Mutex
+		tracked   atomic.Bool
+		policy    policy
+		kind      EvictionPolicy
+		pressured bool
+		admitter  *tinyLFU
+		capacity  int
+		maxBytes  int64
+		bytes     int64
+		// ceiling, if set, bounds the entries while the process is under
+		// memory pressure.
+		ceiling int
+
+		stats *counters
+	}
+
+	// segment is a part of the cache storage: one of the built-in shards,
+	// or the whole of a Store set by WithStore.
+	segment interface {
+		// lookup returns the entry for key without counting it as an
+		// access.
+		lookup(key string) (*Entry, bool)
+		get(key string) (*Entry, bool)
+		set(key string, v *Entry) (stored bool, old *Entry, evicted []eviction)
+		delete(key string) (*Entry, bool)
+		deleteIf(key string, cond func(v *Entry) bool) (*Entry, bool)
+		// swap replaces old, the entry for key, with v, of the same size,
+		// unless key holds another entry by now.
+		swap(key string, old, v *Entry) bool
+		// scan calls fn for a copy of the entries until fn returns false.
+		// fn runs without locks held and may use the segment.
+		scan(fn func(key string, v *Entry) bool)
+		// usage returns the number and total cost of the entries.
+		usage() (entries int, bytes int64)
+		// shrink evicts the coldest fraction of the entries and holds the
+		// segment to the size that leaves until relax.
+		shrink(fraction float64) []eviction
+		relax()
+	}
+
+	// eviction is an entry a shard dropped to stay within its bounds.
+	eviction struct {
+		key   string
+		value *Entry
+	}
+
+	// policy picks the entries a bounded shard evicts. Implementations need
+	// not be safe for concurrent use and must ignore keys they do not know.
+	policy interface {
+		add(key string)
+		touch(key string)
+		remove(key string)
+		// victim removes and returns the next key to evict.
+		victim() (string, bool)
+		// peek returns the key victim would return without removing it.
+		peek() (string, bool)
+	}
+)
+
+// newShards returns the shards of a storage bounded to maxEntries and
+// maxBytes, zero for no bound, evicting according to eviction. There are no
+// more shards than either bound, so that each gets a share of it.
+func (c *cache) newShards(maxEntries int, maxBytes int64, eviction EvictionPolicy) []segment {
+	n := c.shardCount
+	if n <= 0 {
+		n = defaultShards
+	}
+	if maxEntries > 0 {
+		n = min(n, maxEntries)
+	}
+	if maxBytes > 0 {
+		n = int(min(int64(n), maxBytes))
+	}
+
+	shards := make([]segment, n)
+	for i := range shards {
+		s := &shard{stats: &c.stats, pressured: c.pressure != nil}
+		s.resize(int(share(int64(maxEntries), n, i)), share(maxBytes, n, i), eviction, c.tinyLFU)
+		shards[i] = s
+	}
+
+	return shards
+}
+
+// share returns the part of total shard i of n is bounded to: total split
+// evenly, the first shards taking one more of the remainder each, so that
+// the parts add up to total.
+func share(total int64, n, i int) int64 {
+	part := total / int64(n)
+	if int64(i) < total%int64(n) {
+		part++
+	}
+
+	return part
+}
+
+// shard returns the shard owning key, picked by the FNV-1a hash of the key
+// among those of its namespace, if that has storage of its own, or among
+// those of the cache.
+func (c *cache) shard(key string) segment {
+	shards := c.routing
+	if c.routes != nil {
+		if i := strings.IndexByte(key, ':'); i > 0 {
+			if own, ok := c.routes[key[:i]]; ok {
+				shards = own
+			}
+		}
+	}
+
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+
+	return shards[h%uint32(len(shards))]
+}
+
+// lookup returns the entry for key without counting it as an access.
+func (s *shard) lookup(key string) (*Entry, bool) {
+	v, ok := s.data.Load(key)
+	if !ok {
+		return nil, false
+	}
+
+	return v.(*Entry), true
+}
+
+func (s *shard) get(key string) (*Entry, bool) {
+	v, ok := s.lookup(key)
+
+	if s.tracked.Load() && s.pmu.TryLock() {
+		if s.admitter != nil {
+			s.admitter.record(key)
+		}
+		if ok && s.policy != nil {
+			s.policy.touch(key)
+		}
+		s.pmu.Unlock()
+	}
+
+	return v, ok
+}
+
+// set stores v under key, evicting entries while the shard is over its
+// entry or byte budget, and returns the entry previously under key along
+// with the evicted ones. stored is false when v was not stored, either
+// because the admission filter turned a new key away or because v alone
+// exceeds the byte budget; old is then still cached.
+func (s *shard) set(key string, v *Entry) (stored bool, old *Entry, evicted []eviction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.lookup(key)
+	if s.policy == nil {
+		s.data.Store(key, v)
+		if !exists {
+			s.count++
+		}
+		return true, old, nil
+	}
+	if s.maxBytes > 0 && v.size > s.maxBytes {
+		return false, old, nil
+	}
+
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+
+	if exists {
+		s.bytes -= old.size
+		s.policy.touch(key)
+	} else {
+		if s.admitter != nil && s.full(v.size) {
+			if victim, ok := s.policy.peek(); ok && !s.admitter.admit(key, victim) {
+				return false, old, nil
+			}
+		}
+		s.policy.add(key)
+		s.count++
+	}
+	s.data.Store(key, v)
+	s.bytes += v.size
+
+	return true, old, s.evictOver()
+}
+
+// evictOver evicts entries while the shard is over its bounds. The caller
+// holds both locks.
+func (s *shard) evictOver() []eviction {
+	var evicted []eviction
+	for s.over() {
+		victim, ok := s.policy.victim()
+		if !ok {
+			break
+		}
+		ev, _ := s.lookup(victim)
+		s.bytes -= ev.size
+		s.data.Delete(victim)
+		s.count--
+		s.stats.evictions.Add(1)
+		evicted = append(evicted, eviction{key: victim, value: ev})
+	}
+
+	return evicted
+}
+
+// full reports whether adding an entry of size bytes requires an eviction.
+func (s *shard) full(size int64) bool {
+	return (s.capacity > 0 && s.count >= s.capacity) ||
+		(s.ceiling > 0 && s.count >= s.ceiling) ||
+		(s.maxBytes > 0 && s.bytes+size > s.maxBytes)
+}
+
+func (s *shard) over() bool {
+	return (s.capacity > 0 && s.count > s.capacity) ||
+		(s.ceiling > 0 && s.count > s.ceiling) ||
+		(s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+func (s *shard) delete(key string) (*Entry, bool) {
+	return s.deleteIf(key, nil)
+}
+
+// deleteIf deletes key if its entry satisfies cond, or unconditionally when
+// cond is nil, and returns the deleted entry.
+func (s *shard) deleteIf(key string, cond func(v *Entry) bool) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.lookup(key)
+	if !ok || (cond != nil && !cond(v)) {
+		return nil, false
+	}
+	s.data.Delete(key)
+	s.count--
+	if s.policy != nil {
+		s.pmu.Lock()
+		s.bytes -= v.size
+		s.policy.remove(key)
+		s.pmu.Unlock()
+	}
+
+	return v, true
+}
+
+func (s *shard) swap(key string, old, v *Entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.CompareAndSwap(key, old, v)
+}
+
+func (s *shard) scan(fn func(key string, v *Entry) bool) {
+	var entries []eviction
+	s.data.Range(func(k, v any) bool {
+		entries = append(entries, eviction{key: k.(string), value: v.(*Entry)})
+		return true
+	})
+
+	for _, e := range entries {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+func (s *shard) usage() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.count, s.bytes
+}
+
+func (s *shard) shrink(fraction float64) []eviction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+
+	if s.policy == nil {
+		return nil
+	}
+
+	s.ceiling = max(int(float64(s.count)*(1-fraction)), 1)
+
+	return s.evictOver()
+}
+
+func (s *shard) relax() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ceiling = 0
+}
+
+// resize bounds the shard to capacity entries and maxBytes bytes, zero for
+// no bound, evicting according to eviction, and returns the entries evicted
+// to fit. The order the policy kept is lost when it changes, or when an ARC
+// policy changes size. Entries cached while the shard had no byte budget
+// weigh nothing against one set later.
+func (s *shard) resize(capacity int, maxBytes int64, eviction EvictionPolicy, tinyLFU bool) []eviction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+
+	bounded := capacity > 0 || maxBytes > 0
+	if !bounded && !s.pressured {
+		s.policy, s.admitter = nil, nil
+		s.capacity, s.maxBytes, s.bytes = 0, 0, 0
+		s.tracked.Store(false)
+		return nil
+	}
+
+	if s.policy == nil || s.kind != eviction || (eviction == EvictARC && s.capacity != capacity) {
+		s.policy = eviction.new(capacity)
+		s.kind = eviction
+		s.data.Range(func(k, _ any) bool {
+			s.policy.add(k.(string))
+			return true
+		})
+	}
+	switch {
+	case !tinyLFU || !bounded:
+		s.admitter = nil
+	case s.admitter == nil || s.capacity != capacity:
+		s.admitter = newTinyLFU(capacity)
+	}
+	s.capacity, s.maxBytes = capacity, maxBytes
+	s.tracked.Store(true)
+
+	return s.evictOver()
+}
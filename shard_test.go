@@ -0,0 +1,156 @@
+package memcachedb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func fill(t *testing.T, c Cache, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := c.Set(fmt.Sprint("k", i), i, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	for _, tt := range []struct{ shards, max int }{{0, 10}, {32, 100}, {7, 50}, {4, 1}} {
+		t.Run(fmt.Sprint(tt.shards, "/", tt.max), func(t *testing.T) {
+			c := New(nil, WithoutJanitor(), WithShards(tt.shards), WithMaxEntries(tt.max))
+			defer c.Stop(context.Background())
+
+			fill(t, c, 10*tt.max)
+			if n := c.Stats().Entries; n > tt.max {
+				t.Errorf("Entries = %d, want at most %d", n, tt.max)
+			}
+		})
+	}
+}
+
+func TestShare(t *testing.T) {
+	for _, tt := range []struct {
+		total int64
+		n     int
+	}{{10, 3}, {100, 32}, {31, 32}, {0, 4}, {64, 32}} {
+		var sum, lo, hi int64 = 0, tt.total, 0
+		for i := 0; i < tt.n; i++ {
+			p := share(tt.total, tt.n, i)
+			sum += p
+			lo, hi = min(lo, p), max(hi, p)
+		}
+		if sum != tt.total || hi-lo > 1 {
+			t.Errorf("share(%d, %d, i) sum to %d within [%d, %d]", tt.total, tt.n, sum, lo, hi)
+		}
+	}
+}
+
+func TestUpdateConfigMaxEntries(t *testing.T) {
+	c := New(nil, WithoutJanitor(), WithShards(8))
+	defer c.Stop(context.Background())
+
+	fill(t, c, 200)
+	if err := c.UpdateConfig(Config{MaxEntries: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Stats().Entries; n > 20 {
+		t.Errorf("Entries = %d after UpdateConfig, want at most 20", n)
+	}
+	fill(t, c, 200)
+	if n := c.Stats().Entries; n > 20 {
+		t.Errorf("Entries = %d, want at most 20", n)
+	}
+
+	if err := c.UpdateConfig(Config{MaxEntries: 4}); err == nil {
+		t.Error("UpdateConfig bounding 8 shards to 4 entries succeeded")
+	}
+}
+
+// mutexShard is the shard as it was before hits went lock-free: a map
+// guarded by a RWMutex, whose hits take the write lock to touch the policy
+// when the shard is bounded.
+type mutexShard struct {
+	mu     sync.RWMutex
+	data   map[string]*Entry
+	policy policy
+}
+
+func (s *mutexShard) get(key string) (*Entry, bool) {
+	if s.policy == nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		v, ok := s.data[key]
+		return v, ok
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if ok {
+		s.policy.touch(key)
+	}
+	return v, ok
+}
+
+const benchKeys = 1024
+
+func benchKeyNames() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprint("key", i)
+	}
+	return keys
+}
+
+// benchHits runs parallel hits on get over keys.
+func benchHits(b *testing.B, keys []string, get func(key string) (*Entry, bool)) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, ok := get(keys[i%len(keys)]); !ok {
+				b.Error("miss")
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkShardHits(b *testing.B) {
+	keys := benchKeyNames()
+	for _, bounded := range []bool{false, true} {
+		name := "unbounded"
+		if bounded {
+			name = "lru"
+		}
+
+		b.Run("syncmap/"+name, func(b *testing.B) {
+			s := &shard{stats: new(counters)}
+			if bounded {
+				s.resize(2*benchKeys, 0, EvictLRU, false)
+			}
+			for _, key := range keys {
+				s.set(key, &Entry{})
+			}
+			benchHits(b, keys, s.get)
+		})
+
+		b.Run("rwmutex/"+name, func(b *testing.B) {
+			s := &mutexShard{data: make(map[string]*Entry)}
+			if bounded {
+				s.policy = EvictLRU.new(2 * benchKeys)
+			}
+			for _, key := range keys {
+				s.data[key] = &Entry{}
+				if s.policy != nil {
+					s.policy.add(key)
+				}
+			}
+			benchHits(b, keys, s.get)
+		})
+	}
+}
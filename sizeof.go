@@ -0,0 +1,89 @@
+package memcachedb
+
+import "reflect"
+
+// estimateSize approximates the memory held by v in bytes by walking it
+// with reflection. Shared pointers are counted once.
+func estimateSize(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+
+	return sizeOf(reflect.ValueOf(v), make(map[uintptr]struct{}))
+}
+
+func sizeOf(v reflect.Value, seen map[uintptr]struct{}) int64 {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return int64(v.Type().Size())
+		}
+		if _, ok := seen[v.Pointer()]; ok {
+			return int64(v.Type().Size())
+		}
+		seen[v.Pointer()] = struct{}{}
+		return int64(v.Type().Size()) + sizeOf(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return int64(v.Type().Size())
+		}
+		return int64(v.Type().Size()) + sizeOf(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Type().Size()) + int64(v.Len())
+	case reflect.Slice:
+		size := int64(v.Type().Size())
+		if v.IsNil() {
+			return size
+		}
+		if _, ok := seen[v.Pointer()]; ok {
+			return size
+		}
+		seen[v.Pointer()] = struct{}{}
+		size += int64(v.Cap()-v.Len()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOf(v.Index(i), seen)
+		}
+		return size
+	case reflect.Array:
+		size := int64(0)
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOf(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		size := int64(v.Type().Size())
+		if v.IsNil() {
+			return size
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOf(iter.Key(), seen) + sizeOf(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		size := int64(v.Type().Size())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			size += sizeOf(f, seen) - int64(f.Type().Size())
+		}
+		return size
+	default:
+		return int64(v.Type().Size())
+	}
+}
+
+// isNil reports whether v is nil or a nil pointer, slice, map, channel,
+// function or interface.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
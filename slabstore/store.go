@@ -0,0 +1,328 @@
+// Package slabstore keeps memcachedb entries encoded in large byte slabs,
+// so that millions of cached results cost the garbage collector a handful
+// of pointers rather than several each:
+//
+//	c := memcachedb.New(db,
+//		memcachedb.WithStore(slabstore.New(slabstore.Config{MaxBytes: 1 << 30})))
+//
+// Entries are appended to the newest slab of their shard and indexed by
+// the hash of their key. Once a shard holds as many slabs as its share of
+// MaxBytes allows, its oldest slab is dropped along with the entries still
+// in it, which makes eviction first in, first out. Replaced and deleted
+// entries keep their bytes until their slab goes.
+//
+// Entries are encoded with Entry.MarshalBinary, so the concrete types of
+// cached values must be registered with gob.Register, and every Get
+// decodes a fresh copy. Cached errors and empty results cannot be encoded
+// and are not stored.
+package slabstore
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+
+	memcachedb "memcache-database-module"
+)
+
+const (
+	shardCount = 64
+	// header is the length of the record header: the key hash, then the
+	// lengths of the key and of the encoded entry.
+	header = 16
+
+	defaultSlabSize = 1 << 20
+	defaultMaxBytes = 256 << 20
+)
+
+type (
+	// Config configures a Store.
+	Config struct {
+		// MaxBytes bounds the memory of the slabs, 256 MiB by default.
+		MaxBytes int64
+		// SlabSize is the size of a slab, 1 MiB by default. Entries
+		// larger than a slab are not stored.
+		SlabSize int
+	}
+
+	// Store is a memcachedb.Store keeping entries in byte slabs.
+	Store struct {
+		shards [shardCount]shard
+
+		mu      sync.Mutex
+		onEvict func(key string, e *memcachedb.Entry)
+	}
+
+	shard struct {
+		mu sync.Mutex
+		// index maps the hash of a key to the location of its record,
+		// the slab number in the high half and the offset in the low
+		// one. Neither holds pointers, so the collector skips the map.
+		index map[uint64]uint64
+		// slabs[0] is slab number first; the last one takes appends.
+		slabs    [][]byte
+		first    uint32
+		slabSize int
+		maxSlabs int
+	}
+
+	// evicted is an entry dropped to make room, to be reported once the
+	// shard lock is released.
+	evicted struct {
+		key   string
+		entry *memcachedb.Entry
+	}
+)
+
+var _ memcachedb.EvictingStore = (*Store)(nil)
+
+// New returns a Store configured by cfg.
+func New(cfg Config) *Store {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultMaxBytes
+	}
+	if cfg.SlabSize <= 0 {
+		cfg.SlabSize = defaultSlabSize
+	}
+	maxSlabs := max(int(cfg.MaxBytes/int64(cfg.SlabSize)/shardCount), 1)
+
+	s := &Store{}
+	for i := range s.shards {
+		s.shards[i] = shard{
+			index:    make(map[uint64]uint64),
+			slabSize: cfg.SlabSize,
+			maxSlabs: maxSlabs,
+		}
+	}
+
+	return s
+}
+
+func (s *Store) OnEvict(fn func(key string, e *memcachedb.Entry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onEvict = fn
+}
+
+func (s *Store) Get(key string) (*memcachedb.Entry, bool) {
+	h := xxhash.Sum64String(key)
+	sh := s.shard(h)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	rec, ok := sh.record(h, key)
+	if !ok {
+		return nil, false
+	}
+
+	return decode(rec)
+}
+
+func (s *Store) Set(key string, e *memcachedb.Entry) (*memcachedb.Entry, bool) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return nil, false
+	}
+
+	h := xxhash.Sum64String(key)
+	sh := s.shard(h)
+	size := header + len(key) + len(data)
+	if size > sh.slabSize {
+		return nil, false
+	}
+
+	sh.mu.Lock()
+	var old *memcachedb.Entry
+	if rec, ok := sh.record(h, key); ok {
+		old, _ = decode(rec)
+	}
+	displaced := sh.displaced(h, key)
+	dropped := sh.append(h, key, data, size)
+	sh.mu.Unlock()
+
+	s.evicted(append(dropped, displaced...))
+
+	return old, true
+}
+
+func (s *Store) Delete(key string) (*memcachedb.Entry, bool) {
+	h := xxhash.Sum64String(key)
+	sh := s.shard(h)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	rec, ok := sh.record(h, key)
+	if !ok {
+		return nil, false
+	}
+	delete(sh.index, h)
+
+	return decode(rec)
+}
+
+func (s *Store) Scan(fn func(key string, e *memcachedb.Entry) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+
+		sh.mu.Lock()
+		var recs []evicted
+		for _, loc := range sh.index {
+			key, rec := sh.at(loc)
+			if e, ok := decode(rec); ok {
+				recs = append(recs, evicted{key: key, entry: e})
+			}
+		}
+		sh.mu.Unlock()
+
+		for _, r := range recs {
+			if !fn(r.key, r.entry) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Store) Len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		n += len(sh.index)
+		sh.mu.Unlock()
+	}
+
+	return n
+}
+
+func (s *Store) String() string { return "slabstore" }
+
+func (s *Store) shard(h uint64) *shard {
+	return &s.shards[h%shardCount]
+}
+
+func (s *Store) evicted(dropped []evicted) {
+	if len(dropped) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	onEvict := s.onEvict
+	s.mu.Unlock()
+
+	if onEvict == nil {
+		return
+	}
+	for _, d := range dropped {
+		onEvict(d.key, d.entry)
+	}
+}
+
+// record returns the encoded entry of key, whose hash is h.
+func (sh *shard) record(h uint64, key string) ([]byte, bool) {
+	loc, ok := sh.index[h]
+	if !ok {
+		return nil, false
+	}
+	k, rec := sh.at(loc)
+	if k != key {
+		return nil, false
+	}
+
+	return rec, true
+}
+
+// displaced returns the entry of another key sharing hash h, which the
+// entry of key is about to replace in the index.
+func (sh *shard) displaced(h uint64, key string) []evicted {
+	loc, ok := sh.index[h]
+	if !ok {
+		return nil
+	}
+	k, rec := sh.at(loc)
+	if k == key {
+		return nil
+	}
+	e, ok := decode(rec)
+	if !ok {
+		return nil
+	}
+
+	return []evicted{{key: k, entry: e}}
+}
+
+// at returns the key and encoded entry of the record at loc.
+func (sh *shard) at(loc uint64) (string, []byte) {
+	slab := sh.slabs[uint32(loc>>32)-sh.first]
+	off := int(uint32(loc))
+	klen := int(binary.LittleEndian.Uint32(slab[off+8:]))
+	dlen := int(binary.LittleEndian.Uint32(slab[off+12:]))
+	key := slab[off+header : off+header+klen]
+
+	return string(key), slab[off+header+klen : off+header+klen+dlen]
+}
+
+// append writes the record of key to the newest slab, starting a new one
+// when it is full, and returns the entries of the slab dropped to stay
+// within bounds.
+func (sh *shard) append(h uint64, key string, data []byte, size int) []evicted {
+	var dropped []evicted
+	if n := len(sh.slabs); n == 0 || len(sh.slabs[n-1])+size > sh.slabSize {
+		if n == sh.maxSlabs {
+			dropped = sh.dropOldest()
+		}
+		sh.slabs = append(sh.slabs, make([]byte, 0, sh.slabSize))
+	}
+
+	n := len(sh.slabs) - 1
+	slab := sh.slabs[n]
+	off := len(slab)
+	slab = binary.LittleEndian.AppendUint64(slab, h)
+	slab = binary.LittleEndian.AppendUint32(slab, uint32(len(key)))
+	slab = binary.LittleEndian.AppendUint32(slab, uint32(len(data)))
+	slab = append(slab, key...)
+	slab = append(slab, data...)
+	sh.slabs[n] = slab
+	sh.index[h] = uint64(sh.first+uint32(n))<<32 | uint64(off)
+
+	return dropped
+}
+
+// dropOldest drops the oldest slab and returns the entries still indexed
+// in it.
+func (sh *shard) dropOldest() []evicted {
+	var dropped []evicted
+	slab := sh.slabs[0]
+	for off := 0; off < len(slab); {
+		h := binary.LittleEndian.Uint64(slab[off:])
+		klen := int(binary.LittleEndian.Uint32(slab[off+8:]))
+		dlen := int(binary.LittleEndian.Uint32(slab[off+12:]))
+		loc := uint64(sh.first)<<32 | uint64(off)
+		if sh.index[h] == loc {
+			delete(sh.index, h)
+			key, rec := sh.at(loc)
+			if e, ok := decode(rec); ok {
+				dropped = append(dropped, evicted{key: key, entry: e})
+			}
+		}
+		off += header + klen + dlen
+	}
+
+	sh.slabs[0] = nil
+	sh.slabs = sh.slabs[1:]
+	sh.first++
+
+	return dropped
+}
+
+func decode(rec []byte) (*memcachedb.Entry, bool) {
+	e := new(memcachedb.Entry)
+	if err := e.UnmarshalBinary(rec); err != nil {
+		return nil, false
+	}
+
+	return e, true
+}
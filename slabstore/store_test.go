@@ -0,0 +1,102 @@
+package slabstore_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	memcachedb "memcache-database-module"
+	"memcache-database-module/slabstore"
+)
+
+// gcEntries is how many entries BenchmarkGCPause holds in each cache.
+const gcEntries = 2_000_000
+
+func TestStore(t *testing.T) {
+	s := slabstore.New(slabstore.Config{MaxBytes: 1 << 20, SlabSize: 64 << 10})
+	c := memcachedb.New(nil, memcachedb.WithoutJanitor(), memcachedb.WithStore(s))
+	defer c.Stop(context.Background())
+
+	for i := 0; i < 100; i++ {
+		if err := c.Set(fmt.Sprint("key", i), fmt.Sprint("value", i), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, ok := c.PeekKey("key42"); !ok || v != "value42" {
+		t.Errorf("PeekKey = %v, %t, want value42", v, ok)
+	}
+	if !c.InvalidateKey("key42") {
+		t.Error("InvalidateKey found no entry")
+	}
+	if _, ok := c.PeekKey("key42"); ok {
+		t.Error("entry left after InvalidateKey")
+	}
+	if n := s.Len(); n != 99 {
+		t.Errorf("Len = %d, want 99", n)
+	}
+}
+
+func TestStoreEvictsOldestSlab(t *testing.T) {
+	s := slabstore.New(slabstore.Config{MaxBytes: 64 * (4 << 10), SlabSize: 4 << 10})
+	evicted := 0
+	c := memcachedb.New(nil, memcachedb.WithoutJanitor(), memcachedb.WithStore(s),
+		memcachedb.WithOnEvict(func(string, interface{}, memcachedb.Reason) { evicted++ }))
+	defer c.Stop(context.Background())
+
+	value := strings.Repeat("v", 512)
+	for i := 0; i < 10_000; i++ {
+		c.Set(fmt.Sprint("key", i), value, time.Minute)
+	}
+	if evicted == 0 {
+		t.Error("no entry evicted past MaxBytes")
+	}
+	if _, ok := c.PeekKey("key9999"); !ok {
+		t.Error("newest entry evicted")
+	}
+}
+
+// BenchmarkGCPause holds gcEntries entries in the built-in shards and in a
+// Store, and reports the time of a full collection with each as ns/op, its
+// stop-the-world pauses and the objects left on the heap.
+func BenchmarkGCPause(b *testing.B) {
+	if testing.Short() {
+		b.Skip("fills caches with millions of entries")
+	}
+
+	for _, bc := range []struct {
+		name string
+		opts []memcachedb.Option
+	}{
+		{"shards", nil},
+		{"slabstore", []memcachedb.Option{memcachedb.WithStore(slabstore.New(slabstore.Config{MaxBytes: 2 << 30}))}},
+	} {
+		c := memcachedb.New(nil, append([]memcachedb.Option{memcachedb.WithoutJanitor()}, bc.opts...)...)
+		value := strings.Repeat("v", 64)
+		for i := 0; i < gcEntries; i++ {
+			c.Set(fmt.Sprint("key", i), value, time.Hour)
+		}
+
+		b.Run(bc.name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			runtime.ReadMemStats(&after)
+
+			gcs := after.NumGC - before.NumGC
+			if gcs == 0 {
+				return
+			}
+			b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(gcs), "pause-ns/gc")
+			b.ReportMetric(float64(after.HeapObjects), "heap-objects")
+		})
+
+		runtime.KeepAlive(c)
+		c.Stop(context.Background())
+	}
+}
@@ -0,0 +1,216 @@
+package memcachedb
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+type (
+	snapshotHeader struct {
+		Version int
+		Created time.Time
+	}
+
+	// snapshotEntry is the gob form of a cached entry.
+	snapshotEntry struct {
+		Key       string
+		Value     interface{}
+		Lifetime  int64
+		Fresh     int64
+		RefreshAt int64
+		Tags      []string
+		// Fingerprint is zero in snapshots taken before it was added,
+		// which leaves the entry unverified.
+		Fingerprint uint64
+		// Created is zero in snapshots taken before it was added.
+		Created int64
+	}
+
+	// errWriter remembers the first error of the underlying writer, telling
+	// write failures apart from values gob cannot encode.
+	errWriter struct {
+		w   io.Writer
+		err error
+	}
+)
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.err = err
+
+	return n, err
+}
+
+func (c *cache) SaveSnapshot(w io.Writer) error {
+	ew := &errWriter{w: w}
+	enc := gob.NewEncoder(ew)
+	if err := enc.Encode(snapshotHeader{Version: snapshotVersion, Created: c.clock.Now()}); err != nil {
+		return err
+	}
+
+	for _, s := range c.shards {
+		var entries []snapshotEntry
+		s.scan(func(k string, v *Entry) bool {
+			if v.persistable() {
+				entries = append(entries, newSnapshotEntry(k, v))
+			}
+			return true
+		})
+
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				if ew.err != nil {
+					return ew.err
+				}
+				c.logger.Warn("memcachedb: entry left out of snapshot", "key", e.Key, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *cache) LoadSnapshot(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+
+	var h snapshotHeader
+	if err := dec.Decode(&h); err != nil {
+		return fmt.Errorf("memcachedb: read snapshot header: %w", err)
+	}
+	if h.Version != snapshotVersion {
+		return fmt.Errorf("memcachedb: unsupported snapshot version %d", h.Version)
+	}
+
+	now := c.now()
+	for {
+		var e snapshotEntry
+		if err := dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("memcachedb: read snapshot: %w", err)
+		}
+		if e.Lifetime <= now {
+			continue
+		}
+
+		// Entries cached since the snapshot was taken are newer.
+		s := c.shard(e.Key)
+		if _, ok := s.lookup(e.Key); ok {
+			continue
+		}
+		c.store(s, e.Key, c.restoredEntity(e))
+	}
+}
+
+// persistable reports whether v survives a restart. Cached errors and empty
+// results do not.
+func (v *Entry) persistable() bool {
+	return v.err == nil && !v.negative
+}
+
+func newSnapshotEntry(key string, v *Entry) snapshotEntry {
+	return snapshotEntry{
+		Key:         key,
+		Value:       v.Value(),
+		Lifetime:    v.lifetime,
+		Fresh:       v.fresh,
+		RefreshAt:   v.refreshAt,
+		Tags:        v.tags,
+		Fingerprint: v.fingerprint,
+		Created:     v.created,
+	}
+}
+
+func (c *cache) restoredEntity(e snapshotEntry) *Entry {
+	v := &Entry{
+		lifetime:    e.Lifetime,
+		fresh:       e.Fresh,
+		refreshAt:   e.RefreshAt,
+		value:       e.Value,
+		size:        c.sizeOf(e.Key, e.Value),
+		tags:        e.Tags,
+		fingerprint: e.Fingerprint,
+		created:     e.Created,
+		usage:       newUsage(c.now()),
+	}
+	c.pack(e.Key, v)
+	c.seal(v)
+
+	return v
+}
+
+// restoreSnapshot loads the snapshot file at path if there is one.
+func (c *cache) restoreSnapshot(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Error("memcachedb: open snapshot", "path", path, "error", err)
+		}
+		return
+	}
+	defer f.Close()
+
+	if err = c.LoadSnapshot(f); err != nil {
+		c.logger.Error("memcachedb: restore snapshot", "path", path, "error", err)
+	}
+}
+
+// SaveSnapshotFile saves a snapshot of c to the file at path, as
+// SaveSnapshot writes it, replacing the previous one only once the new one
+// is complete, so that the file always holds a whole snapshot. It is how
+// WithSnapshot saves its snapshots.
+func SaveSnapshotFile(c Cache, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = c.SaveSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// snapshotLoop saves a snapshot to path every interval and once more when
+// the cache stops, after the calls in flight stored what they loaded. Stop
+// waits for the last one.
+func (c *cache) snapshotLoop(path string, interval time.Duration) {
+	c.finishing.Add(1)
+	go func() {
+		defer c.finishing.Done()
+
+		tt := time.NewTicker(interval)
+		defer tt.Stop()
+		for {
+			select {
+			case <-tt.C:
+			case <-c.settled:
+			}
+			if err := SaveSnapshotFile(c, path); err != nil {
+				c.logger.Error("memcachedb: write snapshot", "path", path, "error", err)
+			}
+			select {
+			case <-c.settled:
+				return
+			default:
+			}
+		}
+	}()
+}
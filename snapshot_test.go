@@ -0,0 +1,51 @@
+package memcachedb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stopDuringLoad stops c while a DoKeyed call for key is loading, and
+// returns once both are done.
+func stopDuringLoad(t *testing.T, c Cache, key string) {
+	t.Helper()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := c.DoKeyed(context.Background(), key, func(context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "late", nil
+		})
+		loaded <- err
+	}()
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- c.Stop(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotOnStopAfterDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	c := New(nil, WithoutJanitor(), WithSnapshot(path, time.Hour))
+	stopDuringLoad(t, c, "late")
+
+	c = New(nil, WithoutJanitor(), WithSnapshot(path, 0))
+	defer c.Stop(context.Background())
+	if v, ok := c.PeekKey("late"); !ok || v != "late" {
+		t.Errorf("PeekKey = %v, %t after restore, want late", v, ok)
+	}
+}
@@ -0,0 +1,267 @@
+package memcachedb
+
+import "strings"
+
+type sqlToken struct {
+	text string
+	// word is set for keywords and identifiers, quoted or not.
+	word   bool
+	quoted bool
+}
+
+// tokenize splits query into words and punctuation, dropping whitespace,
+// comments, string literals and numbers.
+func tokenize(query string) []sqlToken {
+	var toks []sqlToken
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(query)
+			}
+		case ch == '\'':
+			i, _ = skipQuoted(query, i, '\'')
+		case ch == '"' || ch == '`' || ch == '[':
+			end := byte(ch)
+			if ch == '[' {
+				end = ']'
+			}
+			j, closed := skipQuoted(query, i, end)
+			if !closed {
+				// The query is malformed; leave the database to say so.
+				i = j
+				continue
+			}
+			toks = append(toks, sqlToken{
+				text:   strings.ReplaceAll(query[i+1:j-1], string([]byte{end, end}), string(end)),
+				word:   true,
+				quoted: true,
+			})
+			i = j
+		case isWordByte(ch):
+			j := i
+			for j < len(query) && (isWordByte(query[j]) || query[j] == '$') {
+				j++
+			}
+			if ch < '0' || ch > '9' {
+				toks = append(toks, sqlToken{text: query[i:j], word: true})
+			}
+			i = j
+		case ch == '.' || ch == ',' || ch == '(' || ch == ')' || ch == ';':
+			toks = append(toks, sqlToken{text: query[i : i+1]})
+			i++
+		default:
+			i++
+		}
+	}
+
+	return toks
+}
+
+// skipQuoted returns the index just past the literal opened at query[i] and
+// closed by end, where a doubled end is an escaped one, and whether it is
+// closed at all.
+func skipQuoted(query string, i int, end byte) (int, bool) {
+	for j := i + 1; j < len(query); j++ {
+		if query[j] != end {
+			continue
+		}
+		if j+1 < len(query) && query[j+1] == end {
+			j++
+			continue
+		}
+		return j + 1, true
+	}
+
+	return len(query), false
+}
+
+func isWordByte(ch byte) bool {
+	return ch == '_' || ch >= 0x80 ||
+		(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// is reports whether toks[i] is the unquoted keyword kw.
+func is(toks []sqlToken, i int, kw string) bool {
+	return i >= 0 && i < len(toks) && toks[i].word && !toks[i].quoted && strings.EqualFold(toks[i].text, kw)
+}
+
+// tableAt reads a possibly schema-qualified table name at toks[i] and
+// returns its last part along with the index following it.
+func tableAt(toks []sqlToken, i int) (string, int, bool) {
+	if i >= len(toks) || !toks[i].word {
+		return "", i, false
+	}
+	name := toks[i].text
+	i++
+	for i+1 < len(toks) && toks[i].text == "." && toks[i+1].word {
+		name = toks[i+1].text
+		i += 2
+	}
+
+	return name, i, true
+}
+
+// writeTables returns the tables written by the INSERT, UPDATE, DELETE,
+// MERGE, REPLACE and TRUNCATE statements in query.
+func writeTables(query string) []string {
+	toks := tokenize(query)
+
+	var tables []string
+	add := func(i int) int {
+		name, next, ok := tableAt(toks, i)
+		if ok {
+			tables = append(tables, name)
+		}
+		return next
+	}
+
+	for i := 0; i < len(toks); i++ {
+		switch {
+		case is(toks, i, "INSERT") || is(toks, i, "REPLACE") || is(toks, i, "MERGE"):
+			i++
+			for is(toks, i, "IGNORE") || is(toks, i, "LOW_PRIORITY") || is(toks, i, "DELAYED") || is(toks, i, "HIGH_PRIORITY") {
+				i++
+			}
+			if is(toks, i, "INTO") {
+				i = add(i+1) - 1
+			}
+		case is(toks, i, "UPDATE"):
+			// Skip ON CONFLICT ... DO UPDATE, ON DUPLICATE KEY UPDATE and
+			// the row locks of SELECT ... FOR UPDATE.
+			if is(toks, i-1, "DO") || is(toks, i-1, "KEY") || is(toks, i-1, "FOR") {
+				continue
+			}
+			i++
+			for is(toks, i, "ONLY") || is(toks, i, "LOW_PRIORITY") || is(toks, i, "IGNORE") {
+				i++
+			}
+			i = add(i) - 1
+		case is(toks, i, "DELETE"):
+			i++
+			for is(toks, i, "LOW_PRIORITY") || is(toks, i, "QUICK") || is(toks, i, "IGNORE") {
+				i++
+			}
+			if is(toks, i, "FROM") {
+				i++
+			}
+			if is(toks, i, "ONLY") {
+				i++
+			}
+			i = add(i) - 1
+		case is(toks, i, "TRUNCATE"):
+			i++
+			if is(toks, i, "TABLE") {
+				i++
+			}
+			for {
+				if is(toks, i, "ONLY") {
+					i++
+				}
+				i = add(i)
+				if i >= len(toks) || toks[i].text != "," {
+					break
+				}
+				i++
+			}
+			i--
+		}
+	}
+
+	return tables
+}
+
+// readTables returns the tables read by the FROM and JOIN clauses of the
+// statements in query, subqueries included. Table functions and the common
+// table expressions of WITH clauses are left out.
+func readTables(query string) []string {
+	toks := tokenize(query)
+
+	ctes := make(map[string]bool)
+	for i := 1; i+1 < len(toks); i++ {
+		// name [(columns)] AS ( ... )
+		if !is(toks, i, "AS") || toks[i+1].text != "(" {
+			continue
+		}
+		j := i - 1
+		if toks[j].text == ")" {
+			for j >= 0 && toks[j].text != "(" {
+				j--
+			}
+			j--
+		}
+		if j >= 0 && toks[j].word {
+			ctes[strings.ToLower(toks[j].text)] = true
+		}
+	}
+
+	var tables []string
+	// add reads the table at toks[i], if any, and returns the index
+	// following it and its alias.
+	add := func(i int) int {
+		for is(toks, i, "ONLY") || is(toks, i, "LATERAL") {
+			i++
+		}
+		name, next, ok := tableAt(toks, i)
+		if !ok || (next < len(toks) && toks[next].text == "(") {
+			return i
+		}
+		if !ctes[strings.ToLower(name)] {
+			tables = append(tables, name)
+		}
+		if is(toks, next, "AS") {
+			next += 2
+		} else if next+1 < len(toks) && toks[next].word && toks[next+1].text == "," {
+			next++
+		}
+		return next
+	}
+
+	for i := 0; i < len(toks); i++ {
+		switch {
+		case is(toks, i, "FROM"):
+			// Skip IS [NOT] DISTINCT FROM and EXTRACT(x FROM y).
+			if is(toks, i-1, "DISTINCT") || inFunction(toks, i) {
+				continue
+			}
+			i = add(i + 1)
+			for i < len(toks) && toks[i].text == "," {
+				i = add(i + 1)
+			}
+			i--
+		case is(toks, i, "JOIN"):
+			i = add(i+1) - 1
+		}
+	}
+
+	return tables
+}
+
+// inFunction reports whether toks[i] is an argument of one of the
+// functions whose syntax uses FROM.
+func inFunction(toks []sqlToken, i int) bool {
+	depth := 0
+	for j := i - 1; j > 0; j-- {
+		switch toks[j].text {
+		case ")":
+			depth++
+		case "(":
+			if depth == 0 {
+				return is(toks, j-1, "EXTRACT") || is(toks, j-1, "SUBSTRING") ||
+					is(toks, j-1, "TRIM") || is(toks, j-1, "OVERLAY") || is(toks, j-1, "POSITION")
+			}
+			depth--
+		}
+	}
+
+	return false
+}
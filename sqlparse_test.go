@@ -0,0 +1,91 @@
+package memcachedb
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReadTables(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"from", "SELECT * FROM users WHERE id = $1", []string{"users"}},
+		{"schema", "SELECT * FROM public.users u", []string{"users"}},
+		{"quoted", `SELECT * FROM "Odd ""Name""" JOIN [dbo].[orders] ON 1 = 1`, []string{`Odd "Name"`, "orders"}},
+		{"list", "SELECT * FROM users u, orders AS o, items", []string{"users", "orders", "items"}},
+		{"joins", "SELECT * FROM users u LEFT JOIN orders o ON o.user_id = u.id INNER JOIN items i ON i.order_id = o.id", []string{"users", "orders", "items"}},
+		{"subquery", "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)", []string{"users", "orders"}},
+		{"derived", "SELECT * FROM (SELECT * FROM orders) o JOIN LATERAL (SELECT * FROM items) i ON true", []string{"orders", "items"}},
+		{"cte", "WITH recent AS (SELECT * FROM orders), top (id) AS (SELECT id FROM recent) SELECT * FROM recent JOIN top ON true JOIN users ON true", []string{"orders", "users"}},
+		{"table function", "SELECT * FROM generate_series(1, 10) JOIN users ON true", []string{"users"}},
+		{"functions", "SELECT EXTRACT(YEAR FROM created), TRIM(BOTH ' ' FROM name) FROM users WHERE a IS DISTINCT FROM b", []string{"users"}},
+		{"comments and literals", "SELECT 'FROM fake' -- FROM fake\n/* JOIN fake */ FROM users", []string{"users"}},
+		{"keywords in any case", "select * from Users join Orders on true", []string{"Users", "Orders"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readTables(tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("readTables(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTables(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"insert", "INSERT INTO users (id) VALUES ($1)", []string{"users"}},
+		{"insert ignore", "INSERT IGNORE INTO db.users VALUES (1)", []string{"users"}},
+		{"upsert", "INSERT INTO users VALUES (1) ON CONFLICT (id) DO UPDATE SET n = 1", []string{"users"}},
+		{"duplicate key", "INSERT INTO users VALUES (1) ON DUPLICATE KEY UPDATE n = 1", []string{"users"}},
+		{"update", "UPDATE ONLY users SET n = 1", []string{"users"}},
+		{"delete", "DELETE FROM orders WHERE id = 1", []string{"orders"}},
+		{"truncate", "TRUNCATE TABLE users, ONLY orders", []string{"users", "orders"}},
+		{"statements", "UPDATE users SET n = 1; DELETE FROM orders", []string{"users", "orders"}},
+		{"select", "SELECT * FROM users", nil},
+		{"for update", "SELECT * FROM users FOR UPDATE", nil},
+		{"for update skip locked", "SELECT * FROM jobs FOR UPDATE SKIP LOCKED", nil},
+		{"for update of", "SELECT * FROM jobs j JOIN users u ON true FOR UPDATE OF j NOWAIT", nil},
+		{"for no key update", "SELECT * FROM jobs FOR NO KEY UPDATE", nil},
+		{"locking read then update", "SELECT id FROM jobs FOR UPDATE; UPDATE jobs SET n = 1", []string{"jobs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writeTables(tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("writeTables(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, query := range []string{
+		`SELECT * FROM users WHERE name = "`,
+		"SELECT * FROM users WHERE name = `",
+		"SELECT * FROM users WHERE name = [",
+		`SELECT * FROM "users`,
+		`SELECT * FROM "a"""`,
+		"SELECT * FROM users WHERE name = '",
+		"SELECT * FROM users /* open",
+		"SELECT * FROM",
+		"FROM",
+		"JOIN",
+		"WITH x AS (",
+		"INSERT INTO",
+		"TRUNCATE",
+		") AS (",
+		"",
+	} {
+		readTables(query)
+		writeTables(query)
+	}
+
+	if got := readTables(`SELECT * FROM users WHERE name = "`); !slices.Equal(got, []string{"users"}) {
+		t.Errorf("readTables of an unterminated identifier = %q, want [users]", got)
+	}
+}
@@ -0,0 +1,211 @@
+package memcachedb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Stats is a point-in-time snapshot of cache counters.
+	Stats struct {
+		// Hits counts calls served from the cache.
+		Hits uint64
+		// StaleHits counts hits served stale while the entry was refreshed
+		// in the background.
+		StaleHits uint64
+		// Refreshes counts background refreshes of cached entries.
+		Refreshes uint64
+		// NegativeHits counts hits on empty results cached by
+		// WithNegativeCaching.
+		NegativeHits uint64
+		// Misses counts calls that found no entry.
+		Misses uint64
+		// L2Hits counts misses served from the shared tier set by WithL2
+		// instead of the database.
+		L2Hits uint64
+		// PeerHits counts misses served by the process of the peer group
+		// owning the key, as picked by WithPeers.
+		PeerHits uint64
+		// Collisions counts entries passed over because they were cached
+		// for other arguments hashing to the same key. Such calls count
+		// as misses.
+		Collisions uint64
+		// Mutations counts cached values found modified in place by
+		// WithMutationCheck.
+		Mutations uint64
+		// Coalesced counts missing callers that shared another caller's
+		// in-flight load instead of querying the database themselves.
+		Coalesced uint64
+		// Loads counts query executions.
+		Loads uint64
+		// LoadErrors counts query executions that returned an error.
+		LoadErrors uint64
+		// Throttled counts loads held back by WithLoadInterval.
+		Throttled uint64
+		// Hedges counts second runs of queries started by WithHedging.
+		Hedges uint64
+		// Retries counts queries run again after failing, as allowed by
+		// WithRetryPolicy.
+		Retries uint64
+		// Prepares counts statements prepared for loads by
+		// WithPreparedStatements.
+		Prepares uint64
+		// PrepareHits counts loads that reused a prepared statement.
+		PrepareHits uint64
+		// Oversized counts loaded results left uncached by
+		// WithResultLimit.
+		Oversized uint64
+		// Rejected counts values refused by WithMaxValueSize.
+		Rejected uint64
+		// Timeouts counts queries cut off by WithLoaderTimeout.
+		Timeouts uint64
+		// Refused counts loads refused by the open circuit breaker set by
+		// WithCircuitBreaker.
+		Refused uint64
+		// Fallbacks counts calls served a stale entry because their load
+		// failed, as allowed by WithStaleOnError, WithLoaderTimeout or
+		// WithCircuitBreaker.
+		Fallbacks uint64
+		// Evictions counts entries dropped to stay within the cache bounds.
+		Evictions uint64
+		// Expirations counts entries removed after their TTL, by the
+		// janitor or by the call that found them expired.
+		Expirations uint64
+		// Idle counts entries removed for going unread, as set by
+		// WithMaxIdle.
+		Idle uint64
+
+		// Compressed counts values stored compressed by WithCompression.
+		Compressed uint64
+		// BytesSaved totals the bytes compression saved on those values,
+		// against their encoding under WithCodec and their estimated
+		// memory use otherwise.
+		BytesSaved uint64
+
+		// Entries is the number of entries currently cached.
+		Entries int
+		// Bytes is the total cost of the cached entries. It is only tracked
+		// when the cache has a byte budget.
+		Bytes int64
+		// LoadLatency is the distribution of query durations.
+		LoadLatency Histogram
+		// TimeSaved estimates the database time hits avoided: the
+		// duration of the query of every entry hit, each time it is hit,
+		// or the mean query duration for entries cached otherwise, such
+		// as by Set, a snapshot or another tier.
+		TimeSaved time.Duration
+	}
+
+	counters struct {
+		hits         atomic.Uint64
+		staleHits    atomic.Uint64
+		refreshes    atomic.Uint64
+		negativeHits atomic.Uint64
+		misses       atomic.Uint64
+		l2Hits       atomic.Uint64
+		peerHits     atomic.Uint64
+		collisions   atomic.Uint64
+		mutations    atomic.Uint64
+		coalesced    atomic.Uint64
+		loads        atomic.Uint64
+		loadErrors   atomic.Uint64
+		throttled    atomic.Uint64
+		hedges       atomic.Uint64
+		retries      atomic.Uint64
+		prepares     atomic.Uint64
+		prepareHits  atomic.Uint64
+		oversized    atomic.Uint64
+		rejected     atomic.Uint64
+		timeouts     atomic.Uint64
+		refused      atomic.Uint64
+		fallbacks    atomic.Uint64
+		evictions    atomic.Uint64
+		expirations  atomic.Uint64
+		idle         atomic.Uint64
+		compressed   atomic.Uint64
+		bytesSaved   atomic.Uint64
+		loadLatency  histogram
+		// timeSaved totals the load times of the entries hit, in
+		// nanoseconds; unmeasured counts the hits on entries without one.
+		timeSaved  atomic.Int64
+		unmeasured atomic.Uint64
+	}
+)
+
+// saved counts the database time a hit on e saved.
+func (s *counters) saved(e *Entry) {
+	if e.loadTime > 0 {
+		s.timeSaved.Add(int64(e.loadTime))
+	} else {
+		s.unmeasured.Add(1)
+	}
+}
+
+// timeSavedBy returns the database time saved by the hits counted so far,
+// given the latency distribution h of the loads.
+func (s *counters) timeSavedBy(h Histogram) time.Duration {
+	saved := time.Duration(s.timeSaved.Load())
+	if n := s.unmeasured.Load(); n > 0 && h.Count > 0 {
+		saved += time.Duration(n) * (h.Sum / time.Duration(h.Count))
+	}
+
+	return saved
+}
+
+// HitRatio returns the fraction of calls served from the cache.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+func (c *cache) Stats() Stats {
+	var (
+		entries int
+		bytes   int64
+	)
+	for _, s := range c.shards {
+		n, b := s.usage()
+		entries += n
+		bytes += b
+	}
+
+	latency := c.stats.loadLatency.snapshot()
+
+	return Stats{
+		Hits:         c.stats.hits.Load(),
+		StaleHits:    c.stats.staleHits.Load(),
+		Refreshes:    c.stats.refreshes.Load(),
+		NegativeHits: c.stats.negativeHits.Load(),
+		Misses:       c.stats.misses.Load(),
+		L2Hits:       c.stats.l2Hits.Load(),
+		PeerHits:     c.stats.peerHits.Load(),
+		Collisions:   c.stats.collisions.Load(),
+		Mutations:    c.stats.mutations.Load(),
+		Coalesced:    c.stats.coalesced.Load(),
+		Loads:        c.stats.loads.Load(),
+		LoadErrors:   c.stats.loadErrors.Load(),
+		Throttled:    c.stats.throttled.Load(),
+		Hedges:       c.stats.hedges.Load(),
+		Retries:      c.stats.retries.Load(),
+		Prepares:     c.stats.prepares.Load(),
+		PrepareHits:  c.stats.prepareHits.Load(),
+		Oversized:    c.stats.oversized.Load(),
+		Rejected:     c.stats.rejected.Load(),
+		Timeouts:     c.stats.timeouts.Load(),
+		Refused:      c.stats.refused.Load(),
+		Fallbacks:    c.stats.fallbacks.Load(),
+		Evictions:    c.stats.evictions.Load(),
+		Expirations:  c.stats.expirations.Load(),
+		Idle:         c.stats.idle.Load(),
+		Compressed:   c.stats.compressed.Load(),
+		BytesSaved:   c.stats.bytesSaved.Load(),
+		Entries:      entries,
+		Bytes:        bytes,
+		LoadLatency:  latency,
+		TimeSaved:    c.stats.timeSavedBy(latency),
+	}
+}
@@ -0,0 +1,184 @@
+package memcachedb
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// stmtCache keeps the prepared statements of the most recently loaded
+	// queries, so that loads of a query reuse its statement instead of
+	// preparing it again. A statement pushed out is closed once the loads
+	// using it are done.
+	stmtCache struct {
+		mu      sync.Mutex
+		size    int
+		lru     *list.List
+		byQuery map[string]*list.Element
+		closed  bool
+		stats   *counters
+	}
+
+	stmtEntry struct {
+		query   string
+		stmt    *sqlx.Stmt
+		refs    int
+		evicted bool
+	}
+)
+
+func newStmtCache(size int, stats *counters) *stmtCache {
+	return &stmtCache{
+		size:    size,
+		lru:     list.New(),
+		byQuery: make(map[string]*list.Element),
+		stats:   stats,
+	}
+}
+
+// acquire returns the statement of query, preparing it on db if it is not
+// cached. The caller must release it.
+func (sc *stmtCache) acquire(ctx context.Context, db *sqlx.DB, query string) (*stmtEntry, error) {
+	if e, ok := sc.cached(query); ok {
+		sc.stats.prepareHits.Add(1)
+		return e, nil
+	}
+
+	stmt, err := db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	sc.stats.prepares.Add(1)
+
+	sc.mu.Lock()
+	if el, ok := sc.byQuery[query]; ok && !sc.closed {
+		// Prepared concurrently by another load.
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		sc.mu.Unlock()
+		stmt.Close()
+		return e, nil
+	}
+	e := &stmtEntry{query: query, stmt: stmt, refs: 1}
+	if sc.closed {
+		// Used once and closed on release.
+		e.evicted = true
+		sc.mu.Unlock()
+		return e, nil
+	}
+	sc.byQuery[query] = sc.lru.PushFront(e)
+	var unused []*sqlx.Stmt
+	for sc.lru.Len() > sc.size {
+		old := sc.lru.Remove(sc.lru.Back()).(*stmtEntry)
+		delete(sc.byQuery, old.query)
+		old.evicted = true
+		if old.refs == 0 {
+			unused = append(unused, old.stmt)
+		}
+	}
+	sc.mu.Unlock()
+
+	for _, st := range unused {
+		st.Close()
+	}
+
+	return e, nil
+}
+
+func (sc *stmtCache) cached(query string) (*stmtEntry, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	el, ok := sc.byQuery[query]
+	if !ok {
+		return nil, false
+	}
+	sc.lru.MoveToFront(el)
+	e := el.Value.(*stmtEntry)
+	e.refs++
+
+	return e, true
+}
+
+func (sc *stmtCache) release(e *stmtEntry) {
+	sc.mu.Lock()
+	e.refs--
+	unused := e.evicted && e.refs == 0
+	sc.mu.Unlock()
+
+	if unused {
+		e.stmt.Close()
+	}
+}
+
+// close closes the cached statements, those in use once released.
+func (sc *stmtCache) close() {
+	sc.mu.Lock()
+	sc.closed = true
+	var unused []*sqlx.Stmt
+	for el := sc.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*stmtEntry)
+		e.evicted = true
+		if e.refs == 0 {
+			unused = append(unused, e.stmt)
+		}
+	}
+	sc.lru.Init()
+	clear(sc.byQuery)
+	sc.mu.Unlock()
+
+	for _, st := range unused {
+		st.Close()
+	}
+}
+
+// dbGet is sqlx.DB.GetContext through the statement cache, if any.
+func (c *cache) dbGet(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if db := c.dbFor(ctx); c.stmts == nil || db != c.db {
+		return db.GetContext(ctx, dest, query, args...)
+	}
+
+	e, err := c.stmts.acquire(ctx, c.db, query)
+	if err != nil {
+		return err
+	}
+	defer c.stmts.release(e)
+
+	return e.stmt.GetContext(ctx, dest, args...)
+}
+
+// dbMaps is sqlx.DB.QueryxContext through the statement cache, if any,
+// scanning the rows as scanMaps does.
+func (c *cache) dbMaps(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if db := c.dbFor(ctx); c.stmts == nil || db != c.db {
+		rows, err := db.QueryxContext(ctx, query, args...)
+		return scanMaps(rows, err, dest)
+	}
+
+	e, err := c.stmts.acquire(ctx, c.db, query)
+	if err != nil {
+		return err
+	}
+	defer c.stmts.release(e)
+
+	rows, err := e.stmt.QueryxContext(ctx, args...)
+	return scanMaps(rows, err, dest)
+}
+
+// dbSelect is sqlx.DB.SelectContext through the statement cache, if any.
+func (c *cache) dbSelect(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if db := c.dbFor(ctx); c.stmts == nil || db != c.db {
+		return db.SelectContext(ctx, dest, query, args...)
+	}
+
+	e, err := c.stmts.acquire(ctx, c.db, query)
+	if err != nil {
+		return err
+	}
+	defer c.stmts.release(e)
+
+	return e.stmt.SelectContext(ctx, dest, args...)
+}
@@ -0,0 +1,64 @@
+package memcachedb
+
+import "context"
+
+// stopping is the bit of cache.active set once Stop is called; the bits
+// below it count the calls in flight.
+const stopping = 1 << 62
+
+func (c *cache) Stop(ctx context.Context) error {
+	for {
+		n := c.active.Load()
+		if n&stopping != 0 {
+			break
+		}
+		if c.active.CompareAndSwap(n, n|stopping) {
+			close(c.stop)
+			if n == 0 {
+				c.drain()
+			}
+			break
+		}
+	}
+
+	select {
+	case <-c.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// begin registers a call with the drain accounting of Stop. It reports false
+// once the cache is stopped. It takes no lock, so that concurrent hits do
+// not contend on it.
+func (c *cache) begin() bool {
+	if c.active.Add(1)&stopping != 0 {
+		c.end()
+		return false
+	}
+
+	return true
+}
+
+func (c *cache) end() {
+	if c.active.Add(-1) == stopping {
+		c.drain()
+	}
+}
+
+// drain reports that no call is left in flight after Stop, and that the
+// cache is drained once its background work finishes. Calls beginning after
+// Stop back out and may bring the count to zero again.
+func (c *cache) drain() {
+	if c.draining.CompareAndSwap(false, true) {
+		if c.stmts != nil {
+			c.stmts.close()
+		}
+		close(c.settled)
+		go func() {
+			c.finishing.Wait()
+			close(c.drained)
+		}()
+	}
+}
@@ -0,0 +1,188 @@
+package memcachedb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+)
+
+type (
+	// Store holds the entries of a Cache in place of the built-in sharded
+	// map, for instance to use another in-memory structure or to keep
+	// entries off the heap. Implementations must be safe for concurrent use.
+	// A Cache with a Store leaves bounding it to the Store: WithShards,
+	// WithMaxEntries, WithMaxBytes, WithEvictionPolicy and WithTinyLFU do
+	// not apply.
+	Store interface {
+		// Get returns the entry under key. It counts as an access for
+		// the bounds of the store, if it has any.
+		Get(key string) (*Entry, bool)
+		// Set stores e under key and returns the entry it replaced.
+		// stored is false when the store turned e away, in which case
+		// any old entry stays.
+		Set(key string, e *Entry) (old *Entry, stored bool)
+		// Delete removes the entry under key and returns it.
+		Delete(key string) (*Entry, bool)
+		// Scan calls fn for each entry until fn returns false. The
+		// cache never calls the store from fn.
+		Scan(fn func(key string, e *Entry) bool)
+		// Len returns the number of entries.
+		Len() int
+	}
+
+	// EvictingStore is a Store that drops entries on its own to stay
+	// within its bounds. The cache calls OnEvict once, before using the
+	// store, with the function to report each dropped entry to, so that
+	// evictions are counted and reach the WithOnEvict callback. fn may
+	// read the store, so the store must not hold its locks calling it.
+	EvictingStore interface {
+		Store
+		OnEvict(fn func(key string, e *Entry))
+	}
+
+	// storeSegment is the segment of a cache backed by a Store.
+	storeSegment struct {
+		Store
+	}
+)
+
+// Value returns the cached result, decoded if it is stored encoded, or nil
+// if it cannot be.
+func (v *Entry) Value() interface{} {
+	value, _ := v.load()
+	return value
+}
+
+// Expires returns when the entry expires.
+func (v *Entry) Expires() time.Time {
+	return time.Unix(0, v.lifetime)
+}
+
+// Size returns the cost of the entry, as counted against WithMaxBytes. It
+// is zero when the cache has no byte budget.
+func (v *Entry) Size() int64 {
+	return v.size
+}
+
+// MarshalBinary encodes the entry with encoding/gob, for stores that keep
+// entries as bytes. The concrete type of the value must be registered with
+// gob.Register. Cached errors and empty results cannot be encoded;
+// Persistable tells them apart.
+func (v *Entry) MarshalBinary() ([]byte, error) {
+	if !v.persistable() {
+		return nil, ErrNotPersistable
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(newSnapshotEntry("", v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes an entry encoded by MarshalBinary.
+func (v *Entry) UnmarshalBinary(data []byte) error {
+	var e snapshotEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e); err != nil {
+		return err
+	}
+	*v = Entry{
+		lifetime:    e.Lifetime,
+		fresh:       e.Fresh,
+		refreshAt:   e.RefreshAt,
+		value:       e.Value,
+		tags:        e.Tags,
+		fingerprint: e.Fingerprint,
+		created:     e.Created,
+	}
+
+	return nil
+}
+
+// same reports whether v is the entry e, or a copy of it decoded by a
+// Store that keeps entries as bytes.
+func (v *Entry) same(e *Entry) bool {
+	return v == e || (v.lifetime == e.lifetime && v.fingerprint == e.fingerprint)
+}
+
+// Persistable reports whether MarshalBinary can encode the entry.
+func (v *Entry) Persistable() bool {
+	return v.persistable()
+}
+
+func (c *cache) storeSegment() segment {
+	if es, ok := c.backend.(EvictingStore); ok {
+		es.OnEvict(func(key string, e *Entry) {
+			c.stats.evictions.Add(1)
+			c.evicted([]eviction{{key: key, value: e}})
+		})
+	}
+
+	return storeSegment{c.backend}
+}
+
+// lookup counts as an access, as a Store has no way to look an entry up
+// without one.
+func (s storeSegment) lookup(key string) (*Entry, bool) {
+	return s.Get(key)
+}
+
+func (s storeSegment) get(key string) (*Entry, bool) {
+	return s.Get(key)
+}
+
+func (s storeSegment) set(key string, v *Entry) (bool, *Entry, []eviction) {
+	old, stored := s.Set(key, v)
+	return stored, old, nil
+}
+
+func (s storeSegment) delete(key string) (*Entry, bool) {
+	return s.Delete(key)
+}
+
+// deleteIf is not atomic: an entry stored between the check and the
+// deletion is deleted in place of the one checked.
+func (s storeSegment) deleteIf(key string, cond func(v *Entry) bool) (*Entry, bool) {
+	v, ok := s.Get(key)
+	if !ok || (cond != nil && !cond(v)) {
+		return nil, false
+	}
+
+	return s.Delete(key)
+}
+
+// swap is not atomic, as deleteIf is not.
+func (s storeSegment) swap(key string, old, v *Entry) bool {
+	e, ok := s.Get(key)
+	if !ok || !e.same(old) {
+		return false
+	}
+	_, stored := s.Set(key, v)
+
+	return stored
+}
+
+func (s storeSegment) scan(fn func(key string, v *Entry) bool) {
+	var entries []eviction
+	s.Scan(func(key string, e *Entry) bool {
+		entries = append(entries, eviction{key: key, value: e})
+		return true
+	})
+
+	for _, e := range entries {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+func (s storeSegment) usage() (int, int64) {
+	return s.Len(), 0
+}
+
+// shrink leaves a Store alone: it has no notion of cold entries the cache
+// could act on.
+func (s storeSegment) shrink(float64) []eviction { return nil }
+
+func (s storeSegment) relax() {}
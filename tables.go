@@ -0,0 +1,67 @@
+package memcachedb
+
+import (
+	"slices"
+	"strings"
+)
+
+// tablePrefix marks the tags WithTables derives from table names, and
+// rowsPrefix those of the rows GetRowContext and SelectRowsContext cache.
+// The NUL byte keeps them apart from tags set with WithTags.
+const (
+	tablePrefix = "\x00table:"
+	rowsPrefix  = "\x00rows:"
+)
+
+// tableTag returns the tag for table. Table names are matched case
+// insensitively, as unquoted SQL identifiers are.
+func tableTag(table string) string {
+	return tablePrefix + strings.ToLower(table)
+}
+
+// rowsTag returns the tag of the row entries of table. Rows carry it
+// instead of the table tag, so that a write naming its rows with WithRows
+// leaves the other rows of the table cached.
+func rowsTag(table string) string {
+	return rowsPrefix + strings.ToLower(table)
+}
+
+// WithTables declares the database tables the query of this call reads, so
+// that InvalidateTables on any of them removes the cached entry. The query
+// methods taking SQL text, such as GetContext, find the tables of their
+// query themselves; WithTables adds to them, for instance the tables behind
+// a view.
+func WithTables(tables ...string) CallOption {
+	return func(o *callOptions) {
+		for _, table := range tables {
+			o.tags = append(o.tags, tableTag(table))
+		}
+	}
+}
+
+func (c *cache) InvalidateTables(tables ...string) int {
+	n := 0
+	for _, table := range tables {
+		n += c.InvalidateTag(tableTag(table)) + c.InvalidateTag(rowsTag(table))
+	}
+
+	return n
+}
+
+// invalidateWrites removes the entries a statement writing to tables
+// invalidates, given the options of its call. The rows of the tables
+// named by WithRows are removed one by one rather than with the table.
+func (c *cache) invalidateWrites(tables []string, o callOptions) {
+	for _, table := range tables {
+		c.InvalidateTag(tableTag(table))
+		if !slices.ContainsFunc(o.rowTables, func(t string) bool { return strings.EqualFold(t, table) }) {
+			c.InvalidateTag(rowsTag(table))
+		}
+	}
+	for _, tag := range o.tags {
+		c.InvalidateTag(tag)
+	}
+	for _, key := range o.rows {
+		c.InvalidateKey(key)
+	}
+}
@@ -0,0 +1,100 @@
+package memcachedb
+
+import (
+	"slices"
+	"sync"
+)
+
+// tagIndex maps tags to the keys of the entries carrying them.
+type tagIndex struct {
+	mu   sync.Mutex
+	keys map[string]map[string]struct{}
+}
+
+func (t *tagIndex) add(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.keys == nil {
+		t.keys = make(map[string]map[string]struct{})
+	}
+	for _, tag := range tags {
+		keys, ok := t.keys[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.keys[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (t *tagIndex) remove(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tag := range tags {
+		keys := t.keys[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+}
+
+func (t *tagIndex) keysOf(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.keys[tag]))
+	for k := range t.keys[tag] {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// tagsMissing returns the tags of v that other does not carry.
+func tagsMissing(v, other *Entry) []string {
+	if other == nil {
+		return v.tags
+	}
+
+	return slices.DeleteFunc(slices.Clone(v.tags), func(tag string) bool {
+		return slices.Contains(other.tags, tag)
+	})
+}
+
+// untag drops tags of key from the tag index. A store under key racing the
+// removal may have indexed the same tags for its new entry already, so the
+// tags of the entry key holds afterwards are indexed again.
+func (c *cache) untag(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	c.tags.remove(key, tags)
+	if cur, ok := c.shard(key).lookup(key); ok {
+		c.tags.add(key, cur.tags)
+	}
+}
+
+func (c *cache) InvalidateTag(tag string) int {
+	n := 0
+	for _, key := range c.tags.keysOf(tag) {
+		hasTag := func(v *Entry) bool { return slices.Contains(v.tags, tag) }
+		if v, ok := c.shard(key).deleteIf(key, hasTag); ok {
+			n++
+			c.removed(key, v, ReasonInvalidated)
+		}
+	}
+
+	return n
+}
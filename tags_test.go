@@ -0,0 +1,60 @@
+package memcachedb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTagIndexUnderRace(t *testing.T) {
+	c := New(nil, WithoutJanitor())
+	defer c.Stop(context.Background())
+
+	for round := 0; round < 5000; round++ {
+		c.Set("k", 0, time.Minute, WithTags("t"))
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for w := 0; w < 2; w++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				<-start
+				c.Set("k", round, time.Minute, WithTags("t"))
+			}()
+			go func() {
+				defer wg.Done()
+				<-start
+				c.InvalidateTag("t")
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		_, cached := c.PeekKey("k")
+		if n := c.InvalidateTag("t"); cached && n != 1 {
+			t.Fatalf("round %d: InvalidateTag = %d, want the entry under k", round, n)
+		}
+		if _, ok := c.PeekKey("k"); ok {
+			t.Fatalf("round %d: k cached after InvalidateTag", round)
+		}
+	}
+}
+
+func TestTagIndexStoreDuringRemoval(t *testing.T) {
+	c := New(nil, WithoutJanitor()).(*cache)
+	defer c.Stop(context.Background())
+
+	// The interleaving the race above hits at random: InvalidateTag
+	// deletes the old entry, a Set stores a new one and only then does
+	// the removal of the old one reach the tag index.
+	c.Set("k", 1, time.Minute, WithTags("t"))
+	old, _ := c.shard("k").delete("k")
+	c.Set("k", 2, time.Minute, WithTags("t"))
+	c.removed("k", old, ReasonInvalidated)
+
+	if n := c.InvalidateTag("t"); n != 1 {
+		t.Errorf("InvalidateTag = %d, want the entry stored during the removal", n)
+	}
+}
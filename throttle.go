@@ -0,0 +1,104 @@
+package memcachedb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// throttle spaces the loads of every key at least interval apart, as
+	// set by WithLoadInterval.
+	throttle struct {
+		interval time.Duration
+
+		mu    sync.Mutex
+		loads map[string]*lastLoad
+	}
+
+	// lastLoad is when the last load of a key started, and the entry it
+	// cached once it is done.
+	lastLoad struct {
+		at    int64
+		entry *Entry
+	}
+)
+
+func newThrottle(interval time.Duration) *throttle {
+	return &throttle{interval: interval, loads: make(map[string]*lastLoad)}
+}
+
+// admit reports whether a load of key may run now, marking it as started
+// if so. Otherwise it returns the entry the last load cached, if it is
+// done, and how long until the next load may run.
+func (t *throttle) admit(key string) (*Entry, time.Duration) {
+	now := time.Now().UnixNano()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.loads[key]
+	if !ok {
+		t.loads[key] = &lastLoad{at: now}
+		return nil, 0
+	}
+	if wait := time.Duration(l.at + int64(t.interval) - now); wait > 0 {
+		return l.entry, wait
+	}
+	l.at, l.entry = now, nil
+	return nil, 0
+}
+
+// loaded records e as what the last load of key cached.
+func (t *throttle) loaded(key string, e *Entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if l, ok := t.loads[key]; ok {
+		l.entry = e
+	}
+}
+
+// prune forgets the loads that no longer hold back the next one.
+func (t *throttle) prune(now int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, l := range t.loads {
+		if l.at+int64(t.interval) <= now {
+			delete(t.loads, key)
+		}
+	}
+}
+
+// throttled holds a load of key back until the interval set by
+// WithLoadInterval has passed since the last one. A load held back is
+// served the result the last one cached, if it matches o; otherwise it
+// waits for its turn, or until ctx is done. ok reports whether the load
+// is over, ending with v and err.
+func (c *cache) throttled(ctx context.Context, key string, o callOptions) (v interface{}, err error, ok bool) {
+	if c.throttle == nil {
+		return nil, nil, false
+	}
+
+	for held := false; ; held = true {
+		e, wait := c.throttle.admit(key)
+		if wait <= 0 {
+			return nil, nil, false
+		}
+		if !held {
+			c.stats.throttled.Add(1)
+		}
+		if e != nil && e.matches(o.fingerprint) {
+			return e.Value(), e.err, true
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err(), true
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package memcachedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"time"
+)
+
+type (
+	// Tier is a cache shared between processes, such as Redis or
+	// memcached, that a Cache consults on a miss before running the query.
+	// Values are opaque bytes; the Cache encodes entries with
+	// encoding/gob, so the concrete types of cached values must be
+	// registered with gob.Register.
+	Tier interface {
+		// Get returns the value stored under key and reports whether
+		// there was one.
+		Get(ctx context.Context, key string) ([]byte, bool, error)
+		// Set stores value under key for ttl.
+		Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+		// Delete removes the value stored under key, if any.
+		Delete(ctx context.Context, key string) error
+	}
+
+	// FlushingTier is a Tier that can remove every value whose key starts
+	// with a prefix, whichever process stored it. FlushAll and FlushPrefix
+	// call DeletePrefix on an L2 tier implementing it; on other tiers they
+	// only reach the keys the process holds.
+	FlushingTier interface {
+		Tier
+		// DeletePrefix removes the values stored under keys starting
+		// with prefix, every value if prefix is empty.
+		DeletePrefix(ctx context.Context, prefix string) error
+	}
+)
+
+// tierGet returns the entry key has in t for the call described by o, if
+// it has one that has not expired.
+func (c *cache) tierGet(ctx context.Context, t Tier, key string, o callOptions) (*Entry, bool) {
+	b, ok, err := t.Get(ctx, key)
+	if err != nil {
+		c.logger.WarnContext(ctx, "memcachedb: tier get failed", "key", key, "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var e snapshotEntry
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&e); err != nil {
+		c.logger.WarnContext(ctx, "memcachedb: tier entry undecodable", "key", key, "error", err)
+		return nil, false
+	}
+	if e.Lifetime <= c.now() {
+		return nil, false
+	}
+	v := c.restoredEntity(e)
+	if !v.matches(o.fingerprint) {
+		c.stats.collisions.Add(1)
+		return nil, false
+	}
+
+	return v, true
+}
+
+// tierSet copies v to t for what remains of its lifetime.
+func (c *cache) tierSet(ctx context.Context, t Tier, key string, v *Entry) {
+	ttl := time.Duration(v.lifetime - c.now())
+	if !v.persistable() || ttl <= 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(newSnapshotEntry(key, v)); err != nil {
+		c.logger.DebugContext(ctx, "memcachedb: entry not shared", "key", key, "error", err)
+		return
+	}
+	if err := t.Set(ctx, key, buf.Bytes(), ttl); err != nil {
+		c.logger.WarnContext(ctx, "memcachedb: tier set failed", "key", key, "error", err)
+	}
+}
+
+// tierFlush removes the keys starting with prefix from t, if it can.
+func (c *cache) tierFlush(t Tier, prefix string) {
+	ft, ok := t.(FlushingTier)
+	if !ok {
+		return
+	}
+	if err := ft.DeletePrefix(context.Background(), prefix); err != nil {
+		c.logger.Warn("memcachedb: tier flush failed", "prefix", prefix, "error", err)
+	}
+}
+
+// tierDelete removes key from t.
+func (c *cache) tierDelete(t Tier, key string) {
+	if err := t.Delete(context.Background(), key); err != nil {
+		c.logger.Warn("memcachedb: tier delete failed", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package memcachedb
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mapTier is a Tier shared by the caches of a test, as Redis would be by
+// processes.
+type mapTier struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+// flushingMapTier is a mapTier that is a FlushingTier.
+type flushingMapTier struct{ *mapTier }
+
+func (t *mapTier) Get(_ context.Context, key string) ([]byte, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.values[key]
+	return b, ok, nil
+}
+
+func (t *mapTier) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.values == nil {
+		t.values = make(map[string][]byte)
+	}
+	t.values[key] = value
+	return nil
+}
+
+func (t *mapTier) Delete(_ context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.values, key)
+	return nil
+}
+
+func (t flushingMapTier) DeletePrefix(_ context.Context, prefix string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.values {
+		if strings.HasPrefix(key, prefix) {
+			delete(t.values, key)
+		}
+	}
+	return nil
+}
+
+func TestFlushPrefixL2(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		flushing bool
+	}{{"tier", false}, {"flushing tier", true}} {
+		t.Run(tt.name, func(t *testing.T) {
+			shared := new(mapTier)
+			var tier Tier = shared
+			if tt.flushing {
+				tier = flushingMapTier{shared}
+			}
+			ctx := context.Background()
+			a := New(nil, WithoutJanitor(), WithL2(tier))
+			defer a.Stop(ctx)
+			b := New(nil, WithoutJanitor(), WithL2(tier))
+			defer b.Stop(ctx)
+
+			a.Set("users:1", "a", time.Minute)
+			b.Set("users:2", "b", time.Minute)
+			b.Set("orders:1", "b", time.Minute)
+
+			if n := a.FlushPrefix("users:"); n != 1 {
+				t.Errorf("FlushPrefix = %d, want the 1 entry held", n)
+			}
+			if _, ok, _ := shared.Get(ctx, "users:1"); ok {
+				t.Error("key held by the process left in the tier")
+			}
+			if _, ok, _ := shared.Get(ctx, "users:2"); ok == tt.flushing {
+				t.Errorf("key held by another process in the tier: %t, want %t", ok, !tt.flushing)
+			}
+			if _, ok, _ := shared.Get(ctx, "orders:1"); !ok {
+				t.Error("key outside the prefix removed from the tier")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package memcachedb
+
+import "hash/maphash"
+
+const (
+	sketchDepth = 4
+	// defaultSketchCapacity sizes the sketch of shards bounded by bytes
+	// only, whose entry count is not known up front.
+	defaultSketchCapacity = 1024
+)
+
+// tinyLFU is an admission filter: it estimates how often keys are accessed
+// with a count-min sketch and only lets a new key into a full shard when it
+// is more popular than the entry it would displace. Counters are halved
+// every sampleSize increments so the estimate tracks recent popularity.
+type tinyLFU struct {
+	seed       maphash.Seed
+	counters   [sketchDepth][]uint8
+	mask       uint64
+	samples    int
+	sampleSize int
+}
+
+func newTinyLFU(capacity int) *tinyLFU {
+	if capacity <= 0 {
+		capacity = defaultSketchCapacity
+	}
+
+	width := 16
+	for width < capacity*4 {
+		width <<= 1
+	}
+
+	t := &tinyLFU{
+		seed:       maphash.MakeSeed(),
+		mask:       uint64(width - 1),
+		sampleSize: 10 * capacity,
+	}
+	for i := range t.counters {
+		t.counters[i] = make([]uint8, width)
+	}
+
+	return t
+}
+
+func (t *tinyLFU) record(key string) {
+	h := maphash.String(t.seed, key)
+	for i := range t.counters {
+		if c := &t.counters[i][t.index(h, i)]; *c < 15 {
+			*c++
+		}
+	}
+
+	t.samples++
+	if t.samples >= t.sampleSize {
+		t.samples = 0
+		for i := range t.counters {
+			for j := range t.counters[i] {
+				t.counters[i][j] >>= 1
+			}
+		}
+	}
+}
+
+func (t *tinyLFU) estimate(key string) uint8 {
+	h := maphash.String(t.seed, key)
+	est := uint8(15)
+	for i := range t.counters {
+		est = min(est, t.counters[i][t.index(h, i)])
+	}
+
+	return est
+}
+
+// admit reports whether candidate should replace victim.
+func (t *tinyLFU) admit(candidate, victim string) bool {
+	return t.estimate(candidate) > t.estimate(victim)
+}
+
+func (t *tinyLFU) index(h uint64, i int) uint64 {
+	return (h + uint64(i)*(h>>32|1)) & t.mask
+}
@@ -0,0 +1,21 @@
+package memcachedb
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "memcache-database-module"
+
+var (
+	attrKey    = attribute.Key("memcachedb.key")
+	attrHit    = attribute.Key("memcachedb.hit")
+	attrForced = attribute.Key("memcachedb.forced")
+)
+
+// recordError marks span as failed with err.
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
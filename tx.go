@@ -0,0 +1,179 @@
+package memcachedb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Tx is a view of a Cache for the work of a database transaction, as
+// returned by Cache.WithTx. Its reads run inside the transaction and never
+// reach the cache, so that they see the writes of the transaction and none
+// of them leaks to other callers before it commits. Its invalidations are
+// held back until Commit succeeds and dropped by Rollback.
+type Tx struct {
+	c  *cache
+	tx *sqlx.Tx
+
+	mu      sync.Mutex
+	pending []func()
+}
+
+func (c *cache) WithTx(tx *sqlx.Tx) *Tx {
+	return &Tx{c: c, tx: tx}
+}
+
+// Tx returns the transaction of the view.
+func (t *Tx) Tx() *sqlx.Tx {
+	return t.tx
+}
+
+// DoContext runs query with ctx and args, leaving out CallOption values.
+func (t *Tx) DoContext(ctx context.Context, query func(ctx context.Context, args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
+	args, _ = t.c.splitArgs(args)
+	return query(ctx, args...)
+}
+
+// Do is DoContext for queries that take no context.
+func (t *Tx) Do(query func(args ...interface{}) (interface{}, error), args ...interface{}) (interface{}, error) {
+	args, _ = t.c.splitArgs(args)
+	return query(args...)
+}
+
+// DoKeyed runs loader with ctx.
+func (t *Tx) DoKeyed(ctx context.Context, _ string, loader func(ctx context.Context) (interface{}, error), _ ...CallOption) (interface{}, error) {
+	return loader(ctx)
+}
+
+// GetContext is sqlx.Tx.GetContext, leaving out CallOption values among
+// args.
+func (t *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	args, _ = t.c.splitArgs(args)
+	return t.tx.GetContext(ctx, dest, query, args...)
+}
+
+// SelectContext is sqlx.Tx.SelectContext, leaving out CallOption values
+// among args.
+func (t *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	args, _ = t.c.splitArgs(args)
+	return t.tx.SelectContext(ctx, dest, query, args...)
+}
+
+// QueryContext is Cache.QueryContext within the transaction.
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	args, _ = t.c.splitArgs(args)
+	rows, err := t.tx.QueryxContext(ctx, query, args...)
+
+	var maps []map[string]interface{}
+	if err := scanMaps(rows, err, &maps); err != nil {
+		return nil, err
+	}
+
+	return maps, nil
+}
+
+// NamedGetContext is GetContext for a query with named parameters.
+func (t *Tx) NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
+	q, args, err := bindNamed(t.tx, query, arg, nil)
+	if err != nil {
+		return err
+	}
+
+	return t.tx.GetContext(ctx, dest, q, args...)
+}
+
+// NamedSelectContext is SelectContext for a query with named parameters.
+func (t *Tx) NamedSelectContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
+	q, args, err := bindNamed(t.tx, query, arg, nil)
+	if err != nil {
+		return err
+	}
+
+	return t.tx.SelectContext(ctx, dest, q, args...)
+}
+
+// ExecContext is Cache.ExecContext within the transaction: the entries of
+// the tables it writes to are invalidated once the transaction commits.
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	args, o := t.c.splitArgs(args)
+	res, err := t.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := writeTables(query)
+	t.hold(func() {
+		t.c.invalidateWrites(tables, o)
+	})
+
+	return res, nil
+}
+
+// Invalidate is Cache.Invalidate once the transaction commits.
+func (t *Tx) Invalidate(args ...interface{}) error {
+	args, _ = t.c.splitArgs(args)
+	h, _, err := t.c.hash(args...)
+	if err != nil {
+		return err
+	}
+	t.InvalidateKey(h)
+
+	return nil
+}
+
+// InvalidateKey is Cache.InvalidateKey once the transaction commits.
+func (t *Tx) InvalidateKey(key string) {
+	t.hold(func() { t.c.InvalidateKey(key) })
+}
+
+// InvalidateTag is Cache.InvalidateTag once the transaction commits.
+func (t *Tx) InvalidateTag(tag string) {
+	t.hold(func() { t.c.InvalidateTag(tag) })
+}
+
+// InvalidateTables is Cache.InvalidateTables once the transaction commits.
+func (t *Tx) InvalidateTables(tables ...string) {
+	t.hold(func() { t.c.InvalidateTables(tables...) })
+}
+
+// Commit commits the transaction and, if it succeeds, applies the
+// invalidations made through the view. They are dropped when it fails.
+func (t *Tx) Commit() error {
+	err := t.tx.Commit()
+	pending := t.take()
+	if err != nil {
+		return err
+	}
+	for _, fn := range pending {
+		fn()
+	}
+
+	return nil
+}
+
+// Rollback aborts the transaction and drops the invalidations made through
+// the view.
+func (t *Tx) Rollback() error {
+	t.take()
+	return t.tx.Rollback()
+}
+
+// hold holds fn back until the transaction commits.
+func (t *Tx) hold(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, fn)
+}
+
+func (t *Tx) take() []func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.pending
+	t.pending = nil
+
+	return pending
+}
@@ -0,0 +1,27 @@
+package memcachedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DoTyped is DoKeyed with a typed result. Every call site sharing a key
+// must use the same T.
+func DoTyped[T any](ctx context.Context, c Cache, key string, loader func(ctx context.Context) (T, error), opts ...CallOption) (T, error) {
+	var zero T
+
+	v, err := c.DoKeyed(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return loader(ctx)
+	}, opts...)
+	if (err != nil && !errors.Is(err, ErrValueTooLarge)) || v == nil {
+		return zero, err
+	}
+
+	t, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: key %q holds %T, not %T", ErrTypeMismatch, key, v, zero)
+	}
+
+	return t, err
+}
@@ -0,0 +1,70 @@
+package memcachedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type (
+	// WarmSpec is a query Warm runs ahead of traffic. Args are handled as
+	// the arguments of DoContext, call options included.
+	WarmSpec struct {
+		// Name identifies the spec in progress reports and errors.
+		Name  string
+		Query func(ctx context.Context, args ...interface{}) (interface{}, error)
+		Args  []interface{}
+	}
+
+	// WarmProgress reports a spec Warm finished.
+	WarmProgress struct {
+		Spec WarmSpec
+		// Err is the error the spec failed with, if any.
+		Err error
+		// Done counts the specs finished so far, out of Total.
+		Done, Total int
+	}
+)
+
+func (c *cache) Warm(ctx context.Context, specs []WarmSpec) error {
+	var (
+		mu   sync.Mutex
+		done int
+		errs []error
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, max(c.warmConcurrency, 1))
+		// stopped is the error of ctx, once it stops Warm starting specs.
+		stopped error
+	)
+	for _, spec := range specs {
+		if stopped = ctx.Err(); stopped != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(spec WarmSpec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_, err := c.DoContext(ctx, spec.Query, spec.Args...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if err != nil {
+				errs = append(errs, fmt.Errorf("memcachedb: warm %s: %w", spec.Name, err))
+			}
+			if c.warmProgress != nil {
+				c.warmProgress(WarmProgress{Spec: spec, Err: err, Done: done, Total: len(specs)})
+			}
+		}(spec)
+	}
+	wg.Wait()
+	if stopped != nil {
+		errs = append(errs, stopped)
+	}
+
+	return errors.Join(errs...)
+}
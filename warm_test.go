@@ -0,0 +1,62 @@
+package memcachedb
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWarmCancelled(t *testing.T) {
+	c := New(nil, WithoutJanitor())
+	defer c.Stop(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var ran atomic.Int32
+	err := c.Warm(ctx, []WarmSpec{{
+		Name: "users",
+		Query: func(context.Context, ...interface{}) (interface{}, error) {
+			ran.Add(1)
+			return 1, nil
+		},
+	}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Warm = %v, want context.Canceled", err)
+	}
+	if n := ran.Load(); n != 0 {
+		t.Errorf("Warm ran %d specs after ctx was done, want 0", n)
+	}
+}
+
+func TestWarmCancelledWhileRunning(t *testing.T) {
+	c := New(nil, WithoutJanitor(), WithWarmConcurrency(4))
+	defer c.Stop(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failed := errors.New("failed")
+	specs := make([]WarmSpec, 64)
+	for i := range specs {
+		specs[i] = WarmSpec{
+			Name: "spec",
+			Query: func(context.Context, ...interface{}) (interface{}, error) {
+				if i == 8 {
+					cancel()
+				}
+				return nil, failed
+			},
+			Args: []interface{}{i},
+		}
+	}
+
+	err := c.Warm(ctx, specs)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Warm = %v, want context.Canceled", err)
+	}
+	if !errors.Is(err, failed) {
+		t.Errorf("Warm = %v, want the errors of the specs", err)
+	}
+}